@@ -0,0 +1,366 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDB is an embedded database in a single file, in which the resources of each collection are stored as JSON
+// documents. Writes are synced to the file before they return, so that the resources survive crashes and restarts.
+// Queries are evaluated on all the resources of a collection, which makes it suited for small deployments that can not
+// depend on an external database.
+type BoltDB struct {
+	db *bolt.DB
+}
+
+var (
+	// resourcesBucket is the bucket of a collection that holds its resources by their id.
+	resourcesBucket = []byte("resources")
+	// uniqueBucket is the bucket of a collection that holds a bucket per unique attribute, in which the ids of the
+	// resources are stored by the values they have of the attribute.
+	uniqueBucket = []byte("unique")
+)
+
+// OpenBolt opens the database in the file at the given path, which is created if it does not exist. Only one process
+// can open the database at a time.
+func OpenBolt(path string) (*BoltDB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltDB{db: db}, nil
+}
+
+// Close closes the database file.
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+// Store returns the store of the resources of the given resource type in the collection with the given name. The
+// indexes that enforce the uniqueness of the attributes of the resource type are rebuilt, so that they match the
+// current schemas. An error is returned if the stored resources share values of a unique attribute.
+func (b *BoltDB) Store(collection string, resourceType scim.ResourceType) (BoltStore, error) {
+	s := BoltStore{
+		db:           b,
+		collection:   []byte(collection),
+		resourceType: resourceType,
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		c, err := tx.CreateBucketIfNotExists(s.collection)
+		if err != nil {
+			return err
+		}
+		resources, err := c.CreateBucketIfNotExists(resourcesBucket)
+		if err != nil {
+			return err
+		}
+		if c.Bucket(uniqueBucket) != nil {
+			if err := c.DeleteBucket(uniqueBucket); err != nil {
+				return err
+			}
+		}
+		if _, err := c.CreateBucket(uniqueBucket); err != nil {
+			return err
+		}
+
+		return resources.ForEach(func(id, document []byte) error {
+			resource, err := decodeDocument(document)
+			if err != nil {
+				return err
+			}
+			if err := s.index(c, string(id), resource); err != nil {
+				return fmt.Errorf("resource %s: %w", id, err)
+			}
+			return nil
+		})
+	})
+	return s, err
+}
+
+// boltTransaction is the key of the context value that holds the transaction in progress.
+type boltTransaction struct{}
+
+// boltTx is the (writable) transaction of a database in progress.
+type boltTx struct {
+	db *BoltDB
+	tx *bolt.Tx
+}
+
+// view calls fn within a read-only transaction, or within the transaction in progress if the context is that of a
+// transaction of the database.
+func (b *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t, ok := ctx.Value(boltTransaction{}).(boltTx); ok && t.db == b {
+		return fn(t.tx)
+	}
+	return b.db.View(fn)
+}
+
+// update calls fn within a writable transaction, or within the transaction in progress if the context is that of a
+// transaction of the database.
+func (b *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t, ok := ctx.Value(boltTransaction{}).(boltTx); ok && t.db == b {
+		return fn(t.tx)
+	}
+	return b.db.Update(fn)
+}
+
+// Transaction calls fn within a writable transaction, which is committed if fn returns nil and rolled back otherwise.
+// Nested transactions are part of the transaction in progress. Only one writable transaction can be in progress at a
+// time.
+func (b *BoltDB) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t, ok := ctx.Value(boltTransaction{}).(boltTx); ok && t.db == b {
+		return fn(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(context.WithValue(ctx, boltTransaction{}, boltTx{db: b, tx: tx}))
+	})
+}
+
+// BoltStore stores the resources of a resource type in a collection of an embedded database. It implements scim.Store.
+type BoltStore struct {
+	db           *BoltDB
+	collection   []byte
+	resourceType scim.ResourceType
+}
+
+// Insert stores a new resource.
+func (s BoltStore) Insert(ctx context.Context, resource scim.ResourceAttributes) error {
+	document, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	id, _ := resource["id"].(string)
+
+	return s.db.update(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.collection)
+		resources := c.Bucket(resourcesBucket)
+		if resources.Get([]byte(id)) != nil {
+			return scim.ErrDuplicateValue
+		}
+		if err := s.index(c, id, resource); err != nil {
+			return err
+		}
+		return resources.Put([]byte(id), document)
+	})
+}
+
+// Find returns the stored resource with the given id, or nil if there is no such resource.
+func (s BoltStore) Find(ctx context.Context, id string) (scim.ResourceAttributes, error) {
+	var resource scim.ResourceAttributes
+	err := s.db.view(ctx, func(tx *bolt.Tx) error {
+		document := tx.Bucket(s.collection).Bucket(resourcesBucket).Get([]byte(id))
+		if document == nil {
+			return nil
+		}
+		var err error
+		resource, err = decodeDocument(document)
+		return err
+	})
+	return resource, err
+}
+
+// Query returns the stored resources that match the query.
+func (s BoltStore) Query(ctx context.Context, query scim.StoreQuery) ([]scim.ResourceAttributes, error) {
+	resources, err := s.resources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.resourceType.QueryResources(resources, query)
+}
+
+// Count returns the number of stored resources that match the filter.
+func (s BoltStore) Count(ctx context.Context, filter filter.Expression) (int, error) {
+	resources, err := s.resources(ctx)
+	if err != nil {
+		return 0, err
+	}
+	resources, err = s.resourceType.MatchResources(resources, filter)
+	return len(resources), err
+}
+
+// InUse returns whether a resource other than the one with the given id has one of the values of the unique attribute.
+func (s BoltStore) InUse(ctx context.Context, attribute scim.UniqueAttribute, id string, values []interface{}) (bool, error) {
+	var inUse bool
+	err := s.db.view(ctx, func(tx *bolt.Tx) error {
+		index := tx.Bucket(s.collection).Bucket(uniqueBucket).Bucket([]byte(attribute.Path()))
+		if index == nil {
+			return nil
+		}
+		for _, value := range values {
+			if owner := index.Get(uniqueKey(attribute, value)); owner != nil && string(owner) != id {
+				inUse = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return inUse, err
+}
+
+// Replace replaces the stored resource with the given id, if it still has the given version.
+func (s BoltStore) Replace(ctx context.Context, id string, resource scim.ResourceAttributes, version string) error {
+	document, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	return s.db.update(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.collection)
+		resources := c.Bucket(resourcesBucket)
+		stored := resources.Get([]byte(id))
+		if stored == nil {
+			return scim.ErrVersionMismatch
+		}
+		current, err := decodeDocument(stored)
+		if err != nil {
+			return err
+		}
+		if meta, _ := current["meta"].(map[string]interface{}); version != "" && meta["version"] != version {
+			return scim.ErrVersionMismatch
+		}
+
+		if err := s.checkUnique(c, id, resource); err != nil {
+			return err
+		}
+		if err := s.unindex(c, id, current); err != nil {
+			return err
+		}
+		if err := s.index(c, id, resource); err != nil {
+			return err
+		}
+		return resources.Put([]byte(id), document)
+	})
+}
+
+// Delete removes the stored resource with the given id, if it still has the given version.
+func (s BoltStore) Delete(ctx context.Context, id string, version string) error {
+	return s.db.update(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.collection)
+		resources := c.Bucket(resourcesBucket)
+		stored := resources.Get([]byte(id))
+		if stored == nil {
+			if version != "" {
+				return scim.ErrVersionMismatch
+			}
+			return nil
+		}
+		current, err := decodeDocument(stored)
+		if err != nil {
+			return err
+		}
+		if meta, _ := current["meta"].(map[string]interface{}); version != "" && meta["version"] != version {
+			return scim.ErrVersionMismatch
+		}
+		if err := s.unindex(c, id, current); err != nil {
+			return err
+		}
+		return resources.Delete([]byte(id))
+	})
+}
+
+// Transaction calls fn within a transaction of the database. The stores of all collections of the database share the
+// transaction.
+func (s BoltStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.db.Transaction(ctx, fn)
+}
+
+// resources returns all the stored resources of the collection.
+func (s BoltStore) resources(ctx context.Context) ([]scim.ResourceAttributes, error) {
+	var resources []scim.ResourceAttributes
+	err := s.db.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(s.collection).Bucket(resourcesBucket).ForEach(func(_, document []byte) error {
+			resource, err := decodeDocument(document)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, resource)
+			return nil
+		})
+	})
+	return resources, err
+}
+
+// checkUnique returns scim.ErrDuplicateValue if the resource has the value of a unique attribute that a resource other
+// than the one with the given id has.
+func (s BoltStore) checkUnique(c *bolt.Bucket, id string, resource scim.ResourceAttributes) error {
+	for _, attribute := range s.resourceType.UniqueAttributes() {
+		index := c.Bucket(uniqueBucket).Bucket([]byte(attribute.Path()))
+		if index == nil {
+			continue
+		}
+		for _, value := range attribute.Values(resource) {
+			if owner := index.Get(uniqueKey(attribute, value)); owner != nil && string(owner) != id {
+				return scim.ErrDuplicateValue
+			}
+		}
+	}
+	return nil
+}
+
+// index adds the values of the unique attributes of the resource with the given id to the indexes of the collection.
+// All values are checked before any of them is added, so that the indexes are not changed if one of them is already in
+// use.
+func (s BoltStore) index(c *bolt.Bucket, id string, resource scim.ResourceAttributes) error {
+	if err := s.checkUnique(c, id, resource); err != nil {
+		return err
+	}
+	for _, attribute := range s.resourceType.UniqueAttributes() {
+		index, err := c.Bucket(uniqueBucket).CreateBucketIfNotExists([]byte(attribute.Path()))
+		if err != nil {
+			return err
+		}
+		for _, value := range attribute.Values(resource) {
+			if err := index.Put(uniqueKey(attribute, value), []byte(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unindex removes the values of the unique attributes of the resource with the given id from the indexes of the
+// collection.
+func (s BoltStore) unindex(c *bolt.Bucket, id string, resource scim.ResourceAttributes) error {
+	for _, attribute := range s.resourceType.UniqueAttributes() {
+		index := c.Bucket(uniqueBucket).Bucket([]byte(attribute.Path()))
+		if index == nil {
+			continue
+		}
+		for _, value := range attribute.Values(resource) {
+			key := uniqueKey(attribute, value)
+			if string(index.Get(key)) != id {
+				continue
+			}
+			if err := index.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueKey returns the key of the value of the unique attribute within its index. Values of attributes that are not
+// case exact are indexed case-insensitively.
+func uniqueKey(attribute scim.UniqueAttribute, value interface{}) []byte {
+	key := fmt.Sprint(value)
+	if !attribute.CaseExact() {
+		key = strings.ToLower(key)
+	}
+	return []byte(key)
+}
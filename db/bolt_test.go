@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBoltPath returns the path of a database file in a new temporary directory.
+func newTestBoltPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "scim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "scim.db")
+}
+
+func openTestBoltStore(t *testing.T, path string) (*BoltDB, BoltStore) {
+	db, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := db.Store("users", testResourceType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, store
+}
+
+func TestBoltStore(t *testing.T) {
+	db, store := openTestBoltStore(t, newTestBoltPath(t))
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, resource := range []scim.ResourceAttributes{
+		{"id": "0002", "userName": "jsmith", "emails": []interface{}{
+			map[string]interface{}{"value": "jsmith@example.com", "type": "work"},
+		}, "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0001", "userName": "bjensen", "active": true, "emails": []interface{}{
+			map[string]interface{}{"value": "bjensen@example.org", "type": "home"},
+			map[string]interface{}{"value": "babs@example.com", "type": "work", "primary": true},
+		}, "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0003", "userName": "adoe", "meta": map[string]interface{}{"version": `W/"1"`}},
+	} {
+		assert.NoError(t, store.Insert(ctx, resource))
+	}
+	assert.Equal(t, scim.ErrDuplicateValue, store.Insert(ctx, scim.ResourceAttributes{"id": "0004", "userName": "BJensen"}))
+	assert.Equal(t, scim.ErrDuplicateValue, store.Insert(ctx, scim.ResourceAttributes{"id": "0001", "userName": "babs"}))
+
+	resource, err := store.Find(ctx, "0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "bjensen", resource["userName"])
+	resource, err = store.Find(ctx, "0004")
+	assert.NoError(t, err)
+	assert.Nil(t, resource)
+
+	resources, err := store.Query(ctx, scim.StoreQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002", "0003"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{SortBy: "userName", Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{SortBy: "emails", SortOrder: scim.SortOrderDescending})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0003", "0002", "0001"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{Filter: parseFilter(t, `emails[type eq "WORK" and value ew ".com"]`)})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002"}, resourceIDs(resources))
+
+	count, err := store.Count(ctx, parseFilter(t, `userName sw "J" or active eq "true"`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = store.Query(ctx, scim.StoreQuery{SortBy: "unknown"})
+	assert.Equal(t, errors.ScimErrorBadParams([]string{"sortBy"}), err)
+	_, err = store.Count(ctx, parseFilter(t, `unknown eq "x"`))
+	assert.Equal(t, errors.ScimErrorInvalidFilter, err)
+
+	inUse, err := store.InUse(ctx, testResourceType.UniqueAttributes()[0], "0002", []interface{}{"ADOE"})
+	assert.NoError(t, err)
+	assert.True(t, inUse)
+	inUse, err = store.InUse(ctx, testResourceType.UniqueAttributes()[0], "0003", []interface{}{"adoe"})
+	assert.NoError(t, err)
+	assert.False(t, inUse)
+}
+
+func TestBoltStoreReplace(t *testing.T) {
+	db, store := openTestBoltStore(t, newTestBoltPath(t))
+	defer db.Close()
+	ctx := context.Background()
+
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0001", "userName": "bjensen", "meta": map[string]interface{}{"version": `W/"1"`}}))
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0002", "userName": "jsmith", "meta": map[string]interface{}{"version": `W/"1"`}}))
+
+	replaced := scim.ResourceAttributes{"id": "0001", "userName": "jsmith", "meta": map[string]interface{}{"version": `W/"2"`}}
+	assert.Equal(t, scim.ErrDuplicateValue, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	replaced["userName"] = "babs"
+	assert.Equal(t, scim.ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"0"`))
+	assert.NoError(t, store.Replace(ctx, "0001", replaced, `W/"1"`))
+	assert.Equal(t, scim.ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	// the previous value is no longer in use
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0003", "userName": "bjensen"}))
+
+	assert.Equal(t, scim.ErrVersionMismatch, store.Delete(ctx, "0001", `W/"1"`))
+	assert.NoError(t, store.Delete(ctx, "0001", `W/"2"`))
+	assert.Equal(t, scim.ErrVersionMismatch, store.Delete(ctx, "0001", `W/"2"`))
+	assert.NoError(t, store.Delete(ctx, "0001", ""))
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0004", "userName": "babs"}))
+	count, err := store.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestBoltStoreTransaction(t *testing.T) {
+	db, store := openTestBoltStore(t, newTestBoltPath(t))
+	defer db.Close()
+	other, err := db.Store("others", testResourceType)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	failure := errors.ScimErrorInternal
+	err = store.Transaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0001", "userName": "bjensen"}))
+		assert.NoError(t, other.Insert(ctx, scim.ResourceAttributes{"id": "0001"}))
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	for _, s := range []BoltStore{store, other} {
+		count, err := s.Count(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+	}
+	inUse, err := store.InUse(ctx, testResourceType.UniqueAttributes()[0], "", []interface{}{"bjensen"})
+	assert.NoError(t, err)
+	assert.False(t, inUse)
+
+	err = store.Transaction(ctx, func(ctx context.Context) error {
+		return other.Insert(ctx, scim.ResourceAttributes{"id": "0001"})
+	})
+	assert.NoError(t, err)
+	count, err := other.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestBoltStoreRestart(t *testing.T) {
+	path := newTestBoltPath(t)
+	db, store := openTestBoltStore(t, path)
+	handler := scim.NewStoreHandler(testResourceType, store)
+	r := httptest.NewRequest(http.MethodPost, "/Users", nil)
+
+	created, err := handler.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	db, store = openTestBoltStore(t, path)
+	defer db.Close()
+	handler = scim.NewStoreHandler(testResourceType, store)
+
+	resource, err := handler.Get(r, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "bjensen", resource.Attributes["userName"])
+	assert.Equal(t, created.Meta.Version, resource.Meta.Version)
+
+	// the unique values are indexed again
+	_, err = handler.Create(r, scim.ResourceAttributes{"userName": "BJENSEN"})
+	assert.Equal(t, errors.ScimTypeUniqueness, err.(errors.ScimError).ScimType)
+}
+
+func TestBoltStoreCancelled(t *testing.T) {
+	db, store := openTestBoltStore(t, newTestBoltPath(t))
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, store.Insert(ctx, scim.ResourceAttributes{"id": "0001"}))
+	_, err := store.Find(ctx, "0001")
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	datetime "github.com/di-wu/xsd-datetime"
+)
+
+// formatDateTime returns the string in which the stores of this package keep a date and time. Dates and times are kept
+// in UTC with the precision of seconds, like the dates of the meta data of resources, so that comparing them as strings
+// orders them in time.
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseDateTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return datetime.Parse(value)
+}
+
+// normalizeDateTimes returns the resource of the given resource type with the values of its dateTime attributes
+// formatted by formatDateTime, e.g. "2024-01-01T10:00:00+02:00" becomes "2024-01-01T08:00:00Z". The given resource is
+// not modified.
+func normalizeDateTimes(resourceType scim.ResourceType, resource scim.ResourceAttributes) map[string]interface{} {
+	normalized := normalizeAttributes(resourceType.Schema.Attributes, resource)
+	for _, extension := range resourceType.SchemaExtensions {
+		if values, ok := toMap(resource[extension.Schema.ID]); ok {
+			normalized[extension.Schema.ID] = normalizeAttributes(extension.Schema.Attributes, values)
+		}
+	}
+	return normalized
+}
+
+func normalizeAttributes(attributes []schema.CoreAttribute, values map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		normalized[name] = value
+	}
+	for _, attr := range attributes {
+		if value, ok := values[attr.Name()]; ok {
+			normalized[attr.Name()] = normalizeValue(attr, value)
+		}
+	}
+	return normalized
+}
+
+func normalizeValue(attr schema.CoreAttribute, value interface{}) interface{} {
+	if elements, ok := value.([]interface{}); ok && attr.MultiValued() {
+		normalized := make([]interface{}, len(elements))
+		for i, element := range elements {
+			normalized[i] = normalizeElement(attr, element)
+		}
+		return normalized
+	}
+	return normalizeElement(attr, value)
+}
+
+// normalizeElement normalizes a single value of the attribute. Values that are not valid are returned as is.
+func normalizeElement(attr schema.CoreAttribute, value interface{}) interface{} {
+	switch attr.AttributeType() {
+	case "dateTime":
+		s, ok := value.(string)
+		if !ok {
+			return value
+		}
+		t, err := parseDateTime(s)
+		if err != nil {
+			return value
+		}
+		return formatDateTime(t)
+	case "complex":
+		if values, ok := toMap(value); ok {
+			return normalizeAttributes(attr.SubAttributes(), values)
+		}
+	}
+	return value
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case scim.ResourceAttributes:
+		return m, true
+	default:
+		return nil, false
+	}
+}
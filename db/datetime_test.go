@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDateTimes(t *testing.T) {
+	const extensionID = "urn:example:Device:Warranty"
+	resourceType := scim.ResourceType{
+		Name:     "Device",
+		Endpoint: "/Devices",
+		Schema: schema.Schema{
+			ID: "urn:example:Device",
+			Attributes: []schema.CoreAttribute{
+				schema.SimpleCoreAttribute(schema.SimpleDateTimeParams(schema.DateTimeParams{
+					Name: "installed",
+				})),
+				schema.ComplexCoreAttribute(schema.ComplexParams{
+					Name:        "repairs",
+					MultiValued: true,
+					SubAttributes: []schema.SimpleParams{
+						schema.SimpleDateTimeParams(schema.DateTimeParams{Name: "date"}),
+						schema.SimpleStringParams(schema.StringParams{Name: "note"}),
+					},
+				}),
+			},
+		},
+		SchemaExtensions: []scim.SchemaExtension{{Schema: schema.Schema{
+			ID: extensionID,
+			Attributes: []schema.CoreAttribute{
+				schema.SimpleCoreAttribute(schema.SimpleDateTimeParams(schema.DateTimeParams{
+					Name: "expires",
+				})),
+			},
+		}}},
+	}
+
+	resource := scim.ResourceAttributes{
+		"id":        "0001",
+		"installed": "2024-01-01T10:00:00+02:00",
+		"repairs": []interface{}{
+			map[string]interface{}{"date": "2024-03-01T09:30:00.250-01:00", "note": "2024-03-01T09:30:00Z"},
+		},
+		extensionID: map[string]interface{}{"expires": "2026-01-01T00:00:00Z"},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"id":        "0001",
+		"installed": "2024-01-01T08:00:00Z",
+		"repairs": []interface{}{
+			map[string]interface{}{"date": "2024-03-01T10:30:00Z", "note": "2024-03-01T09:30:00Z"},
+		},
+		extensionID: map[string]interface{}{"expires": "2026-01-01T00:00:00Z"},
+	}, normalizeDateTimes(resourceType, resource))
+
+	// the given resource is not modified
+	assert.Equal(t, "2024-01-01T10:00:00+02:00", resource["installed"])
+	assert.Equal(t, "2024-03-01T09:30:00.250-01:00", resource["repairs"].([]interface{})[0].(map[string]interface{})["date"])
+}
@@ -0,0 +1,376 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Query describes a (paginated) query on the resources of a collection.
+type Query struct {
+	// Filter is the query document the resources need to match.
+	Filter bson.M
+	// Collation is the collation used to compare strings. It is nil when strings are compared byte by byte.
+	Collation *options.Collation
+	// Skip is the number of matching resources to skip.
+	Skip int64
+	// Limit is the maximum number of resources to return. A value of 0 means that there is no limit.
+	Limit int64
+	// Sort is the aggregation expression that computes the value the resources are sorted by, e.g. "$id". It is only
+	// used by queries that return resources.
+	Sort interface{}
+	// SortDescending indicates that the resources are sorted from the highest to the lowest value.
+	SortDescending bool
+	// Reverse reverses the order of the resources, including the order by id of resources with the same value.
+	Reverse bool
+}
+
+// caseInsensitiveCollation compares strings ignoring case, but not diacritics.
+var caseInsensitiveCollation = &options.Collation{
+	Locale:   "en",
+	Strength: 2,
+}
+
+// CompileFilter translates a SCIM filter expression into a query on the resources of the given resource type. The
+// comparisons honor the "caseExact" characteristic of the attributes they are applied to. If all case sensitive
+// comparisons in the filter are on attributes that are not case exact, the query uses a case-insensitive collation so
+// that indexes can be used. Otherwise those comparisons fall back to case-insensitive regular expressions.
+func CompileFilter(expression filter.Expression, resourceType scim.ResourceType) (Query, error) {
+	if expression == nil {
+		return Query{Filter: bson.M{}}, nil
+	}
+
+	c := filterCompiler{resourceType: resourceType}
+	exact, insensitive, err := c.countComparisons(expression, nil)
+	if err != nil {
+		return Query{}, err
+	}
+	c.collation = insensitive > 0 && exact == 0
+
+	query, err := c.compile(expression, nil)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q := Query{Filter: query}
+	if c.collation {
+		q.Collation = caseInsensitiveCollation
+	}
+	return q, nil
+}
+
+type filterCompiler struct {
+	resourceType scim.ResourceType
+	// collation indicates that the query will be executed with the case-insensitive collation.
+	collation bool
+}
+
+// filterField is the resolved target of an attribute path within a filter.
+type filterField struct {
+	// name is the (dotted) name of the field within the stored document.
+	name string
+	// attribute is the definition of the attribute the values of the field are compared against.
+	attribute schema.CoreAttribute
+	// multiValued indicates whether the path crosses a multi-valued attribute.
+	multiValued bool
+}
+
+func (c filterCompiler) resolve(path filter.AttributePath, parent *schema.CoreAttribute) (filterField, error) {
+	invalid := fmt.Errorf("invalid attribute path %q", path)
+
+	var field filterField
+	if parent != nil {
+		sub, ok := parent.SubAttribute(path.AttributeName)
+		if !ok || path.SubAttribute != "" {
+			return filterField{}, invalid
+		}
+		field = filterField{
+			name:        sub.Name(),
+			attribute:   sub,
+			multiValued: sub.MultiValued(),
+		}
+	} else {
+		attr, extensionID, ok := c.resourceType.LookupAttribute(path.AttributeName)
+		if !ok {
+			return filterField{}, invalid
+		}
+		field = filterField{
+			name:        fieldName(extensionID, attr.Name()),
+			attribute:   attr,
+			multiValued: attr.MultiValued(),
+		}
+	}
+
+	if path.SubAttribute != "" {
+		sub, ok := field.attribute.SubAttribute(path.SubAttribute)
+		if !ok {
+			return filterField{}, invalid
+		}
+		field.name += "." + subFieldName(field.attribute, sub)
+		field.attribute = sub
+		field.multiValued = field.multiValued || sub.MultiValued()
+		return field, nil
+	}
+
+	// A complex attribute without a sub-attribute is compared by its "value" sub-attribute, if it has one.
+	if field.attribute.AttributeType() == "complex" {
+		if sub, ok := field.attribute.SubAttribute("value"); ok {
+			field.name += "." + sub.Name()
+			field.attribute = sub
+		}
+	}
+	return field, nil
+}
+
+// fieldName returns the name of the field in which the values of the given attribute are stored.
+func fieldName(extensionID, name string) string {
+	if extensionID == "" {
+		return name
+	}
+	return EscapeKey(extensionID) + "." + name
+}
+
+// subFieldName returns the name of the field in which the values of the given sub-attribute are stored. The sub-
+// attributes of "meta" are stored in lowercase, as they are encoded from a struct.
+func subFieldName(parent, sub schema.CoreAttribute) string {
+	if parent.Name() == schema.CommonAttributeMeta {
+		return strings.ToLower(sub.Name())
+	}
+	return sub.Name()
+}
+
+// countComparisons counts the comparisons of string values that are affected by the collation, split by whether the
+// compared attribute is case exact or not.
+func (c filterCompiler) countComparisons(expression filter.Expression, parent *schema.CoreAttribute) (int, int, error) {
+	switch e := expression.(type) {
+	case filter.AttributeExpression:
+		field, err := c.resolve(e.AttributePath, parent)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !isString(field.attribute) {
+			return 0, 0, nil
+		}
+		switch e.CompareOperator {
+		case filter.PR, filter.CO, filter.SW, filter.EW:
+			return 0, 0, nil
+		}
+		if field.attribute.CaseExact() {
+			return 1, 0, nil
+		}
+		return 0, 1, nil
+	case filter.ValuePath:
+		attr, _, ok := c.resourceType.LookupAttribute(e.AttributeName)
+		if !ok || attr.AttributeType() != "complex" {
+			return 0, 0, fmt.Errorf("invalid value path %q", e.AttributeName)
+		}
+		return c.countComparisons(e.ValueExpression, &attr)
+	case filter.UnaryExpression:
+		return c.countComparisons(e.X, parent)
+	case filter.BinaryExpression:
+		xExact, xInsensitive, err := c.countComparisons(e.X, parent)
+		if err != nil {
+			return 0, 0, err
+		}
+		yExact, yInsensitive, err := c.countComparisons(e.Y, parent)
+		if err != nil {
+			return 0, 0, err
+		}
+		return xExact + yExact, xInsensitive + yInsensitive, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported filter expression %v", expression)
+	}
+}
+
+func (c filterCompiler) compile(expression filter.Expression, parent *schema.CoreAttribute) (bson.M, error) {
+	switch e := expression.(type) {
+	case filter.AttributeExpression:
+		field, err := c.resolve(e.AttributePath, parent)
+		if err != nil {
+			return nil, err
+		}
+		return c.compileComparison(field, e.CompareOperator, e.CompareValue, parent != nil)
+	case filter.ValuePath:
+		attr, extensionID, ok := c.resourceType.LookupAttribute(e.AttributeName)
+		if !ok || attr.AttributeType() != "complex" {
+			return nil, fmt.Errorf("invalid value path %q", e.AttributeName)
+		}
+		inner, err := c.compile(e.ValueExpression, &attr)
+		if err != nil {
+			return nil, err
+		}
+		name := fieldName(extensionID, attr.Name())
+		if !attr.MultiValued() {
+			// The fields of a singular complex attribute are addressed with the dot notation.
+			return prefixFields(name, inner), nil
+		}
+		return bson.M{name: bson.M{"$elemMatch": inner}}, nil
+	case filter.UnaryExpression:
+		x, err := c.compile(e.X, parent)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{x}}, nil
+	case filter.BinaryExpression:
+		x, err := c.compile(e.X, parent)
+		if err != nil {
+			return nil, err
+		}
+		y, err := c.compile(e.Y, parent)
+		if err != nil {
+			return nil, err
+		}
+		if e.CompareOperator == filter.AND {
+			return bson.M{"$and": bson.A{x, y}}, nil
+		}
+		return bson.M{"$or": bson.A{x, y}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported filter expression %v", expression)
+	}
+}
+
+// compileComparison translates a single attribute comparison. The elemMatch flag indicates that the comparison is
+// part of a value path, in which aggregation expressions can not be used.
+func (c filterCompiler) compileComparison(field filterField, operator filter.Token, compareValue string, elemMatch bool) (bson.M, error) {
+	if operator == filter.PR {
+		return bson.M{field.name: bson.M{
+			"$exists": true,
+			"$nin":    bson.A{nil, "", bson.A{}},
+		}}, nil
+	}
+
+	attr := field.attribute
+	switch attr.AttributeType() {
+	case "boolean":
+		b, err := strconv.ParseBool(compareValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean value %q", compareValue)
+		}
+		switch operator {
+		case filter.EQ:
+			return bson.M{field.name: b}, nil
+		case filter.NE:
+			return bson.M{field.name: bson.M{"$ne": b}}, nil
+		}
+		return nil, fmt.Errorf("operator %q not supported on boolean attributes", operator)
+	case "decimal", "integer":
+		f, err := strconv.ParseFloat(compareValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", compareValue)
+		}
+		return orderedComparison(field.name, operator, f)
+	case "dateTime":
+		t, err := parseDateTime(compareValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date time %q", compareValue)
+		}
+		return orderedComparison(field.name, operator, formatDateTime(t))
+	case "complex":
+		return nil, fmt.Errorf("complex attribute %q can not be compared", attr.Name())
+	}
+
+	caseExact := attr.CaseExact()
+	switch operator {
+	case filter.CO:
+		return bson.M{field.name: regex(regexp.QuoteMeta(compareValue), caseExact)}, nil
+	case filter.SW:
+		return bson.M{field.name: regex("^"+regexp.QuoteMeta(compareValue), caseExact)}, nil
+	case filter.EW:
+		return bson.M{field.name: regex(regexp.QuoteMeta(compareValue)+"$", caseExact)}, nil
+	}
+
+	if caseExact || c.collation {
+		return orderedComparison(field.name, operator, compareValue)
+	}
+
+	// The attribute is not case exact, but the query is executed without the case-insensitive collation.
+	switch operator {
+	case filter.EQ:
+		return bson.M{field.name: regex("^"+regexp.QuoteMeta(compareValue)+"$", false)}, nil
+	case filter.NE:
+		return bson.M{field.name: bson.M{"$not": regex("^"+regexp.QuoteMeta(compareValue)+"$", false)}}, nil
+	}
+	if elemMatch || field.multiValued {
+		return orderedComparison(field.name, operator, compareValue)
+	}
+	op, err := comparisonOperator(operator)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$expr": bson.M{op: bson.A{
+		bson.M{"$toLower": "$" + field.name},
+		strings.ToLower(compareValue),
+	}}}, nil
+}
+
+func orderedComparison(name string, operator filter.Token, value interface{}) (bson.M, error) {
+	if operator == filter.EQ {
+		return bson.M{name: value}, nil
+	}
+	op, err := comparisonOperator(operator)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{name: bson.M{op: value}}, nil
+}
+
+func comparisonOperator(operator filter.Token) (string, error) {
+	switch operator {
+	case filter.EQ:
+		return "$eq", nil
+	case filter.NE:
+		return "$ne", nil
+	case filter.GT:
+		return "$gt", nil
+	case filter.GE:
+		return "$gte", nil
+	case filter.LT:
+		return "$lt", nil
+	case filter.LE:
+		return "$lte", nil
+	default:
+		return "", fmt.Errorf("unsupported operator %q", operator)
+	}
+}
+
+func regex(pattern string, caseExact bool) primitive.Regex {
+	if caseExact {
+		return primitive.Regex{Pattern: pattern}
+	}
+	return primitive.Regex{Pattern: pattern, Options: "i"}
+}
+
+// prefixFields prefixes all the field names in given query document with the given name.
+func prefixFields(name string, query bson.M) bson.M {
+	prefixed := bson.M{}
+	for k, v := range query {
+		switch k {
+		case "$and", "$or", "$nor":
+			var conditions bson.A
+			for _, condition := range v.(bson.A) {
+				conditions = append(conditions, prefixFields(name, condition.(bson.M)))
+			}
+			prefixed[k] = conditions
+		default:
+			prefixed[name+"."+k] = v
+		}
+	}
+	return prefixed
+}
+
+func isString(attr schema.CoreAttribute) bool {
+	switch attr.AttributeType() {
+	case "string", "reference", "binary":
+		return true
+	default:
+		return false
+	}
+}
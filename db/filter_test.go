@@ -0,0 +1,141 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testResourceType = scim.ResourceType{
+	Name:     "User",
+	Endpoint: "/Users",
+	Schema:   schema.CoreUserSchema(),
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		query     bson.M
+		collation bool
+	}{
+		{
+			filter:    `userName eq "bjensen"`,
+			query:     bson.M{"userName": "bjensen"},
+			collation: true,
+		},
+		{
+			filter: `id eq "2819c223"`,
+			query:  bson.M{"id": "2819c223"},
+		},
+		{
+			filter: `userName eq "bjensen" and externalId eq "ext-1"`,
+			query: bson.M{"$and": bson.A{
+				bson.M{"userName": primitive.Regex{Pattern: "^bjensen$", Options: "i"}},
+				bson.M{"externalId": "ext-1"},
+			}},
+		},
+		{
+			filter: `name.familyName co "O'Malley"`,
+			query:  bson.M{"name.familyName": primitive.Regex{Pattern: "O'Malley", Options: "i"}},
+		},
+		{
+			filter: `userName sw "j.d"`,
+			query:  bson.M{"userName": primitive.Regex{Pattern: `^j\.d`, Options: "i"}},
+		},
+		{
+			filter: `externalId ew "(1)"`,
+			query:  bson.M{"externalId": primitive.Regex{Pattern: `\(1\)$`}},
+		},
+		{
+			filter: `title pr`,
+			query: bson.M{"title": bson.M{
+				"$exists": true,
+				"$nin":    bson.A{nil, "", bson.A{}},
+			}},
+		},
+		{
+			filter: `meta.lastModified gt "2011-05-13T04:42:34Z"`,
+			query:  bson.M{"meta.lastmodified": bson.M{"$gt": "2011-05-13T04:42:34Z"}},
+		},
+		{
+			filter: `active eq "true"`,
+			query:  bson.M{"active": true},
+		},
+		{
+			filter:    `emails co "example.com"`,
+			query:     bson.M{"emails.value": primitive.Regex{Pattern: `example\.com`, Options: "i"}},
+			collation: false,
+		},
+		{
+			filter: `emails[type eq "work" and value co "@example.com"]`,
+			query: bson.M{"emails": bson.M{"$elemMatch": bson.M{"$and": bson.A{
+				bson.M{"type": "work"},
+				bson.M{"value": primitive.Regex{Pattern: `@example\.com`, Options: "i"}},
+			}}}},
+			collation: true,
+		},
+		{
+			filter:    `not (userName eq "bjensen")`,
+			query:     bson.M{"$nor": bson.A{bson.M{"userName": "bjensen"}}},
+			collation: true,
+		},
+		{
+			filter: `userName gt "a" or id eq "1"`,
+			query: bson.M{"$or": bson.A{
+				bson.M{"$expr": bson.M{"$gt": bson.A{bson.M{"$toLower": "$userName"}, "a"}}},
+				bson.M{"id": "1"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.filter, func(t *testing.T) {
+			expression, err := filter.NewParser(strings.NewReader(tt.filter)).Parse()
+			assert.NoError(t, err, "filter parsing failed")
+
+			query, err := CompileFilter(expression, testResourceType)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.query, query.Filter)
+			assert.Equal(t, tt.collation, query.Collation != nil, "collation mismatch")
+		})
+	}
+}
+
+func TestCompileFilterExtension(t *testing.T) {
+	resourceType := testResourceType
+	resourceType.SchemaExtensions = []scim.SchemaExtension{{Schema: schema.ExtensionEnterpriseUser()}}
+
+	expression, err := filter.NewParser(strings.NewReader(
+		`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "26118915"`,
+	)).Parse()
+	assert.NoError(t, err, "filter parsing failed")
+
+	query, err := CompileFilter(expression, resourceType)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{
+		"urn:ietf:params:scim:schemas:extension:enterprise:2．0:User.manager.value": "26118915",
+	}, query.Filter)
+}
+
+func TestCompileFilterInvalid(t *testing.T) {
+	for _, f := range []string{
+		`unknown eq "x"`,
+		`active gt "true"`,
+		`meta.created gt "yesterday"`,
+		`emails[unknown eq "x"]`,
+	} {
+		expression, err := filter.NewParser(strings.NewReader(f)).Parse()
+		assert.NoError(t, err, "filter parsing failed")
+
+		_, err = CompileFilter(expression, testResourceType)
+		assert.Error(t, err, f)
+	}
+}
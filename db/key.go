@@ -0,0 +1,56 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// escapedDot replaces the dots in the keys of stored documents. MongoDB interprets dots in field names as paths into
+// embedded documents, while the keys of the attributes of schema extensions are URIs that contain dots, e.g.
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User".
+const escapedDot = "．"
+
+// EscapeKey returns the field name under which the value of the given key is stored.
+func EscapeKey(key string) string {
+	return strings.ReplaceAll(key, ".", escapedDot)
+}
+
+// UnescapeKey returns the key of the value that is stored under the given field name.
+func UnescapeKey(name string) string {
+	return strings.ReplaceAll(name, escapedDot, ".")
+}
+
+// escapeDocument escapes the top-level keys of a document before it is stored. Documents of other types are returned
+// as is.
+func escapeDocument(document interface{}) interface{} {
+	var m map[string]interface{}
+	switch d := document.(type) {
+	case scim.ResourceAttributes:
+		m = d
+	case bson.M:
+		m = d
+	case map[string]interface{}:
+		m = d
+	default:
+		return document
+	}
+
+	escaped := make(bson.M, len(m))
+	for k, v := range m {
+		escaped[EscapeKey(k)] = v
+	}
+	return escaped
+}
+
+// unescapeDocument restores the top-level keys of a stored document.
+func unescapeDocument(document bson.M) bson.M {
+	for k, v := range document {
+		if key := UnescapeKey(k); key != k {
+			delete(document, k)
+			document[key] = v
+		}
+	}
+	return document
+}
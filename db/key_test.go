@@ -0,0 +1,29 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeDocument(t *testing.T) {
+	const extensionID = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	escaped := escapeDocument(scim.ResourceAttributes{
+		"userName":  "bjensen",
+		extensionID: map[string]interface{}{"department": "Tour Operations"},
+	})
+	assert.Equal(t, bson.M{
+		"userName": "bjensen",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2．0:User": map[string]interface{}{
+			"department": "Tour Operations",
+		},
+	}, escaped)
+
+	unescaped := unescapeDocument(escaped.(bson.M))
+	assert.Contains(t, unescaped, extensionID)
+	assert.Contains(t, unescaped, "userName")
+	assert.Len(t, unescaped, 2)
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"errors"
 
+	"github.com/dgbttn/go-scim-server/scim"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -11,63 +13,216 @@ import (
 
 // IMongoDB ...
 type IMongoDB interface {
-	GetClient() *mongo.Client
-	ConnectDB(connectionString string, database string, collection string) error
-	Insert(document interface{}) error
-	Find(id string) (bson.M, error)
-	GetAll() ([]bson.M, error)
-	Delete(id string) error
+	ConnectDB(ctx context.Context, connectionString string, database string, collection string) error
+	Collection(name string) IMongoDB
+	CreateUniqueIndexes(ctx context.Context, attributes []scim.UniqueAttribute) error
+	Insert(ctx context.Context, document interface{}) error
+	Find(ctx context.Context, id string) (bson.M, error)
+	Query(ctx context.Context, query Query) ([]bson.M, error)
+	Count(ctx context.Context, query Query) (int64, error)
+	Replace(ctx context.Context, id string, document interface{}, version string) error
+	Delete(ctx context.Context, id string, version string) error
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ErrNoMatch is returned when a document is replaced or deleted, but there is no document with the given id, or the
+// version of the document does not match the given version.
+var ErrNoMatch = errors.New("db: no document matches the id and version")
+
+// documentFilter returns the filter that matches the document with the given id, and the given version if it is not
+// empty.
+func documentFilter(id string, version string) bson.M {
+	filter := bson.M{"id": id}
+	if version != "" {
+		filter["meta.version"] = version
+	}
+	return filter
 }
 
 type mongoDB struct {
 	client     *mongo.Client
+	database   *mongo.Database
 	collection *mongo.Collection
+	// transactions indicates whether the server supports transactions.
+	transactions bool
 }
 
-func (db *mongoDB) GetClient() *mongo.Client {
-	return db.client
-}
-
-func (db *mongoDB) ConnectDB(connectionStr string, databaseStr string, collectionStr string) error {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(connectionStr))
+func (db *mongoDB) ConnectDB(ctx context.Context, connectionStr string, databaseStr string, collectionStr string) error {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionStr))
 	if err != nil {
 		return err
 	}
-	if err = client.Ping(context.TODO(), readpref.Primary()); err != nil {
+	if err = client.Ping(ctx, readpref.Primary()); err != nil {
 		return err
 	}
-	collection := client.Database(databaseStr).Collection(collectionStr)
+	transactions, err := supportsTransactions(ctx, client)
+	if err != nil {
+		return err
+	}
+	database := client.Database(databaseStr)
 	db.client = client
-	db.collection = collection
+	db.transactions = transactions
+	db.database = database
+	db.collection = database.Collection(collectionStr)
 	return nil
 }
 
-func (db *mongoDB) Insert(document interface{}) error {
-	_, err := db.collection.InsertOne(context.TODO(), document)
+// Collection returns the collection with the given name, in the same database as the connected collection.
+func (db *mongoDB) Collection(name string) IMongoDB {
+	return &mongoDB{
+		client:       db.client,
+		database:     db.database,
+		collection:   db.database.Collection(name),
+		transactions: db.transactions,
+	}
+}
+
+// CreateUniqueIndexes creates the indexes that enforce the uniqueness of the given attributes, so that concurrent
+// writes can not store duplicate values. Existing indexes are left as is.
+func (db *mongoDB) CreateUniqueIndexes(ctx context.Context, attributes []scim.UniqueAttribute) error {
+	if len(attributes) == 0 {
+		return nil
+	}
+	_, err := db.collection.Indexes().CreateMany(ctx, uniqueIndexes(attributes))
 	return err
 }
 
-func (db *mongoDB) Find(id string) (result bson.M, erro error) {
-	erro = db.collection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&result)
+func (db *mongoDB) Insert(ctx context.Context, document interface{}) error {
+	_, err := db.collection.InsertOne(ctx, escapeDocument(document))
+	return writeError(err)
+}
+
+func (db *mongoDB) Find(ctx context.Context, id string) (result bson.M, erro error) {
+	erro = db.collection.FindOne(ctx, bson.M{"id": id}).Decode(&result)
 	if erro == mongo.ErrNoDocuments {
 		erro = nil
 	}
+	if result != nil {
+		unescapeDocument(result)
+	}
 	return
 }
 
-func (db *mongoDB) GetAll() (results []bson.M, erro error) {
-	cursor, erro := db.collection.Find(context.TODO(), bson.D{}, options.Find())
+// Query returns the documents that match the query, in the order of its sort value. Resources without a sort value are
+// sorted last in ascending order, and first in descending order. Resources with the same sort value are ordered by their
+// id, so that pages are stable. A reversed query returns the resources in the exact opposite order.
+func (db *mongoDB) Query(ctx context.Context, query Query) (results []bson.M, erro error) {
+	direction, idDirection := 1, 1
+	if query.SortDescending {
+		direction = -1
+	}
+	if query.Reverse {
+		direction, idDirection = -direction, -idDirection
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: query.Filter}},
+		{{Key: "$addFields", Value: bson.M{"_sortKey": query.Sort}}},
+		{{Key: "$addFields", Value: bson.M{"_sortMissing": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{bson.M{"$type": "$_sortKey"}, bson.A{"missing", "null"}}}, 1, 0,
+		}}}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "_sortMissing", Value: direction},
+			{Key: "_sortKey", Value: direction},
+			{Key: "id", Value: idDirection},
+		}}},
+	}
+	if query.Skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: query.Skip}})
+	}
+	if query.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.M{"_sortKey": 0, "_sortMissing": 0}}})
+
+	opts := options.Aggregate()
+	if query.Collation != nil {
+		opts.SetCollation(query.Collation)
+	}
+	cursor, erro := db.collection.Aggregate(ctx, pipeline, opts)
 	if erro != nil {
+		return
+	}
+	erro = cursor.All(ctx, &results)
+	for _, result := range results {
+		unescapeDocument(result)
 	}
-	erro = cursor.All(context.TODO(), &results)
 	return
 }
 
-func (db *mongoDB) Delete(id string) error {
-	_, err := db.collection.DeleteOne(context.TODO(), bson.M{"id": id})
+func (db *mongoDB) Count(ctx context.Context, query Query) (int64, error) {
+	opts := options.Count()
+	if query.Collation != nil {
+		opts.SetCollation(query.Collation)
+	}
+	return db.collection.CountDocuments(ctx, query.Filter, opts)
+}
+
+// Replace atomically replaces the document with the given id. If the version is not empty, the document is only
+// replaced if it has that version.
+func (db *mongoDB) Replace(ctx context.Context, id string, document interface{}, version string) error {
+	result, err := db.collection.ReplaceOne(ctx, documentFilter(id, version), escapeDocument(document))
+	if err != nil {
+		return writeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNoMatch
+	}
+	return nil
+}
+
+// Delete removes the document with the given id. If the version is not empty, the document is only removed if it has
+// that version.
+func (db *mongoDB) Delete(ctx context.Context, id string, version string) error {
+	result, err := db.collection.DeleteOne(ctx, documentFilter(id, version))
+	if err != nil {
+		return err
+	}
+	if version != "" && result.DeletedCount == 0 {
+		return ErrNoMatch
+	}
+	return nil
+}
+
+// Transaction calls fn within a transaction of the client of the collection, which can span multiple collections. The
+// operations of fn have to use the context it is given to be part of the transaction. Standalone servers do not support
+// transactions, in which case fn is called without a transaction.
+func (db *mongoDB) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(mongoTransaction{}) == db.client || !db.transactions {
+		// nested transactions are part of the transaction in progress
+		return fn(ctx)
+	}
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// The session is looked up by the operations through the values of the context, so that it is also found in
+		// the contexts derived from it, e.g. to time out an operation.
+		return nil, fn(context.WithValue(sc, mongoTransaction{}, db.client))
+	})
 	return err
 }
 
+// mongoTransaction is the key of the context value that holds the client of which a transaction is in progress.
+type mongoTransaction struct{}
+
+// supportsTransactions returns whether the server is a member of a replica set or a router of a sharded cluster, which
+// are the deployments that support transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var result struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.SetName != "" || result.Msg == "isdbgrid", nil
+}
+
 var (
 	// MongoDB ...
 	MongoDB IMongoDB = &mongoDB{}
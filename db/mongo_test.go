@@ -0,0 +1,13 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDocumentFilter(t *testing.T) {
+	assert.Equal(t, bson.M{"id": "0001"}, documentFilter("0001", ""))
+	assert.Equal(t, bson.M{"id": "0001", "meta.version": `W/"2"`}, documentFilter("0001", `W/"2"`))
+}
@@ -0,0 +1,439 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	"github.com/lib/pq"
+)
+
+// CompileSQLFilter translates a SCIM filter expression into the condition of a WHERE clause on the resources table.
+// The values of the filter are passed as arguments, which are appended to the given arguments so that the placeholders
+// of the condition follow those of the rest of the statement. The comparisons honor the "caseExact" characteristic of
+// the attributes they are applied to, and comparisons on id, externalId, userName and meta.lastModified use the
+// generated columns.
+func CompileSQLFilter(expression filter.Expression, resourceType scim.ResourceType, args []interface{}) (string, []interface{}, error) {
+	if expression == nil {
+		return "TRUE", args, nil
+	}
+
+	c := sqlCompiler{resourceType: resourceType, args: args}
+	condition, err := c.compile(expression, nil, "document")
+	if err != nil {
+		return "", nil, err
+	}
+	return condition, c.args, nil
+}
+
+type sqlCompiler struct {
+	resourceType scim.ResourceType
+	// args are the arguments of the placeholders in the compiled condition.
+	args []interface{}
+	// aliases is the number of aliases given to the elements of multi-valued attributes.
+	aliases int
+}
+
+// arg adds an argument and returns its placeholder.
+func (c *sqlCompiler) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	return "$" + strconv.Itoa(len(c.args))
+}
+
+// alias returns a new alias for the elements of a multi-valued attribute.
+func (c *sqlCompiler) alias() string {
+	c.aliases++
+	return "e" + strconv.Itoa(c.aliases)
+}
+
+// sqlField is the resolved target of an attribute path within a filter.
+type sqlField struct {
+	// column is the generated column that holds the value, if any.
+	column string
+	// array is the path to the multi-valued attribute of which the elements hold the values. It is nil if the path
+	// does not cross a multi-valued attribute.
+	array []string
+	// path is the path to the value within the document, or within the elements of the array.
+	path []string
+	// attribute is the definition of the attribute the values are compared against.
+	attribute schema.CoreAttribute
+}
+
+// generatedColumns are the generated columns of the resources table by the attribute path of their value.
+var generatedColumns = map[string]string{
+	schema.CommonAttributeID:                     "id",
+	schema.CommonAttributeExternalID:             "external_id",
+	"userName":                                   "user_name",
+	schema.CommonAttributeMeta + ".lastModified": "last_modified",
+}
+
+func (c *sqlCompiler) resolve(path filter.AttributePath, parent *schema.CoreAttribute) (sqlField, error) {
+	invalid := fmt.Errorf("invalid attribute path %q", path)
+
+	if parent != nil {
+		sub, ok := parent.SubAttribute(path.AttributeName)
+		if !ok || path.SubAttribute != "" {
+			return sqlField{}, invalid
+		}
+		if sub.MultiValued() {
+			return sqlField{array: []string{sub.Name()}, attribute: sub}, nil
+		}
+		return sqlField{path: []string{sub.Name()}, attribute: sub}, nil
+	}
+
+	attr, extensionID, ok := c.resourceType.LookupAttribute(path.AttributeName)
+	if !ok {
+		return sqlField{}, invalid
+	}
+	keys := fieldKeys(extensionID, attr.Name())
+
+	var sub *schema.CoreAttribute
+	if path.SubAttribute != "" {
+		s, ok := attr.SubAttribute(path.SubAttribute)
+		if !ok {
+			return sqlField{}, invalid
+		}
+		sub = &s
+	} else if attr.AttributeType() == "complex" {
+		// A complex attribute without a sub-attribute is compared by its "value" sub-attribute, if it has one.
+		if s, ok := attr.SubAttribute("value"); ok {
+			sub = &s
+		}
+	}
+
+	field := fieldPath(keys, attr, sub)
+	if extensionID == "" && field.array == nil {
+		field.column = generatedColumns[strings.Join(field.path, ".")]
+	}
+	return field, nil
+}
+
+// fieldKeys returns the keys of the path to the values of the given attribute within a document.
+func fieldKeys(extensionID, name string) []string {
+	if extensionID == "" {
+		return []string{name}
+	}
+	return []string{extensionID, name}
+}
+
+// fieldPath returns the field of the values of the attribute, or of its sub-attribute if it is not nil, which is found
+// at the given keys.
+func fieldPath(keys []string, attr schema.CoreAttribute, sub *schema.CoreAttribute) sqlField {
+	switch {
+	case sub == nil && attr.MultiValued():
+		return sqlField{array: keys, attribute: attr}
+	case sub == nil:
+		return sqlField{path: keys, attribute: attr}
+	case attr.MultiValued():
+		return sqlField{array: keys, path: []string{sub.Name()}, attribute: *sub}
+	case sub.MultiValued():
+		return sqlField{array: append(keys, sub.Name()), attribute: *sub}
+	default:
+		return sqlField{path: append(keys, sub.Name()), attribute: *sub}
+	}
+}
+
+// compile translates the expression into a condition on the JSONB value of the base expression, which is either the
+// document of a resource or (an element of) the complex attribute of a value path.
+func (c *sqlCompiler) compile(expression filter.Expression, parent *schema.CoreAttribute, base string) (string, error) {
+	switch e := expression.(type) {
+	case filter.AttributeExpression:
+		field, err := c.resolve(e.AttributePath, parent)
+		if err != nil {
+			return "", err
+		}
+		return c.compileComparison(field, base, e.CompareOperator, e.CompareValue)
+	case filter.ValuePath:
+		attr, extensionID, ok := c.resourceType.LookupAttribute(e.AttributeName)
+		if !ok || attr.AttributeType() != "complex" {
+			return "", fmt.Errorf("invalid value path %q", e.AttributeName)
+		}
+		value := jsonbPath(base, fieldKeys(extensionID, attr.Name()))
+		if !attr.MultiValued() {
+			return c.compile(e.ValueExpression, &attr, "("+value+")")
+		}
+		alias := c.alias()
+		inner, err := c.compile(e.ValueExpression, &attr, alias+".value")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements(%s) AS %s(value) WHERE %s)",
+			jsonbArray(value), alias, inner), nil
+	case filter.UnaryExpression:
+		x, err := c.compile(e.X, parent, base)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT COALESCE(%s, FALSE)", x), nil
+	case filter.BinaryExpression:
+		x, err := c.compile(e.X, parent, base)
+		if err != nil {
+			return "", err
+		}
+		y, err := c.compile(e.Y, parent, base)
+		if err != nil {
+			return "", err
+		}
+		if e.CompareOperator == filter.AND {
+			return fmt.Sprintf("(%s AND %s)", x, y), nil
+		}
+		return fmt.Sprintf("(%s OR %s)", x, y), nil
+	default:
+		return "", fmt.Errorf("unsupported filter expression %v", expression)
+	}
+}
+
+// compileComparison translates a single attribute comparison. Attributes that are not equal to a value, either because
+// they have another value or because they have no value at all, match the "ne" operator. Multi-valued attributes match
+// it if none of their values is equal.
+func (c *sqlCompiler) compileComparison(field sqlField, base string, operator filter.Token, compareValue string) (string, error) {
+	comparisonOperator := operator
+	if operator == filter.NE {
+		comparisonOperator = filter.EQ
+	}
+
+	if field.array != nil {
+		alias := c.alias()
+		condition, err := c.compileValueComparison(field.attribute, "", alias+".value", field.path, comparisonOperator, compareValue)
+		if err != nil {
+			return "", err
+		}
+		exists := fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements(%s) AS %s(value) WHERE %s)",
+			jsonbArray(jsonbPath(base, field.array)), alias, condition)
+		if operator == filter.NE {
+			return "NOT " + exists, nil
+		}
+		return exists, nil
+	}
+
+	condition, err := c.compileValueComparison(field.attribute, field.column, base, field.path, comparisonOperator, compareValue)
+	if err != nil {
+		return "", err
+	}
+	if operator == filter.NE {
+		return fmt.Sprintf("NOT COALESCE(%s, FALSE)", condition), nil
+	}
+	return condition, nil
+}
+
+// compileValueComparison compares the value at the path within the base expression, or the value of the generated
+// column if it is not empty.
+func (c *sqlCompiler) compileValueComparison(attr schema.CoreAttribute, column, base string, path []string, operator filter.Token, compareValue string) (string, error) {
+	value, text := jsonbPath(base, path), textPath(base, path)
+	if column != "" {
+		text = column
+	}
+
+	if operator == filter.PR {
+		if column != "" {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", column, column), nil
+		}
+		return fmt.Sprintf(`(%s IS NOT NULL AND %s NOT IN ('null', '""', '[]'))`, value, value), nil
+	}
+
+	switch attr.AttributeType() {
+	case "boolean":
+		b, err := strconv.ParseBool(compareValue)
+		if err != nil {
+			return "", fmt.Errorf("invalid boolean value %q", compareValue)
+		}
+		if operator != filter.EQ {
+			return "", fmt.Errorf("operator %q not supported on boolean attributes", operator)
+		}
+		return fmt.Sprintf("%s = %s::jsonb", value, c.arg(strconv.FormatBool(b))), nil
+	case "decimal", "integer":
+		f, err := strconv.ParseFloat(compareValue, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", compareValue)
+		}
+		op, err := sqlOperator(operator)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'number' THEN (%s)::numeric END) %s %s::numeric",
+			value, text, op, c.arg(f)), nil
+	case "dateTime":
+		t, err := parseDateTime(compareValue)
+		if err != nil {
+			return "", fmt.Errorf("invalid date time %q", compareValue)
+		}
+		op, err := sqlOperator(operator)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", text, op, c.arg(formatDateTime(t))), nil
+	case "complex":
+		return "", fmt.Errorf("complex attribute %q can not be compared", attr.Name())
+	}
+
+	like := "ILIKE"
+	if attr.CaseExact() {
+		like = "LIKE"
+	}
+	switch operator {
+	case filter.CO:
+		return fmt.Sprintf("%s %s %s", text, like, c.arg("%"+escapeLike(compareValue)+"%")), nil
+	case filter.SW:
+		return fmt.Sprintf("%s %s %s", text, like, c.arg(escapeLike(compareValue)+"%")), nil
+	case filter.EW:
+		return fmt.Sprintf("%s %s %s", text, like, c.arg("%"+escapeLike(compareValue))), nil
+	}
+
+	op, err := sqlOperator(operator)
+	if err != nil {
+		return "", err
+	}
+	if attr.CaseExact() {
+		return fmt.Sprintf("%s %s %s", text, op, c.arg(compareValue)), nil
+	}
+	return fmt.Sprintf("lower(%s) %s lower(%s)", text, op, c.arg(compareValue)), nil
+}
+
+func sqlOperator(operator filter.Token) (string, error) {
+	switch operator {
+	case filter.EQ:
+		return "=", nil
+	case filter.GT:
+		return ">", nil
+	case filter.GE:
+		return ">=", nil
+	case filter.LT:
+		return "<", nil
+	case filter.LE:
+		return "<=", nil
+	default:
+		return "", fmt.Errorf("unsupported operator %q", operator)
+	}
+}
+
+// CompileSQLSort translates a "sortBy" attribute path into the SQL expression that computes the value a resource of
+// the given resource type is sorted by. Multi-valued attributes are sorted by their primary value, or their first value
+// if none of the values is primary. Strings that are not case exact are sorted case-insensitively.
+func CompileSQLSort(sortBy string, resourceType scim.ResourceType) (string, error) {
+	attr, sub, extensionID, ok := resourceType.LookupAttributePath(sortBy)
+	if !ok {
+		return "", fmt.Errorf("invalid sort attribute %q", sortBy)
+	}
+
+	keys := fieldKeys(extensionID, attr.Name())
+	leaf := attr
+	var subName string
+	switch {
+	case sub != nil:
+		leaf, subName = *sub, sub.Name()
+	case attr.AttributeType() == "complex":
+		value, ok := attr.SubAttribute("value")
+		if !ok {
+			return "", fmt.Errorf("complex attribute %q can not be sorted by", attr.Name())
+		}
+		leaf, subName = value, value.Name()
+	}
+
+	var value, text string
+	switch {
+	case attr.MultiValued() && subName != "":
+		primary := fmt.Sprintf("(SELECT s.value FROM jsonb_array_elements(%s) AS s(value) WHERE s.value->'primary' = 'true' LIMIT 1)",
+			jsonbArray(jsonbPath("document", keys)))
+		first := append(keys, "0", subName)
+		value = fmt.Sprintf("COALESCE(%s, %s)", jsonbPath(primary, []string{subName}), jsonbPath("document", first))
+		text = fmt.Sprintf("COALESCE(%s, %s)", textPath(primary, []string{subName}), textPath("document", first))
+	case attr.MultiValued():
+		value, text = jsonbPath("document", append(keys, "0")), textPath("document", append(keys, "0"))
+	default:
+		if subName != "" {
+			keys = append(keys, subName)
+		}
+		value, text = jsonbPath("document", keys), textPath("document", keys)
+		if column, ok := generatedColumns[strings.Join(keys, ".")]; ok && extensionID == "" {
+			text = column
+		}
+	}
+
+	switch {
+	case leaf.AttributeType() == "dateTime":
+		return text, nil
+	case isString(leaf) && leaf.CaseExact():
+		return text, nil
+	case isString(leaf):
+		return "lower(" + text + ")", nil
+	default:
+		// JSONB numbers are ordered numerically and false is ordered before true.
+		return value, nil
+	}
+}
+
+// CompileSQLUnique returns the condition that matches the resources that have one of the given values of the unique
+// attribute. The values are appended to the given arguments. Values of attributes that are not case exact are compared
+// case-insensitively, in the same way as the unique indexes of the attributes do.
+func CompileSQLUnique(attribute scim.UniqueAttribute, values []interface{}, args []interface{}) (string, []interface{}, error) {
+	if len(values) == 0 {
+		return "FALSE", args, nil
+	}
+
+	c := sqlCompiler{args: args}
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = c.arg(fmt.Sprint(value))
+		if !attribute.CaseExact() {
+			placeholders[i] = "lower(" + placeholders[i] + ")"
+		}
+	}
+	in := strings.Join(placeholders, ", ")
+
+	field := sqlUniqueField(attribute)
+	if field.array == nil {
+		return fmt.Sprintf("%s IN (%s)", uniqueExpression("document", attribute), in), c.args, nil
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements(%s) AS u(value) WHERE %s IN (%s))",
+		jsonbArray(jsonbPath("document", field.array)), uniqueExpression("u.value", attribute), in), c.args, nil
+}
+
+// sqlUniqueField returns the field of the values of the unique attribute.
+func sqlUniqueField(attribute scim.UniqueAttribute) sqlField {
+	return fieldPath(fieldKeys(attribute.SchemaID, attribute.Attribute.Name()), attribute.Attribute, attribute.SubAttribute)
+}
+
+// uniqueExpression returns the expression that computes the value of the unique attribute within the base expression,
+// which is either the document of a resource or an element of the multi-valued attribute of the unique values.
+func uniqueExpression(base string, attribute scim.UniqueAttribute) string {
+	value := textPath(base, sqlUniqueField(attribute).path)
+	if !attribute.CaseExact() {
+		return "lower(" + value + ")"
+	}
+	return value
+}
+
+// jsonbPath returns the expression that extracts the JSONB value at the path within the base expression.
+func jsonbPath(base string, path []string) string {
+	if len(path) == 0 {
+		return base
+	}
+	return base + " #> " + textArray(path)
+}
+
+// textPath returns the expression that extracts the value at the path within the base expression as text.
+func textPath(base string, path []string) string {
+	return base + " #>> " + textArray(path)
+}
+
+// jsonbArray returns the expression of the given JSONB value if it is an array, or an empty array otherwise.
+func jsonbArray(value string) string {
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(%s) = 'array' THEN %s ELSE '[]'::jsonb END", value, value)
+}
+
+// textArray returns the literal of a text array with the given elements.
+func textArray(elements []string) string {
+	quoted := make([]string, len(elements))
+	for i, e := range elements {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(e) + `"`
+	}
+	return pq.QuoteLiteral("{" + strings.Join(quoted, ",") + "}")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const emailsArray = `CASE WHEN jsonb_typeof(document #> '{"emails"}') = 'array' THEN document #> '{"emails"}' ELSE '[]'::jsonb END`
+
+func TestCompileSQLFilter(t *testing.T) {
+	tests := []struct {
+		filter    string
+		condition string
+		args      []interface{}
+	}{
+		{
+			filter:    `userName eq "bjensen"`,
+			condition: `lower(user_name) = lower($2)`,
+			args:      []interface{}{"bjensen"},
+		},
+		{
+			filter:    `id eq "2819c223" and externalId ne "ext-1"`,
+			condition: `(id = $2 AND NOT COALESCE(external_id = $3, FALSE))`,
+			args:      []interface{}{"2819c223", "ext-1"},
+		},
+		{
+			filter:    `name.familyName co "O'Malley_%"`,
+			condition: `document #>> '{"name","familyName"}' ILIKE $2`,
+			args:      []interface{}{`%O'Malley\_\%%`},
+		},
+		{
+			filter:    `externalId sw "ext"`,
+			condition: `external_id LIKE $2`,
+			args:      []interface{}{"ext%"},
+		},
+		{
+			filter:    `title pr`,
+			condition: `(document #> '{"title"}' IS NOT NULL AND document #> '{"title"}' NOT IN ('null', '""', '[]'))`,
+		},
+		{
+			filter:    `meta.lastModified gt "2011-05-13T06:42:34+02:00"`,
+			condition: `last_modified > $2`,
+			args:      []interface{}{"2011-05-13T04:42:34Z"},
+		},
+		{
+			filter:    `active eq "true" or not (userName gt "m")`,
+			condition: `(document #> '{"active"}' = $2::jsonb OR NOT COALESCE(lower(user_name) > lower($3), FALSE))`,
+			args:      []interface{}{"true", "m"},
+		},
+		{
+			filter:    `emails co "example.com"`,
+			condition: `EXISTS (SELECT 1 FROM jsonb_array_elements(` + emailsArray + `) AS e1(value) WHERE e1.value #>> '{"value"}' ILIKE $2)`,
+			args:      []interface{}{"%example.com%"},
+		},
+		{
+			filter:    `emails.type ne "work"`,
+			condition: `NOT EXISTS (SELECT 1 FROM jsonb_array_elements(` + emailsArray + `) AS e1(value) WHERE lower(e1.value #>> '{"type"}') = lower($2))`,
+			args:      []interface{}{"work"},
+		},
+		{
+			filter: `emails[type eq "work" and value co "@example.com"]`,
+			condition: `EXISTS (SELECT 1 FROM jsonb_array_elements(` + emailsArray + `) AS e1(value) WHERE ` +
+				`(lower(e1.value #>> '{"type"}') = lower($2) AND e1.value #>> '{"value"}' ILIKE $3))`,
+			args: []interface{}{"work", "%@example.com%"},
+		},
+		{
+			filter:    `name[givenName eq "Barbara"]`,
+			condition: `lower((document #> '{"name"}') #>> '{"givenName"}') = lower($2)`,
+			args:      []interface{}{"Barbara"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.filter, func(t *testing.T) {
+			expression, err := filter.NewParser(strings.NewReader(tt.filter)).Parse()
+			assert.NoError(t, err, "filter parsing failed")
+
+			condition, args, err := CompileSQLFilter(expression, testResourceType, []interface{}{"users"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.condition, condition)
+			assert.Equal(t, append([]interface{}{"users"}, tt.args...), args)
+		})
+	}
+}
+
+func TestCompileSQLFilterExtension(t *testing.T) {
+	resourceType := testResourceType
+	resourceType.SchemaExtensions = []scim.SchemaExtension{{Schema: schema.ExtensionEnterpriseUser()}}
+
+	expression, err := filter.NewParser(strings.NewReader(
+		`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "26118915"`,
+	)).Parse()
+	assert.NoError(t, err, "filter parsing failed")
+
+	condition, args, err := CompileSQLFilter(expression, resourceType, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `lower(document #>> '{"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User","manager","value"}') = lower($1)`, condition)
+	assert.Equal(t, []interface{}{"26118915"}, args)
+}
+
+func TestCompileSQLFilterInvalid(t *testing.T) {
+	for _, f := range []string{
+		`unknown eq "x"`,
+		`active gt "true"`,
+		`meta.created gt "yesterday"`,
+		`emails[unknown eq "x"]`,
+		`name eq "x"`,
+	} {
+		expression, err := filter.NewParser(strings.NewReader(f)).Parse()
+		assert.NoError(t, err, "filter parsing failed")
+
+		_, _, err = CompileSQLFilter(expression, testResourceType, nil)
+		assert.Error(t, err, f)
+	}
+}
+
+func TestCompileSQLSort(t *testing.T) {
+	for sortBy, key := range map[string]string{
+		"userName":          `lower(user_name)`,
+		"meta.lastModified": `last_modified`,
+		"name.familyName":   `lower(document #>> '{"name","familyName"}')`,
+		"active":            `document #> '{"active"}'`,
+		"emails": `lower(COALESCE((SELECT s.value FROM jsonb_array_elements(` + emailsArray + `) AS s(value) ` +
+			`WHERE s.value->'primary' = 'true' LIMIT 1) #>> '{"value"}', document #>> '{"emails","0","value"}'))`,
+	} {
+		compiled, err := CompileSQLSort(sortBy, testResourceType)
+		assert.NoError(t, err)
+		assert.Equal(t, key, compiled, sortBy)
+	}
+
+	_, err := CompileSQLSort("unknown", testResourceType)
+	assert.Error(t, err)
+}
+
+func TestCompileSQLUnique(t *testing.T) {
+	unique := newTestUniqueAttributes()
+
+	condition, args, err := CompileSQLUnique(unique[0], []interface{}{"bjensen", "jsmith"}, []interface{}{"users", "0001"})
+	assert.NoError(t, err)
+	assert.Equal(t, `lower(document #>> '{"userName"}') IN (lower($3), lower($4))`, condition)
+	assert.Equal(t, []interface{}{"users", "0001", "bjensen", "jsmith"}, args)
+
+	condition, args, err = CompileSQLUnique(unique[1], []interface{}{"B-1"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `document #>> '{"urn:example:2.0:User","badge"}' IN ($1)`, condition)
+	assert.Equal(t, []interface{}{"B-1"}, args)
+}
+
+func TestTextArray(t *testing.T) {
+	assert.Equal(t, `'{"name","familyName"}'`, textArray([]string{"name", "familyName"}))
+	assert.Equal(t, `'{"it''s"}'`, textArray([]string{"it's"}))
+	assert.Equal(t, ` E'{"a\\\\\\"b"}'`, textArray([]string{`a\"b`}))
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// PostgresStore stores the resources of a resource type in a collection of a PostgreSQL database. It implements
+// scim.Store, in which the filters and sort attributes of queries are compiled to SQL.
+type PostgresStore struct {
+	db           *PostgresDB
+	collection   string
+	resourceType scim.ResourceType
+}
+
+// Insert stores a new resource.
+func (s PostgresStore) Insert(ctx context.Context, resource scim.ResourceAttributes) error {
+	document, err := json.Marshal(normalizeDateTimes(s.resourceType, resource))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.conn(ctx).ExecContext(ctx,
+		`INSERT INTO scim_resources (collection, document) VALUES ($1, $2)`, s.collection, string(document))
+	return postgresError(err)
+}
+
+// Find returns the stored resource with the given id, or nil if there is no such resource.
+func (s PostgresStore) Find(ctx context.Context, id string) (scim.ResourceAttributes, error) {
+	var document []byte
+	err := s.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT document FROM scim_resources WHERE collection = $1 AND id = $2`, s.collection, id).Scan(&document)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(document)
+}
+
+// Query returns the stored resources that match the query.
+func (s PostgresStore) Query(ctx context.Context, query scim.StoreQuery) ([]scim.ResourceAttributes, error) {
+	where, args, err := CompileSQLFilter(query.Filter, s.resourceType, []interface{}{s.collection})
+	if err != nil {
+		return nil, errors.ScimErrorInvalidFilter
+	}
+	order := "id"
+	if query.Reverse {
+		order = "id DESC"
+	}
+	if query.SortBy != "" {
+		key, err := CompileSQLSort(query.SortBy, s.resourceType)
+		if err != nil {
+			return nil, errors.ScimErrorBadParams([]string{"sortBy"})
+		}
+		if (query.SortOrder == scim.SortOrderDescending) != query.Reverse {
+			order = key + " DESC NULLS FIRST, " + order
+		} else {
+			order = key + " ASC NULLS LAST, " + order
+		}
+	}
+
+	statement := fmt.Sprintf(`SELECT document FROM scim_resources WHERE collection = $1 AND %s ORDER BY %s`, where, order)
+	if query.Limit != 0 {
+		args = append(args, query.Limit)
+		statement += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if query.Skip != 0 {
+		args = append(args, query.Skip)
+		statement += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := s.db.conn(ctx).QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []scim.ResourceAttributes{}
+	for rows.Next() {
+		var document []byte
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+		resource, err := decodeDocument(document)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, rows.Err()
+}
+
+// Count returns the number of stored resources that match the filter.
+func (s PostgresStore) Count(ctx context.Context, filter filter.Expression) (int, error) {
+	where, args, err := CompileSQLFilter(filter, s.resourceType, []interface{}{s.collection})
+	if err != nil {
+		return 0, errors.ScimErrorInvalidFilter
+	}
+	var count int
+	err = s.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT count(*) FROM scim_resources WHERE collection = $1 AND `+where, args...).Scan(&count)
+	return count, err
+}
+
+// InUse returns whether a resource other than the one with the given id has one of the values of the unique attribute.
+func (s PostgresStore) InUse(ctx context.Context, attribute scim.UniqueAttribute, id string, values []interface{}) (bool, error) {
+	where, args, err := CompileSQLUnique(attribute, values, []interface{}{s.collection, id})
+	if err != nil {
+		return false, err
+	}
+	var inUse bool
+	err = s.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM scim_resources WHERE collection = $1 AND id <> $2 AND `+where+`)`,
+		args...).Scan(&inUse)
+	return inUse, err
+}
+
+// Replace replaces the stored resource with the given id, if it still has the given version.
+func (s PostgresStore) Replace(ctx context.Context, id string, resource scim.ResourceAttributes, version string) error {
+	document, err := json.Marshal(normalizeDateTimes(s.resourceType, resource))
+	if err != nil {
+		return err
+	}
+	statement := `UPDATE scim_resources SET document = $3 WHERE collection = $1 AND id = $2`
+	args := []interface{}{s.collection, id, string(document)}
+	if version != "" {
+		statement += ` AND document->'meta'->>'version' = $4`
+		args = append(args, version)
+	}
+
+	result, err := s.db.conn(ctx).ExecContext(ctx, statement, args...)
+	if err != nil {
+		return postgresError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return scim.ErrVersionMismatch
+	}
+	return nil
+}
+
+// Delete removes the stored resource with the given id, if it still has the given version.
+func (s PostgresStore) Delete(ctx context.Context, id string, version string) error {
+	statement := `DELETE FROM scim_resources WHERE collection = $1 AND id = $2`
+	args := []interface{}{s.collection, id}
+	if version != "" {
+		statement += ` AND document->'meta'->>'version' = $3`
+		args = append(args, version)
+	}
+
+	result, err := s.db.conn(ctx).ExecContext(ctx, statement, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if version != "" && n == 0 {
+		return scim.ErrVersionMismatch
+	}
+	return nil
+}
+
+// Transaction calls fn within a transaction of the database. The stores of all collections of the database share the
+// transaction.
+func (s PostgresStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.db.Transaction(ctx, fn)
+}
+
+// postgresError converts the errors of the database to those of a scim.Store.
+func postgresError(err error) error {
+	if isUniqueViolation(err) {
+		return scim.ErrDuplicateValue
+	}
+	return err
+}
+
+func decodeDocument(document []byte) (scim.ResourceAttributes, error) {
+	var resource scim.ResourceAttributes
+	if err := json.Unmarshal(document, &resource); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
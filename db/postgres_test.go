@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/db/postgrestest"
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	postgrestest.Main(m)
+}
+
+// newTestPostgresStore returns a store in a new collection of the test database.
+func newTestPostgresStore(t *testing.T) (*PostgresDB, PostgresStore) {
+	ctx := context.Background()
+	db, err := ConnectPostgres(ctx, postgrestest.DSN(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// migrating an up to date database does nothing
+	assert.NoError(t, db.Migrate(ctx))
+
+	collection := "test-" + uuid.New().String()
+	assert.NoError(t, db.CreateUniqueIndexes(ctx, collection, testResourceType.UniqueAttributes()))
+	t.Cleanup(func() {
+		_, _ = db.db.Exec(`DELETE FROM scim_resources WHERE collection = $1`, collection)
+		_ = db.Close()
+	})
+	return db, db.Store(collection, testResourceType)
+}
+
+func parseFilter(t *testing.T, s string) filter.Expression {
+	expression, err := filter.NewParser(strings.NewReader(s)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expression
+}
+
+func TestPostgresStore(t *testing.T) {
+	_, store := newTestPostgresStore(t)
+	ctx := context.Background()
+
+	for _, resource := range []scim.ResourceAttributes{
+		{"id": "0002", "userName": "jsmith", "emails": []interface{}{
+			map[string]interface{}{"value": "jsmith@example.com", "type": "work"},
+		}, "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0001", "userName": "bjensen", "active": true, "emails": []interface{}{
+			map[string]interface{}{"value": "bjensen@example.org", "type": "home"},
+			map[string]interface{}{"value": "babs@example.com", "type": "work", "primary": true},
+		}, "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0003", "userName": "adoe", "meta": map[string]interface{}{"version": `W/"1"`}},
+	} {
+		assert.NoError(t, store.Insert(ctx, resource))
+	}
+	assert.Equal(t, scim.ErrDuplicateValue, store.Insert(ctx, scim.ResourceAttributes{"id": "0004", "userName": "BJensen"}))
+
+	resource, err := store.Find(ctx, "0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "bjensen", resource["userName"])
+	assert.Equal(t, true, resource["active"])
+	resource, err = store.Find(ctx, "0004")
+	assert.NoError(t, err)
+	assert.Nil(t, resource)
+
+	resources, err := store.Query(ctx, scim.StoreQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002", "0003"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{SortBy: "userName", Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{SortBy: "emails", SortOrder: scim.SortOrderDescending})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0003", "0002", "0001"}, resourceIDs(resources))
+
+	resources, err = store.Query(ctx, scim.StoreQuery{Filter: parseFilter(t, `emails[type eq "WORK" and value ew ".com"]`)})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002"}, resourceIDs(resources))
+
+	count, err := store.Count(ctx, parseFilter(t, `userName sw "J" or active eq "true"`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = store.Count(ctx, parseFilter(t, `emails.type ne "home"`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = store.Query(ctx, scim.StoreQuery{SortBy: "unknown"})
+	assert.Equal(t, errors.ScimErrorBadParams([]string{"sortBy"}), err)
+	_, err = store.Count(ctx, parseFilter(t, `unknown eq "x"`))
+	assert.Equal(t, errors.ScimErrorInvalidFilter, err)
+
+	inUse, err := store.InUse(ctx, testResourceType.UniqueAttributes()[0], "0002", []interface{}{"ADOE"})
+	assert.NoError(t, err)
+	assert.True(t, inUse)
+	inUse, err = store.InUse(ctx, testResourceType.UniqueAttributes()[0], "0003", []interface{}{"adoe"})
+	assert.NoError(t, err)
+	assert.False(t, inUse)
+}
+
+func TestPostgresStoreReplace(t *testing.T) {
+	_, store := newTestPostgresStore(t)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0001", "userName": "bjensen", "meta": map[string]interface{}{"version": `W/"1"`}}))
+	assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0002", "userName": "jsmith", "meta": map[string]interface{}{"version": `W/"1"`}}))
+
+	replaced := scim.ResourceAttributes{"id": "0001", "userName": "jsmith", "meta": map[string]interface{}{"version": `W/"2"`}}
+	assert.Equal(t, scim.ErrDuplicateValue, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	replaced["userName"] = "babs"
+	assert.Equal(t, scim.ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"0"`))
+	assert.NoError(t, store.Replace(ctx, "0001", replaced, `W/"1"`))
+	assert.Equal(t, scim.ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	assert.Equal(t, scim.ErrVersionMismatch, store.Delete(ctx, "0001", `W/"1"`))
+	assert.NoError(t, store.Delete(ctx, "0001", `W/"2"`))
+	assert.Equal(t, scim.ErrVersionMismatch, store.Delete(ctx, "0001", `W/"2"`))
+	assert.NoError(t, store.Delete(ctx, "0001", ""))
+	count, err := store.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPostgresStoreTransaction(t *testing.T) {
+	db, store := newTestPostgresStore(t)
+	other := db.Store(store.collection+"-other", testResourceType)
+	ctx := context.Background()
+	defer func() {
+		_, _ = db.db.Exec(`DELETE FROM scim_resources WHERE collection = $1`, other.collection)
+	}()
+
+	failure := errors.ScimErrorInternal
+	err := store.Transaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, store.Insert(ctx, scim.ResourceAttributes{"id": "0001"}))
+		assert.NoError(t, other.Insert(ctx, scim.ResourceAttributes{"id": "0001"}))
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	for _, s := range []PostgresStore{store, other} {
+		count, err := s.Count(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+	}
+
+	err = store.Transaction(ctx, func(ctx context.Context) error {
+		return other.Insert(ctx, scim.ResourceAttributes{"id": "0001"})
+	})
+	assert.NoError(t, err)
+	count, err := other.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPostgresStoreHandler(t *testing.T) {
+	_, store := newTestPostgresStore(t)
+	handler := scim.NewStoreHandler(testResourceType, store)
+	r := httptest.NewRequest(http.MethodPost, "/Users", nil)
+
+	created, err := handler.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	assert.NoError(t, err)
+	_, err = handler.Create(r, scim.ResourceAttributes{"userName": "BJENSEN"})
+	assert.Equal(t, errors.ScimTypeUniqueness, err.(errors.ScimError).ScimType)
+
+	replaced, err := handler.Replace(r, created.ID, scim.ResourceAttributes{"userName": "babs"})
+	assert.NoError(t, err)
+	assert.Equal(t, `W/"2"`, replaced.Meta.Version)
+
+	page, err := handler.GetAll(r, &scim.ListRequestParams{
+		Count:  10,
+		Filter: parseFilter(t, `meta.lastModified ge "2000-01-01T00:00:00Z"`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.TotalResults)
+	assert.Equal(t, "babs", page.Resources[0].Attributes["userName"])
+}
+
+func resourceIDs(resources []scim.ResourceAttributes) []interface{} {
+	var ids []interface{}
+	for _, resource := range resources {
+		ids = append(ids, resource["id"])
+	}
+	return ids
+}
@@ -0,0 +1,52 @@
+// Package postgrestest provides the PostgreSQL database that tests of the PostgreSQL store run against.
+package postgrestest
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// dsn is the data source name of the test database, which is set by Main.
+var dsn string
+
+// start starts an embedded PostgreSQL server, and returns its data source name together with a function that stops
+// it. It is only set if the tests are built with the "postgres" tag, as the binaries of the server are downloaded on
+// first use.
+var start func() (string, func() error, error)
+
+// Main runs the tests of a package, against the PostgreSQL database of the POSTGRES_DSN environment variable, e.g.
+// "postgres://postgres@localhost/scim_test?sslmode=disable". If it is not set, and the tests are built with the
+// "postgres" tag, an embedded server is started for the duration of the tests instead.
+func Main(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run runs the tests and returns their exit code.
+func run(m *testing.M) int {
+	dsn = os.Getenv("POSTGRES_DSN")
+	if dsn == "" && start != nil {
+		var stop func() error
+		var err error
+		if dsn, stop, err = start(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start the embedded PostgreSQL server: %v\n", err)
+			return 1
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to stop the embedded PostgreSQL server: %v\n", err)
+			}
+		}()
+	}
+	return m.Run()
+}
+
+// DSN returns the data source name of the test database. The test is skipped if there is no database, i.e. if
+// POSTGRES_DSN is not set and the tests are not built with the "postgres" tag.
+func DSN(t testing.TB) string {
+	t.Helper()
+	if dsn == "" {
+		t.Skip(`there is no PostgreSQL database, set POSTGRES_DSN or run the tests with "-tags postgres"`)
+	}
+	return dsn
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CompileSort translates a "sortBy" attribute path into an aggregation expression that computes the value a resource
+// of the given resource type is sorted by. Multi-valued attributes are sorted by their primary value, or their first
+// value if none of the values is primary. Strings that are not case exact are sorted case-insensitively and date times
+// are sorted chronologically.
+func CompileSort(sortBy string, resourceType scim.ResourceType) (interface{}, error) {
+	attr, sub, extensionID, ok := resourceType.LookupAttributePath(sortBy)
+	if !ok {
+		return nil, fmt.Errorf("invalid sort attribute %q", sortBy)
+	}
+
+	name := fieldName(extensionID, attr.Name())
+	leaf := attr
+	var subName string
+	switch {
+	case sub != nil:
+		leaf, subName = *sub, subFieldName(attr, *sub)
+	case attr.AttributeType() == "complex":
+		value, ok := attr.SubAttribute("value")
+		if !ok {
+			return nil, fmt.Errorf("complex attribute %q can not be sorted by", attr.Name())
+		}
+		leaf, subName = value, value.Name()
+	}
+
+	var key interface{}
+	switch {
+	case attr.MultiValued() && subName != "":
+		primary := bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$" + name, bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.primary", true}},
+		}}
+		key = bson.M{"$let": bson.M{
+			"vars": bson.M{"primary": primary},
+			"in": bson.M{"$ifNull": bson.A{
+				bson.M{"$arrayElemAt": bson.A{"$$primary." + subName, 0}},
+				bson.M{"$arrayElemAt": bson.A{"$" + name + "." + subName, 0}},
+			}},
+		}}
+	case attr.MultiValued():
+		key = bson.M{"$arrayElemAt": bson.A{"$" + name, 0}}
+	case subName != "":
+		key = "$" + name + "." + subName
+	default:
+		key = "$" + name
+	}
+
+	switch {
+	case leaf.AttributeType() == "dateTime":
+		key = bson.M{"$dateFromString": bson.M{
+			"dateString": key,
+			"onError":    key,
+		}}
+	case isString(leaf) && !leaf.CaseExact():
+		key = bson.M{"$cond": bson.M{
+			"if":   bson.M{"$eq": bson.A{bson.M{"$type": key}, "string"}},
+			"then": bson.M{"$toLower": key},
+			"else": key,
+		}}
+	}
+	return key, nil
+}
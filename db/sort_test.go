@@ -0,0 +1,65 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileSort(t *testing.T) {
+	tests := []struct {
+		sortBy string
+		key    interface{}
+	}{
+		{
+			sortBy: "id",
+			key:    "$id",
+		},
+		{
+			sortBy: "userName",
+			key: bson.M{"$cond": bson.M{
+				"if":   bson.M{"$eq": bson.A{bson.M{"$type": "$userName"}, "string"}},
+				"then": bson.M{"$toLower": "$userName"},
+				"else": "$userName",
+			}},
+		},
+		{
+			sortBy: "meta.created",
+			key: bson.M{"$dateFromString": bson.M{
+				"dateString": "$meta.created",
+				"onError":    "$meta.created",
+			}},
+		},
+		{
+			sortBy: "phoneNumbers.primary",
+			key: bson.M{"$let": bson.M{
+				"vars": bson.M{"primary": bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$phoneNumbers", bson.A{}}},
+					"cond":  bson.M{"$eq": bson.A{"$$this.primary", true}},
+				}}},
+				"in": bson.M{"$ifNull": bson.A{
+					bson.M{"$arrayElemAt": bson.A{"$$primary.primary", 0}},
+					bson.M{"$arrayElemAt": bson.A{"$phoneNumbers.primary", 0}},
+				}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.sortBy, func(t *testing.T) {
+			key, err := CompileSort(tt.sortBy, testResourceType)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+}
+
+func TestCompileSortInvalid(t *testing.T) {
+	for _, sortBy := range []string{"unknown", "name.unknown", "name"} {
+		_, err := CompileSort(sortBy, testResourceType)
+		assert.Error(t, err, sortBy)
+	}
+}
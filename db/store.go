@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// MongoStore stores the resources of a resource type in a collection. It implements scim.Store, in which the filters
+// and sort attributes of queries are compiled to query documents.
+type MongoStore struct {
+	collection   IMongoDB
+	resourceType scim.ResourceType
+}
+
+// NewMongoStore returns a store for the resources of the given resource type in the collection.
+func NewMongoStore(collection IMongoDB, resourceType scim.ResourceType) MongoStore {
+	return MongoStore{
+		collection:   collection,
+		resourceType: resourceType,
+	}
+}
+
+// Insert stores a new resource.
+func (s MongoStore) Insert(ctx context.Context, resource scim.ResourceAttributes) error {
+	return storeError(s.collection.Insert(ctx, normalizeDateTimes(s.resourceType, resource)))
+}
+
+// Find returns the stored resource with the given id, or nil if there is no such resource.
+func (s MongoStore) Find(ctx context.Context, id string) (scim.ResourceAttributes, error) {
+	document, err := s.collection.Find(ctx, id)
+	if err != nil || len(document) == 0 {
+		return nil, err
+	}
+	delete(document, "_id")
+	return scim.ResourceAttributes(document), nil
+}
+
+// Query returns the stored resources that match the query.
+func (s MongoStore) Query(ctx context.Context, query scim.StoreQuery) ([]scim.ResourceAttributes, error) {
+	compiled, err := CompileFilter(query.Filter, s.resourceType)
+	if err != nil {
+		return nil, errors.ScimErrorInvalidFilter
+	}
+	if query.SortBy != "" {
+		sort, err := CompileSort(query.SortBy, s.resourceType)
+		if err != nil {
+			return nil, errors.ScimErrorBadParams([]string{"sortBy"})
+		}
+		compiled.Sort = sort
+		compiled.SortDescending = query.SortOrder == scim.SortOrderDescending
+	} else {
+		compiled.Sort = "$id"
+	}
+	compiled.Skip = int64(query.Skip)
+	compiled.Limit = int64(query.Limit)
+	compiled.Reverse = query.Reverse
+
+	documents, err := s.collection.Query(ctx, compiled)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]scim.ResourceAttributes, len(documents))
+	for i, document := range documents {
+		delete(document, "_id")
+		resources[i] = scim.ResourceAttributes(document)
+	}
+	return resources, nil
+}
+
+// Count returns the number of stored resources that match the filter.
+func (s MongoStore) Count(ctx context.Context, filter filter.Expression) (int, error) {
+	compiled, err := CompileFilter(filter, s.resourceType)
+	if err != nil {
+		return 0, errors.ScimErrorInvalidFilter
+	}
+	count, err := s.collection.Count(ctx, compiled)
+	return int(count), err
+}
+
+// InUse returns whether a resource other than the one with the given id has one of the values of the unique attribute.
+func (s MongoStore) InUse(ctx context.Context, attribute scim.UniqueAttribute, id string, values []interface{}) (bool, error) {
+	count, err := s.collection.Count(ctx, CompileUnique(attribute, id, values))
+	return count != 0, err
+}
+
+// Replace replaces the stored resource with the given id, if it still has the given version.
+func (s MongoStore) Replace(ctx context.Context, id string, resource scim.ResourceAttributes, version string) error {
+	return storeError(s.collection.Replace(ctx, id, normalizeDateTimes(s.resourceType, resource), version))
+}
+
+// Delete removes the stored resource with the given id, if it still has the given version.
+func (s MongoStore) Delete(ctx context.Context, id string, version string) error {
+	return storeError(s.collection.Delete(ctx, id, version))
+}
+
+// Transaction calls fn within a transaction of the client of the collection.
+func (s MongoStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.collection.Transaction(ctx, fn)
+}
+
+// storeError converts the errors of a collection to those of a scim.Store.
+func storeError(err error) error {
+	switch err {
+	case ErrNoMatch:
+		return scim.ErrVersionMismatch
+	case ErrDuplicate:
+		return scim.ErrDuplicateValue
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreError(t *testing.T) {
+	other := errors.New("connection refused")
+
+	assert.Nil(t, storeError(nil))
+	assert.Equal(t, scim.ErrVersionMismatch, storeError(ErrNoMatch))
+	assert.Equal(t, scim.ErrDuplicateValue, storeError(ErrDuplicate))
+	assert.Equal(t, other, storeError(other))
+}
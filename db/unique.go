@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/dgbttn/go-scim-server/scim"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDuplicate is returned when a document is stored with a value of a unique attribute that another document
+// already has.
+var ErrDuplicate = errors.New("db: duplicate value of a unique attribute")
+
+// duplicateKeyCode is the code of the error MongoDB returns when a write violates a unique index.
+const duplicateKeyCode = 11000
+
+// uniqueField returns the name of the field in which the values of the unique attribute are stored.
+func uniqueField(attribute scim.UniqueAttribute) string {
+	name := fieldName(attribute.SchemaID, attribute.Attribute.Name())
+	if attribute.SubAttribute != nil {
+		name += "." + attribute.SubAttribute.Name()
+	}
+	return name
+}
+
+// CompileUnique returns the query that matches the resources, other than the resource with the given id, that have
+// one of the given values of the unique attribute. Values of attributes that are not case exact are compared
+// case-insensitively.
+func CompileUnique(attribute scim.UniqueAttribute, id string, values []interface{}) Query {
+	q := Query{Filter: bson.M{
+		uniqueField(attribute): bson.M{"$in": values},
+		"id":                   bson.M{"$ne": id},
+	}}
+	if !attribute.CaseExact() {
+		q.Collation = caseInsensitiveCollation
+	}
+	return q
+}
+
+// uniqueIndexes returns the indexes that enforce the uniqueness of the given attributes. Only the resources that have a
+// value for an attribute are indexed, and values of attributes that are not case exact are indexed case-insensitively.
+func uniqueIndexes(attributes []scim.UniqueAttribute) []mongo.IndexModel {
+	indexes := make([]mongo.IndexModel, 0, len(attributes))
+	for _, attribute := range attributes {
+		field := uniqueField(attribute)
+		opts := options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{field: bson.M{"$exists": true}})
+		if !attribute.CaseExact() {
+			opts.SetCollation(caseInsensitiveCollation)
+		}
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: opts,
+		})
+	}
+	return indexes
+}
+
+// isDuplicateKeyError returns whether the error is caused by the violation of a unique index.
+func isDuplicateKeyError(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKeyCode
+	}
+	return false
+}
+
+// writeError converts the error of a write to ErrDuplicate if the write violates a unique index.
+func writeError(err error) error {
+	if isDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func newTestUniqueAttributes() []scim.UniqueAttribute {
+	return scim.ResourceType{
+		Schema: schema.CoreUserSchema(),
+		SchemaExtensions: []scim.SchemaExtension{
+			{Schema: schema.Schema{
+				ID: "urn:example:2.0:User",
+				Attributes: []schema.CoreAttribute{
+					schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+						Name:       "badge",
+						CaseExact:  true,
+						Uniqueness: schema.AttributeUniquenessGlobal(),
+					})),
+				},
+			}},
+		},
+	}.UniqueAttributes()
+}
+
+func TestCompileUnique(t *testing.T) {
+	unique := newTestUniqueAttributes()
+
+	q := CompileUnique(unique[0], "0001", []interface{}{"bjensen"})
+	assert.Equal(t, bson.M{
+		"userName": bson.M{"$in": []interface{}{"bjensen"}},
+		"id":       bson.M{"$ne": "0001"},
+	}, q.Filter)
+	assert.Equal(t, caseInsensitiveCollation, q.Collation)
+
+	q = CompileUnique(unique[1], "", []interface{}{"B-1"})
+	assert.Equal(t, bson.M{
+		"urn:example:2．0:User.badge": bson.M{"$in": []interface{}{"B-1"}},
+		"id":                         bson.M{"$ne": ""},
+	}, q.Filter)
+	assert.Nil(t, q.Collation)
+}
+
+func TestUniqueIndexes(t *testing.T) {
+	indexes := uniqueIndexes(newTestUniqueAttributes())
+	assert.Len(t, indexes, 2)
+
+	assert.Equal(t, bson.D{{Key: "userName", Value: 1}}, indexes[0].Keys)
+	assert.True(t, *indexes[0].Options.Unique)
+	assert.Equal(t, bson.M{"userName": bson.M{"$exists": true}}, indexes[0].Options.PartialFilterExpression)
+	assert.Equal(t, caseInsensitiveCollation, indexes[0].Options.Collation)
+
+	assert.Equal(t, bson.D{{Key: "urn:example:2．0:User.badge", Value: 1}}, indexes[1].Keys)
+	assert.Nil(t, indexes[1].Options.Collation)
+}
+
+func TestWriteError(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: duplicateKeyCode}}}
+	assert.Equal(t, ErrDuplicate, writeError(duplicate))
+	assert.Equal(t, ErrDuplicate, writeError(mongo.CommandError{Code: duplicateKeyCode}))
+
+	other := errors.New("connection lost")
+	assert.Equal(t, other, writeError(other))
+	assert.Nil(t, writeError(nil))
+}
@@ -39,6 +39,14 @@ const (
 	ScimTypeInvalidVersion ScimType = "invalidVers"
 	// ScimTypeSensitive indicates that the specified request cannot be completed, due to the passing of sensitive information in a request URI.
 	ScimTypeSensitive ScimType = "sensitive"
+	// ScimTypeInvalidCursor indicates that the "cursor" parameter was malformed, was altered, or does not belong to the
+	// query it is used with (RFC 9865).
+	ScimTypeInvalidCursor ScimType = "invalidCursor"
+	// ScimTypeExpiredCursor indicates that the "cursor" parameter has expired (RFC 9865).
+	ScimTypeExpiredCursor ScimType = "expiredCursor"
+	// ScimTypeInvalidCount indicates that the "count" parameter is not supported in combination with a cursor, e.g.
+	// because it exceeds the maximum page size (RFC 9865).
+	ScimTypeInvalidCount ScimType = "invalidCount"
 )
 
 // ScimError is a SCIM error response to indicate operation success or failure.
@@ -104,6 +112,36 @@ func (e *ScimError) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// FieldError describes why the value of a single attribute is invalid.
+type FieldError struct {
+	// Path is the path of the attribute, including the indexes of multi-valued attributes, e.g. "emails[1].value".
+	Path string
+	// Expected is the data type the value was expected to have, e.g. "string". It is empty if the value has the
+	// expected type, but is invalid for another reason.
+	Expected string
+	// Reason describes what is wrong with the value, e.g. "got number" or "is required".
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("%s: expected %s", e.Path, e.Expected)
+	}
+	return fmt.Sprintf("%s: expected %s, %s", e.Path, e.Expected, e.Reason)
+}
+
+// ScimErrorInvalidField returns an 400 SCIM error of the given type with the field error as detail.
+func ScimErrorInvalidField(scimType ScimType, field FieldError) ScimError {
+	return ScimError{
+		ScimType: scimType,
+		Detail:   field.Error(),
+		Status:   http.StatusBadRequest,
+	}
+}
+
 // ScimErrorResourceNotFound returns an 404 SCIM error with a detailed message based on the id.
 func ScimErrorResourceNotFound(id string) ScimError {
 	return ScimError{
@@ -135,6 +173,24 @@ func ScimErrorBadRequest(msg string) ScimError {
 	}
 }
 
+// ScimErrorPayloadTooLarge returns an 413 SCIM error with the given message, e.g. when a bulk request exceeds the
+// maximum number of operations or the maximum payload size.
+func ScimErrorPayloadTooLarge(msg string) ScimError {
+	return ScimError{
+		Detail: msg,
+		Status: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// ScimErrorTimeout returns an 500 SCIM error with the given message, e.g. when the data store does not respond in time.
+// SCIM does not define the 503 status code, so the timeout is reported as an internal error.
+func ScimErrorTimeout(msg string) ScimError {
+	return ScimError{
+		Detail: msg,
+		Status: http.StatusInternalServerError,
+	}
+}
+
 var (
 	// ScimErrorInvalidFilter returns an 400 SCIM error with a detailed message.
 	ScimErrorInvalidFilter = ScimError{
@@ -196,6 +252,29 @@ var (
 		Detail:   "The specified request cannot be completed, due to the passing of sensitive information in a request URI.",
 		Status:   http.StatusForbidden,
 	}
+	// ScimErrorInvalidCursor returns an 400 SCIM error with a detailed message.
+	ScimErrorInvalidCursor = ScimError{
+		ScimType: ScimTypeInvalidCursor,
+		Detail:   "The specified cursor is invalid, or does not belong to the query it is used with.",
+		Status:   http.StatusBadRequest,
+	}
+	// ScimErrorExpiredCursor returns an 400 SCIM error with a detailed message.
+	ScimErrorExpiredCursor = ScimError{
+		ScimType: ScimTypeExpiredCursor,
+		Detail:   "The specified cursor has expired. Please restart the query without a cursor value.",
+		Status:   http.StatusBadRequest,
+	}
+	// ScimErrorInvalidCount returns an 400 SCIM error with a detailed message.
+	ScimErrorInvalidCount = ScimError{
+		ScimType: ScimTypeInvalidCount,
+		Detail:   "The specified count is not supported, it has to be between 0 and the maximum page size.",
+		Status:   http.StatusBadRequest,
+	}
+	// ScimErrorPreconditionFailed returns an 412 SCIM error with a detailed message.
+	ScimErrorPreconditionFailed = ScimError{
+		Detail: "Failed to update. Resource has changed on the server.",
+		Status: http.StatusPreconditionFailed,
+	}
 	// ScimErrorInternal returns an 500 SCIM error without a message.
 	ScimErrorInternal = ScimError{
 		Status: http.StatusInternalServerError,
@@ -104,3 +104,23 @@ func TestCheckError(t *testing.T) {
 		t.Errorf("status code 500 expected, got %d", scimErr.Status)
 	}
 }
+
+func TestFieldError(t *testing.T) {
+	for _, test := range []struct {
+		field    FieldError
+		expected string
+	}{
+		{FieldError{Path: "emails[1].value", Expected: "string", Reason: "got number 1"}, "emails[1].value: expected string, got number 1"},
+		{FieldError{Path: "userName", Reason: "is required"}, "userName: is required"},
+		{FieldError{Path: "active", Expected: "boolean"}, "active: expected boolean"},
+	} {
+		if msg := test.field.Error(); msg != test.expected {
+			t.Errorf("got %q, expected %q", msg, test.expected)
+		}
+	}
+
+	scimErr := ScimErrorInvalidField(ScimTypeInvalidValue, FieldError{Path: "userName", Reason: "is required"})
+	if scimErr.Status != http.StatusBadRequest || scimErr.ScimType != ScimTypeInvalidValue || scimErr.Detail != "userName: is required" {
+		t.Errorf("got invalid scim error: %v", scimErr)
+	}
+}
@@ -5,9 +5,12 @@ go 1.14
 require (
 	github.com/di-wu/scim-filter-parser v0.0.0-20191024153148-b33ea97ae796
 	github.com/di-wu/xsd-datetime v0.0.0-20190813080539-55a8ba70aa69
+	github.com/fergusstrange/embedded-postgres v1.16.0
 	github.com/google/uuid v1.1.1
 	github.com/joho/godotenv v1.3.0
+	github.com/lib/pq v1.10.9
 	github.com/spf13/viper v1.7.0
-	github.com/stretchr/testify v1.6.0
+	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
 	go.mongodb.org/mongo-driver v1.3.4
 )
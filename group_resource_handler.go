@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/optional"
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/dgbttn/go-scim-server/scim"
+)
+
+// expandParameter is the query parameter to request the effective members of groups.
+const expandParameter = "expand"
+
+var (
+	// GroupResourceType ...
+	GroupResourceType = scim.ResourceType{
+		ID:          optional.NewString("Group"),
+		Name:        "Group",
+		Endpoint:    "/Groups",
+		Description: optional.NewString("Group"),
+		Schema:      schema.CoreGroupSchema(),
+	}
+)
+
+// GroupResourceHandler is the handler of the groups, which stores them with a scim.StoreHandler. Only the value and the
+// type of the members are stored, their "$ref" is derived from the resource they reference when the groups are returned.
+type GroupResourceHandler struct {
+	scim.StoreHandler
+	users  scim.Store
+	groups scim.Store
+}
+
+// NewGroupResourceHandler returns a handler of the groups in the given store. The members of the groups are either
+// users in the user store, or other groups.
+func NewGroupResourceHandler(users scim.Store, groups scim.Store) GroupResourceHandler {
+	h := GroupResourceHandler{
+		users:  users,
+		groups: groups,
+	}
+	h.StoreHandler = scim.NewStoreHandler(GroupResourceType, groups).WithHooks(scim.StoreHooks{
+		Prepare:         h.prepare,
+		CheckUniqueness: h.checkUniqueness,
+		Output:          h.output,
+		Deleted:         h.removeMember,
+	})
+	return h
+}
+
+// prepare validates the members of the group with the given id, and converts them to the form in which they are stored.
+func (h GroupResourceHandler) prepare(ctx context.Context, id string, attributes scim.ResourceAttributes) error {
+	members, err := h.members(ctx, id, attributes["members"])
+	if err != nil {
+		return err
+	}
+	h.setMembers(attributes, members)
+	return nil
+}
+
+// checkUniqueness checks that no other user or group has one of the values of the unique attributes of the group.
+func (h GroupResourceHandler) checkUniqueness(ctx context.Context, id string, attributes scim.ResourceAttributes) error {
+	return checkUniqueness(ctx, h.stores(), GroupResourceType, id, attributes)
+}
+
+// removeMember removes the resource with the given id from all the groups it is a member of.
+func (h GroupResourceHandler) removeMember(ctx context.Context, id string) error {
+	groups, err := h.groups.Query(ctx, scim.StoreQuery{Filter: valuesFilter("members.value", []string{id})})
+	if err != nil {
+		return scim.StoreError(err)
+	}
+
+	handler := scim.NewStoreHandler(GroupResourceType, h.groups)
+	for _, group := range groups {
+		groupID, _ := group["id"].(string)
+		_, err := handler.Update(ctx, groupID, func(attributes scim.ResourceAttributes) error {
+			members, _ := getSlice(attributes["members"])
+			remaining := make([]interface{}, 0, len(members))
+			for _, member := range members {
+				if m, _ := getMap(member); m["value"] != id {
+					remaining = append(remaining, member)
+				}
+			}
+			h.setMembers(attributes, remaining)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// members validates the members of the group with the given id and returns them in the form in which they are
+// stored. Every member has to reference an existing user or group, and a group can not be a member of itself, either
+// directly or through nested groups. The type of a member is derived from the resource it references if it is not
+// given. Duplicate members are only added once. The "$ref" of a member is not stored, but derived from its value when
+// the group is returned.
+func (h GroupResourceHandler) members(ctx context.Context, id string, value interface{}) ([]interface{}, error) {
+	list, ok := getSlice(value)
+	if !ok {
+		return nil, errors.ScimErrorInvalidValue
+	}
+
+	members := make([]interface{}, 0, len(list))
+	added := make(map[string]bool)
+	var groupIDs []string
+	for _, element := range list {
+		member, ok := getMap(element)
+		if !ok {
+			return nil, errors.ScimErrorInvalidValue
+		}
+		memberID, _ := member["value"].(string)
+		if memberID == "" {
+			return nil, errors.ScimErrorInvalidValue
+		}
+		if added[memberID] {
+			continue
+		}
+
+		memberType, _ := member["type"].(string)
+		memberType, err := h.memberType(ctx, memberID, memberType)
+		if err != nil {
+			return nil, err
+		}
+		if memberType == GroupResourceType.Name {
+			groupIDs = append(groupIDs, memberID)
+		}
+
+		added[memberID] = true
+		members = append(members, map[string]interface{}{
+			"value": memberID,
+			"type":  memberType,
+		})
+	}
+
+	if id != "" {
+		circular, err := h.contains(ctx, groupIDs, id)
+		if err != nil {
+			return nil, err
+		}
+		if circular {
+			return nil, errors.ScimError{
+				ScimType: errors.ScimTypeInvalidValue,
+				Detail:   fmt.Sprintf("Group %s can not be a member of itself.", id),
+				Status:   http.StatusBadRequest,
+			}
+		}
+	}
+	return members, nil
+}
+
+// memberType returns the type of the resource with the given id, which is either a user or a group. If the type is
+// given, the resource has to be of that type.
+func (h GroupResourceHandler) memberType(ctx context.Context, id string, memberType string) (string, error) {
+	for _, resourceType := range []struct {
+		name  string
+		store scim.Store
+	}{
+		{name: UserResourceType.Name, store: h.users},
+		{name: GroupResourceType.Name, store: h.groups},
+	} {
+		if memberType != "" && memberType != resourceType.name {
+			continue
+		}
+		resource, err := resourceType.store.Find(ctx, id)
+		if err != nil {
+			return "", scim.StoreError(err)
+		}
+		if len(resource) != 0 {
+			return resourceType.name, nil
+		}
+	}
+
+	if memberType != "" && memberType != UserResourceType.Name && memberType != GroupResourceType.Name {
+		return "", errors.ScimError{
+			ScimType: errors.ScimTypeInvalidValue,
+			Detail:   fmt.Sprintf("Member %s has an unsupported type %s.", id, memberType),
+			Status:   http.StatusBadRequest,
+		}
+	}
+	return "", errors.ScimError{
+		ScimType: errors.ScimTypeInvalidValue,
+		Detail:   fmt.Sprintf("Member %s does not exist.", id),
+		Status:   http.StatusBadRequest,
+	}
+}
+
+// contains returns whether the group with the given id is one of the given groups, or a member of one of them through
+// nested groups.
+func (h GroupResourceHandler) contains(ctx context.Context, groupIDs []string, id string) (bool, error) {
+	visited := make(map[string]bool)
+	for len(groupIDs) != 0 {
+		var next []string
+		for _, groupID := range groupIDs {
+			if groupID == id {
+				return true, nil
+			}
+			if visited[groupID] {
+				continue
+			}
+			visited[groupID] = true
+
+			group, err := h.groups.Find(ctx, groupID)
+			if err != nil {
+				return false, scim.StoreError(err)
+			}
+			members, _ := getSlice(group["members"])
+			for _, m := range members {
+				if member, _ := getMap(m); member["type"] == GroupResourceType.Name {
+					value, _ := member["value"].(string)
+					next = append(next, value)
+				}
+			}
+		}
+		groupIDs = next
+	}
+	return false, nil
+}
+
+// memberOf returns the groups the resources with the given ids are a member of. Each group has the type "direct" if
+// the resource is a member of the group itself, or "indirect" if it is a member through nested groups.
+func (h GroupResourceHandler) memberOf(ctx context.Context, ids []string) (map[string][]interface{}, error) {
+	groups := make(map[string]scim.Resource)
+	// parents contains the ids of the groups that each of the resources and groups are a direct member of.
+	parents := make(map[string][]string)
+
+	frontier := ids
+	for len(frontier) != 0 {
+		data, err := h.groups.Query(ctx, scim.StoreQuery{Filter: valuesFilter("members.value", frontier)})
+		if err != nil {
+			return nil, scim.StoreError(err)
+		}
+
+		inFrontier := make(map[string]bool)
+		for _, id := range frontier {
+			inFrontier[id] = true
+		}
+
+		var next []string
+		for _, group := range data {
+			resource := resourceFromData(group)
+			if _, ok := groups[resource.ID]; !ok {
+				groups[resource.ID] = resource
+				next = append(next, resource.ID)
+			}
+
+			members, _ := getSlice(resource.Attributes["members"])
+			for _, m := range members {
+				member, _ := getMap(m)
+				if value, _ := member["value"].(string); inFrontier[value] {
+					parents[value] = append(parents[value], resource.ID)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	memberOf := make(map[string][]interface{})
+	for _, id := range ids {
+		visited := make(map[string]bool)
+		memberType := "direct"
+		for current := parents[id]; len(current) != 0; memberType = "indirect" {
+			var next []string
+			for _, groupID := range current {
+				if visited[groupID] {
+					continue
+				}
+				visited[groupID] = true
+
+				group := groups[groupID]
+				memberOf[id] = append(memberOf[id], map[string]interface{}{
+					"value":   group.ID,
+					"$ref":    group.Meta.Location,
+					"display": group.Attributes["displayName"],
+					"type":    memberType,
+				})
+				next = append(next, parents[groupID]...)
+			}
+			current = next
+		}
+	}
+	return memberOf, nil
+}
+
+// effectiveMembers returns the members of the group, together with the members of its nested groups.
+func (h GroupResourceHandler) effectiveMembers(ctx context.Context, resource scim.Resource) (scim.Resource, error) {
+	members, _ := getSlice(resource.Attributes["members"])
+	effective := make([]interface{}, 0, len(members))
+	added := map[string]bool{resource.ID: true}
+	for len(members) != 0 {
+		var next []interface{}
+		for _, m := range members {
+			member, _ := getMap(m)
+			value, _ := member["value"].(string)
+			if added[value] {
+				continue
+			}
+			added[value] = true
+			effective = append(effective, member)
+
+			if member["type"] != GroupResourceType.Name {
+				continue
+			}
+			group, err := h.groups.Find(ctx, value)
+			if err != nil {
+				return scim.Resource{}, scim.StoreError(err)
+			}
+			nested, _ := getSlice(group["members"])
+			next = append(next, nested...)
+		}
+		members = next
+	}
+
+	h.setMembers(resource.Attributes, effective)
+	return resource, nil
+}
+
+func (h GroupResourceHandler) setMembers(attributes map[string]interface{}, members []interface{}) {
+	if len(members) == 0 {
+		delete(attributes, "members")
+		return
+	}
+	attributes["members"] = members
+}
+
+// output prepares the stored groups to be returned. If the request has the query parameter "expand=members", the
+// members of the groups are replaced by their effective members, which include the members of their nested groups. The
+// version of the groups then covers the effective members, as they change with the nested groups.
+func (h GroupResourceHandler) output(r *http.Request, resources []scim.Resource) ([]scim.Resource, error) {
+	expand := r.URL.Query().Get(expandParameter) == "members"
+	for i, resource := range resources {
+		if expand {
+			var err error
+			if resource, err = h.effectiveMembers(r.Context(), resource); err != nil {
+				return nil, err
+			}
+			resource.Meta.Version = scim.DerivedETag(resource.Meta.Version, resource.Attributes["members"])
+		}
+		resources[i] = h.withReferences(resource)
+	}
+	return resources, nil
+}
+
+// withReferences adds the "$ref" of the members of the group, which is the location of the resource they reference.
+func (h GroupResourceHandler) withReferences(resource scim.Resource) scim.Resource {
+	members, _ := getSlice(resource.Attributes["members"])
+	for i, m := range members {
+		member, _ := getMap(m)
+		id, _ := member["value"].(string)
+		endpoint := UserResourceType.Endpoint
+		if member["type"] == GroupResourceType.Name {
+			endpoint = GroupResourceType.Endpoint
+		}
+		member["$ref"] = fmt.Sprintf("%s/%s", endpoint[1:], url.PathEscape(id))
+		members[i] = member
+	}
+	if len(members) != 0 {
+		resource.Attributes["members"] = members
+	}
+	return resource
+}
+
+// stores returns the resource types of the server, together with their stores.
+func (h GroupResourceHandler) stores() []storedResourceType {
+	return storedResourceTypes(h.users, h.groups)
+}
@@ -1,38 +1,190 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
 	"net/http"
 
 	"github.com/dgbttn/go-scim-server/db"
+	"github.com/dgbttn/go-scim-server/schema"
 	"github.com/dgbttn/go-scim-server/scim"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/spf13/viper"
 )
 
-func initServer() {
+// storeOpener opens the store of the resources of a resource type, which are kept in the collection with the given
+// name if the database has collections.
+type storeOpener func(resourceType scim.ResourceType, collection string) scim.Store
+
+func initServer(openStore storeOpener) {
+	// users are validated strictly with the STRICT_SCHEMA setting, which is off by default
+	if viper.GetBool("STRICT_SCHEMA") {
+		UserResourceType = withStrictSchema(UserResourceType)
+	}
+
+	openStore = withTimeouts(openStore)
+	users := openStore(UserResourceType, viper.GetString("COLLECTION"))
+	groups := openStore(GroupResourceType, viper.GetString("GROUP_COLLECTION"))
+	UserResourceType.Handler = NewUserResourceHandler(users, groups)
+	GroupResourceType.Handler = NewGroupResourceHandler(users, groups)
+
+	resourceTypes := []scim.ResourceType{
+		UserResourceType,
+		GroupResourceType,
+	}
+	for _, resourceType := range loadResourceTypes() {
+		for _, t := range resourceTypes {
+			if t.Name == resourceType.Name || t.Endpoint == resourceType.Endpoint {
+				log.Fatalf("Resource type %s is already defined.", resourceType.Name)
+			}
+		}
+		// the resources of each custom resource type are stored in a collection named after the resource type
+		resourceType.Handler = scim.NewStoreHandler(resourceType, openStore(resourceType, resourceType.Name))
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+
 	server := scim.Server{
-		Config: scim.ServiceProviderConfig{},
-		ResourceTypes: []scim.ResourceType{
-			UserResourceType,
+		Config: scim.ServiceProviderConfig{
+			SupportFiltering: true,
+			SupportPatch:     true,
+			SupportSort:      true,
+			SupportETag:      true,
+			SupportBulk:      true,
+
+			SupportCursorPagination: true,
+			CursorSecret:            cursorSecret(),
+			CursorTimeout:           viper.GetDuration("CURSOR_TIMEOUT"),
 		},
+		ResourceTypes: resourceTypes,
+		Me:            meMapping(),
 	}
 
 	log.Fatal(http.ListenAndServe(":8082", server))
 }
 
+// loadResourceTypes loads the resource types, and the schemas they are based on, from the JSON documents in the
+// configured schema directory. Resource types can also be based on the built-in User, Group and EnterpriseUser schemas.
+func loadResourceTypes() []scim.ResourceType {
+	dir := viper.GetString("SCHEMA_DIRECTORY")
+	if dir == "" {
+		return nil
+	}
+
+	resourceTypes, err := scim.LoadResourceTypes(dir,
+		schema.CoreUserSchema(), schema.CoreGroupSchema(), schema.ExtensionEnterpriseUser())
+	if err != nil {
+		log.Fatalf("Failed to load resource types: %v", err)
+	}
+	return resourceTypes
+}
+
+// meMapping returns the mapping of the "/Me" endpoint to the User resource of the authenticated subject, which is
+// configured with the ME_SUBJECT setting: either "id", or the path of the attribute whose value is the subject, e.g.
+// "userName". The endpoint is not supported if it is not set. The subject is passed by authentication middleware with
+// scim.WithSubject.
+func meMapping() *scim.MeMapping {
+	switch subject := viper.GetString("ME_SUBJECT"); subject {
+	case "":
+		return nil
+	case "id":
+		return &scim.MeMapping{ResourceType: UserResourceType.Name}
+	default:
+		return &scim.MeMapping{ResourceType: UserResourceType.Name, Attribute: subject}
+	}
+}
+
+// cursorSecret returns the key with which the pagination cursors are signed, which is configured with the CURSOR_SECRET
+// setting. Servers behind the same load balancer need to share the key. If it is not set, a random key is generated, in
+// which case the cursors can not be used after the server restarts.
+func cursorSecret() []byte {
+	if secret := viper.GetString("CURSOR_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate the cursor secret: %v", err)
+	}
+	return secret
+}
+
+// withTimeouts bounds the operations of the opened stores by the timeouts that are configured with the
+// STORE_READ_TIMEOUT, STORE_WRITE_TIMEOUT and STORE_TRANSACTION_TIMEOUT settings, e.g. "5s". Operations are not bound by
+// a timeout that is not set, other than by the context of the request they serve.
+func withTimeouts(openStore storeOpener) storeOpener {
+	timeouts := scim.StoreTimeouts{
+		Read:        viper.GetDuration("STORE_READ_TIMEOUT"),
+		Write:       viper.GetDuration("STORE_WRITE_TIMEOUT"),
+		Transaction: viper.GetDuration("STORE_TRANSACTION_TIMEOUT"),
+	}
+	if timeouts == (scim.StoreTimeouts{}) {
+		return openStore
+	}
+	return func(resourceType scim.ResourceType, collection string) scim.Store {
+		return scim.WithTimeouts(openStore(resourceType, collection), timeouts)
+	}
+}
+
+// openStores returns the opener of the stores of the database that is configured with the STORE setting, which is
+// either "mongodb" (the default), "postgres", "bolt" or "memory". The "bolt" store keeps the resources in the single
+// file at BOLT_PATH, so that the server does not depend on an external database. The resources in memory are lost
+// when the server stops.
+func openStores() storeOpener {
+	switch store := viper.GetString("STORE"); store {
+	case "", "mongodb":
+		connectMongoDB()
+		return func(resourceType scim.ResourceType, collection string) scim.Store {
+			c := db.MongoDB.Collection(collection)
+			if err := c.CreateUniqueIndexes(context.Background(), resourceType.UniqueAttributes()); err != nil {
+				log.Fatalf("Failed to create the indexes of resource type %s: %v", resourceType.Name, err)
+			}
+			return db.NewMongoStore(c, resourceType)
+		}
+	case "postgres":
+		database, err := db.ConnectPostgres(context.Background(), viper.GetString("POSTGRES_CONNECTION"))
+		if err != nil {
+			log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		}
+		return func(resourceType scim.ResourceType, collection string) scim.Store {
+			if err := database.CreateUniqueIndexes(context.Background(), collection, resourceType.UniqueAttributes()); err != nil {
+				log.Fatalf("Failed to create the indexes of resource type %s: %v", resourceType.Name, err)
+			}
+			return database.Store(collection, resourceType)
+		}
+	case "bolt":
+		database, err := db.OpenBolt(viper.GetString("BOLT_PATH"))
+		if err != nil {
+			log.Fatalf("Failed to open the database file: %v", err)
+		}
+		return func(resourceType scim.ResourceType, collection string) scim.Store {
+			store, err := database.Store(collection, resourceType)
+			if err != nil {
+				log.Fatalf("Failed to create the indexes of resource type %s: %v", resourceType.Name, err)
+			}
+			return store
+		}
+	case "memory":
+		database := scim.NewMemoryDatabase()
+		return func(resourceType scim.ResourceType, _ string) scim.Store {
+			return database.Store(resourceType)
+		}
+	default:
+		log.Fatalf("Unknown store %s.", store)
+		return nil
+	}
+}
+
 func connectMongoDB() {
 	connectionStr := viper.GetString("MONGODB_CONNECTION")
 	databaseStr := viper.GetString("DATABASE")
 	collectionStr := viper.GetString("COLLECTION")
-	if err := db.MongoDB.ConnectDB(connectionStr, databaseStr, collectionStr); err != nil {
+	if err := db.MongoDB.ConnectDB(context.Background(), connectionStr, databaseStr, collectionStr); err != nil {
 		panic(err)
 	}
 }
 
 func main() {
 	viper.AutomaticEnv()
-	connectMongoDB()
-	initServer()
+	initServer(openStores())
 }
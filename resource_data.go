@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/optional"
+	"github.com/dgbttn/go-scim-server/scim"
+)
+
+// getSlice returns the value as a slice of JSON values, if it is one.
+func getSlice(v interface{}) (s []interface{}, ok bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return
+	}
+	return s, true
+}
+
+// getMap returns the value as a map of JSON values, if it is one.
+func getMap(v interface{}) (m map[string]interface{}, ok bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return
+	}
+	return m, true
+}
+
+// cleanMap removes the attributes that are not set from the data of a resource, including its (sub-)attributes.
+func cleanMap(data map[string]interface{}) map[string]interface{} {
+	for k, v := range data {
+		if v == nil {
+			delete(data, k)
+			continue
+		}
+		if attr, ok := getMap(v); ok {
+			data[k] = cleanMap(attr)
+			continue
+		}
+		if attr, ok := getSlice(v); ok {
+			for i := 0; i < len(attr); i++ {
+				if element, ok := getMap(attr[i]); ok {
+					attr[i] = cleanMap(element)
+				}
+			}
+			data[k] = attr
+		}
+	}
+	return data
+}
+
+// extractResourceData returns the id, external id, attributes and meta data of the given data of a resource.
+func extractResourceData(data map[string]interface{}) (id string, externalID optional.String, attributes map[string]interface{}, meta scim.Meta) {
+	// id
+	if idAttr, ok := data["id"]; ok {
+		id, _ = idAttr.(string)
+	}
+
+	// externalID
+	if eIDAttr, ok := data["externalId"]; ok {
+		if eIDStr, ok := eIDAttr.(string); ok {
+			externalID = optional.NewString(eIDStr)
+		}
+	}
+
+	// other attributes
+	attributes = cleanMap(data)
+
+	// meta
+	if m, ok := getMap(data["meta"]); ok {
+		// some stores lowercase the names of the meta data, e.g. "lastmodified"
+		metaAttr := make(map[string]string, len(m))
+		for k, v := range m {
+			metaAttr[strings.ToLower(k)], _ = v.(string)
+		}
+		resourceType, ok := metaAttr["resourcetype"]
+		if !ok {
+			return
+		}
+		location, ok := metaAttr["location"]
+		if !ok {
+			return
+		}
+		meta.ResourceType = resourceType
+		meta.Location = location
+		if created, ok := metaAttr["created"]; ok {
+			createdTime, _ := time.Parse(time.RFC3339, created)
+			meta.Created = &createdTime
+		}
+		if lastModified, ok := metaAttr["lastmodified"]; ok {
+			lastModifiedTime, _ := time.Parse(time.RFC3339, lastModified)
+			meta.LastModified = &lastModifiedTime
+		}
+		if version, ok := metaAttr["version"]; ok {
+			meta.Version = version
+		}
+	}
+	return
+}
+
+// resourceFromData returns the resource of the given data, e.g. that of a stored resource.
+func resourceFromData(data map[string]interface{}) scim.Resource {
+	id, externalID, attributes, meta := extractResourceData(data)
+	return scim.Resource{
+		ID:         id,
+		ExternalID: externalID,
+		Attributes: attributes,
+		Meta:       meta,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// storedResourceType is a resource type together with the store in which its resources are stored.
+type storedResourceType struct {
+	resourceType scim.ResourceType
+	store        scim.Store
+}
+
+// storedResourceTypes returns the resource types of the server, together with their stores.
+func storedResourceTypes(users scim.Store, groups scim.Store) []storedResourceType {
+	return []storedResourceType{
+		{resourceType: UserResourceType, store: users},
+		{resourceType: GroupResourceType, store: groups},
+	}
+}
+
+// checkUniqueness checks that no other resource has one of the values of the unique attributes of the resource with
+// the given id. Values of globally unique attributes are also compared with those of the resources of the other
+// resource types that define the same attribute.
+func checkUniqueness(ctx context.Context, stored []storedResourceType, resourceType scim.ResourceType, id string, attributes scim.ResourceAttributes) error {
+	for _, attribute := range resourceType.UniqueAttributes() {
+		values := attribute.Values(attributes)
+		if len(values) == 0 {
+			continue
+		}
+
+		for _, s := range stored {
+			if s.resourceType.Name != resourceType.Name && !(attribute.Global && definesUnique(s.resourceType, attribute)) {
+				continue
+			}
+			inUse, err := s.store.InUse(ctx, attribute, id, values)
+			if err != nil {
+				return scim.StoreError(err)
+			}
+			if inUse {
+				return errors.ScimError{
+					ScimType: errors.ScimTypeUniqueness,
+					Detail:   fmt.Sprintf("The value of %s is already in use.", attribute.Path()),
+					Status:   http.StatusConflict,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// definesUnique returns whether the resource type defines the given unique attribute.
+func definesUnique(resourceType scim.ResourceType, attribute scim.UniqueAttribute) bool {
+	for _, unique := range resourceType.UniqueAttributes() {
+		if unique.Path() == attribute.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+// valuesFilter returns the filter that matches the resources of which the attribute with the given path, e.g.
+// "members.value", equals one of the given values. There has to be at least one value, as a nil filter would match all
+// resources.
+func valuesFilter(path string, values []string) filter.Expression {
+	attributePath := filter.AttributePath{AttributeName: path}
+	if i := strings.Index(path, "."); i != -1 {
+		attributePath = filter.AttributePath{AttributeName: path[:i], SubAttribute: path[i+1:]}
+	}
+
+	var expression filter.Expression
+	for _, value := range values {
+		equals := filter.AttributeExpression{
+			AttributePath:   attributePath,
+			CompareOperator: filter.EQ,
+			CompareValue:    value,
+		}
+		if expression == nil {
+			expression = equals
+			continue
+		}
+		expression = filter.BinaryExpression{X: expression, CompareOperator: filter.OR, Y: equals}
+	}
+	return expression
+}
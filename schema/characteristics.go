@@ -6,14 +6,12 @@ import (
 	"regexp"
 )
 
-func checkAttributeName(name string) {
-	// starts w/ a A-Za-z followed by a A-Za-z0-9, a dollar sign, a hyphen or an underscore
-	match, err := regexp.MatchString(`^[A-Za-z][\w$-]*$`, name)
-	if err != nil {
-		panic(err)
-	}
+// attributeNamePattern matches valid attribute names: starts w/ a A-Za-z followed by a A-Za-z0-9, a dollar sign, a
+// hyphen or an underscore.
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z][\w$-]*$`)
 
-	if !match {
+func checkAttributeName(name string) {
+	if !attributeNamePattern.MatchString(name) {
 		panic(fmt.Sprintf("invalid attribute name %q", name))
 	}
 }
@@ -162,23 +160,27 @@ const (
 )
 
 func (a attributeType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a attributeType) String() string {
 	switch a {
 	case attributeDataTypeDecimal:
-		return json.Marshal("decimal")
+		return "decimal"
 	case attributeDataTypeInteger:
-		return json.Marshal("integer")
+		return "integer"
 	case attributeDataTypeBinary:
-		return json.Marshal("binary")
+		return "binary"
 	case attributeDataTypeBoolean:
-		return json.Marshal("boolean")
+		return "boolean"
 	case attributeDataTypeComplex:
-		return json.Marshal("complex")
+		return "complex"
 	case attributeDataTypeDateTime:
-		return json.Marshal("dateTime")
+		return "dateTime"
 	case attributeDataTypeReference:
-		return json.Marshal("reference")
+		return "reference"
 	default:
-		return json.Marshal("string")
+		return "string"
 	}
 }
 
@@ -90,31 +90,84 @@ type CoreAttribute struct {
 	uniqueness      attributeUniqueness
 }
 
-func (a CoreAttribute) validate(attribute interface{}) (interface{}, *errors.ScimError) {
-	// return false if the attribute is not present but required.
+// AttributeType returns the data type of the attribute, e.g. "string", "complex" or "dateTime".
+func (a CoreAttribute) AttributeType() string {
+	return a.typ.String()
+}
+
+// CaseExact returns whether string values of the attribute are case sensitive.
+func (a CoreAttribute) CaseExact() bool {
+	return a.caseExact
+}
+
+// MultiValued returns whether the attribute is multi-valued.
+func (a CoreAttribute) MultiValued() bool {
+	return a.multiValued
+}
+
+// Mutability returns the circumstances under which the value of the attribute can be (re)defined.
+func (a CoreAttribute) Mutability() AttributeMutability {
+	return AttributeMutability{m: a.mutability}
+}
+
+// Name returns the name of the attribute.
+func (a CoreAttribute) Name() string {
+	return a.name
+}
+
+// Returned returns the circumstances under which the attribute and its values are returned in a response.
+func (a CoreAttribute) Returned() AttributeReturned {
+	return AttributeReturned{r: a.returned}
+}
+
+// SubAttributes returns the sub-attributes of a complex attribute.
+func (a CoreAttribute) SubAttributes() []CoreAttribute {
+	return a.subAttributes
+}
+
+// SubAttribute returns the sub-attribute with given name, matched case-insensitively.
+func (a CoreAttribute) SubAttribute(name string) (CoreAttribute, bool) {
+	for _, sub := range a.subAttributes {
+		if strings.EqualFold(sub.name, name) {
+			return sub, true
+		}
+	}
+	return CoreAttribute{}, false
+}
+
+// Uniqueness returns how the service provider enforces the uniqueness of the values of the attribute.
+func (a CoreAttribute) Uniqueness() AttributeUniqueness {
+	return AttributeUniqueness{u: a.uniqueness}
+}
+
+// validate validates the value of the attribute. The path is the path of the attribute that is reported in the detail
+// of the returned error, e.g. "emails[1].value".
+func (a CoreAttribute) validate(path string, attribute interface{}) (interface{}, *errors.ScimError) {
+	// return false if the attribute is not present but required. Read only attributes are defined by the service
+	// provider, so they are never required in a request.
 	if attribute == nil {
-		if !a.required {
+		if !a.required || a.mutability == attributeMutabilityReadOnly {
 			return nil, nil
 		}
 
-		return nil, &errors.ScimErrorInvalidValue
+		return nil, invalidValue(errors.FieldError{Path: path, Reason: "is required"})
 	}
 
 	if a.multiValued {
 		// return false if the multivalued attribute is not a slice.
 		arr, ok := attribute.([]interface{})
 		if !ok {
-			return nil, &errors.ScimErrorInvalidSyntax
+			return nil, invalidSyntax(errors.FieldError{Path: path, Expected: "array", Reason: got(attribute)})
 		}
 
 		// return false if the multivalued attribute is empty.
 		if a.required && len(arr) == 0 {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, invalidValue(errors.FieldError{Path: path, Reason: "requires at least one value"})
 		}
 
 		attributes := make([]interface{}, 0)
-		for _, ele := range arr {
-			attr, scimErr := a.validateSingular(ele)
+		for i, ele := range arr {
+			attr, scimErr := a.validateSingular(fmt.Sprintf("%s[%d]", path, i), ele)
 			if scimErr != nil {
 				return nil, scimErr
 			}
@@ -125,15 +178,19 @@ func (a CoreAttribute) validate(attribute interface{}) (interface{}, *errors.Sci
 		return attributes, nil
 	}
 
-	return a.validateSingular(attribute)
+	return a.validateSingular(path, attribute)
 }
 
-func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *errors.ScimError) {
+func (a CoreAttribute) validateSingular(path string, attribute interface{}) (interface{}, *errors.ScimError) {
+	mismatch := func() *errors.ScimError {
+		return invalidValue(errors.FieldError{Path: path, Expected: a.typ.String(), Reason: got(attribute)})
+	}
+
 	switch a.typ {
 	case attributeDataTypeBinary:
 		bin, ok := attribute.(string)
 		if !ok {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 
 		match, err := regexp.MatchString(`^([A-Za-z0-9+/]{4})*([A-Za-z0-9+/]{3}=|[A-Za-z0-9+/]{2}==)?$`, bin)
@@ -142,21 +199,21 @@ func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *er
 		}
 
 		if !match {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, invalidValue(errors.FieldError{Path: path, Expected: "base64 encoded binary", Reason: got(attribute)})
 		}
 
 		return bin, nil
 	case attributeDataTypeBoolean:
 		b, ok := attribute.(bool)
 		if !ok {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 
 		return b, nil
 	case attributeDataTypeComplex:
 		complex, ok := attribute.(map[string]interface{})
 		if !ok {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 
 		attributes := make(map[string]interface{})
@@ -168,7 +225,7 @@ func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *er
 			for k, v := range complex {
 				if strings.EqualFold(sub.name, k) {
 					if found {
-						return nil, &errors.ScimErrorInvalidSyntax
+						return nil, invalidSyntax(errors.FieldError{Path: path + "." + sub.name, Reason: "is specified more than once"})
 					}
 
 					found = true
@@ -176,7 +233,7 @@ func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *er
 				}
 			}
 
-			attr, scimErr := sub.validate(hit)
+			attr, scimErr := sub.validate(path+"."+sub.name, hit)
 			if scimErr != nil {
 				return nil, scimErr
 			}
@@ -187,11 +244,11 @@ func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *er
 	case attributeDataTypeDateTime:
 		date, ok := attribute.(string)
 		if !ok {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 		_, err := datetime.Parse(date)
 		if err != nil {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 
 		return date, nil
@@ -200,41 +257,76 @@ func (a CoreAttribute) validateSingular(attribute interface{}) (interface{}, *er
 		case json.Number:
 			f, err := n.Float64()
 			if err != nil {
-				return nil, &errors.ScimErrorInvalidValue
+				return nil, mismatch()
 			}
 
 			return f, nil
 		case float64:
 			return n, nil
 		default:
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 	case attributeDataTypeInteger:
 		switch n := attribute.(type) {
 		case json.Number:
 			i, err := n.Int64()
 			if err != nil {
-				return nil, &errors.ScimErrorInvalidValue
+				return nil, mismatch()
 			}
 
 			return i, nil
 		case int, int8, int16, int32, int64:
 			return n, nil
 		default:
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 	case attributeDataTypeString, attributeDataTypeReference:
 		s, ok := attribute.(string)
 		if !ok {
-			return nil, &errors.ScimErrorInvalidValue
+			return nil, mismatch()
 		}
 
 		return s, nil
 	default:
-		return nil, &errors.ScimErrorInvalidSyntax
+		return nil, invalidSyntax(errors.FieldError{Path: path, Reason: "has an unknown data type"})
 	}
 }
 
+// got describes the given value for a field error: its JSON type, followed by the value itself if it is a string or a
+// number, e.g. `got string "work"`.
+func got(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "got null"
+	case string:
+		return fmt.Sprintf("got string %q", v)
+	case bool:
+		return "got boolean"
+	case json.Number:
+		return fmt.Sprintf("got number %s", v)
+	case float32, float64, int, int8, int16, int32, int64:
+		return fmt.Sprintf("got number %v", v)
+	case []interface{}:
+		return "got array"
+	case map[string]interface{}:
+		return "got object"
+	default:
+		return fmt.Sprintf("got %T", v)
+	}
+}
+
+// invalidValue returns an invalid value error with the field error as detail.
+func invalidValue(field errors.FieldError) *errors.ScimError {
+	scimErr := errors.ScimErrorInvalidField(errors.ScimTypeInvalidValue, field)
+	return &scimErr
+}
+
+// invalidSyntax returns an invalid syntax error with the field error as detail.
+func invalidSyntax(field errors.FieldError) *errors.ScimError {
+	scimErr := errors.ScimErrorInvalidField(errors.ScimTypeInvalidSyntax, field)
+	return &scimErr
+}
+
 func (a *CoreAttribute) getRawAttributes() map[string]interface{} {
 	attributes := map[string]interface{}{
 		"description": a.description.Value(),
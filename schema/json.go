@@ -0,0 +1,172 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/optional"
+)
+
+// FromJSON creates a schema from its JSON representation as defined in RFC 7643 section 7, e.g. as returned by
+// Schema.MarshalJSON. Characteristics that are omitted get the same default values as attributes that are created with
+// SimpleCoreAttribute and ComplexCoreAttribute.
+func FromJSON(data []byte) (Schema, error) {
+	var raw struct {
+		ID          string
+		Name        *string
+		Description *string
+		Attributes  []rawAttribute
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Schema{}, err
+	}
+	if raw.ID == "" {
+		return Schema{}, fmt.Errorf("schema has no id")
+	}
+
+	s := Schema{
+		ID:          raw.ID,
+		Name:        optionalString(raw.Name),
+		Description: optionalString(raw.Description),
+	}
+	names := make(map[string]bool)
+	for _, rawAttr := range raw.Attributes {
+		if !attributeNamePattern.MatchString(rawAttr.Name) {
+			return Schema{}, fmt.Errorf("schema %s: invalid attribute name %q", raw.ID, rawAttr.Name)
+		}
+		if names[strings.ToLower(rawAttr.Name)] {
+			return Schema{}, fmt.Errorf("schema %s: duplicate attribute name %q", raw.ID, rawAttr.Name)
+		}
+		names[strings.ToLower(rawAttr.Name)] = true
+
+		attr, err := rawAttr.coreAttribute(true)
+		if err != nil {
+			return Schema{}, fmt.Errorf("schema %s: %v", raw.ID, err)
+		}
+		s.Attributes = append(s.Attributes, attr)
+	}
+	return s, nil
+}
+
+// rawAttribute is the JSON representation of an attribute definition.
+type rawAttribute struct {
+	Name            string
+	Type            string
+	SubAttributes   []rawAttribute
+	MultiValued     bool
+	Description     *string
+	Required        bool
+	CanonicalValues []string
+	CaseExact       *bool
+	Mutability      string
+	Returned        string
+	Uniqueness      string
+	ReferenceTypes  []AttributeReferenceType
+}
+
+// coreAttribute converts the JSON representation to an attribute. Sub-attributes are only allowed if allowComplex
+// is true, as sub-attributes can not be complex themselves.
+func (raw rawAttribute) coreAttribute(allowComplex bool) (CoreAttribute, error) {
+	typ, err := parseKeyword(raw.Name, "type", raw.Type, attributeDataTypeString.String(), []keyword{
+		attributeDataTypeBinary, attributeDataTypeBoolean, attributeDataTypeComplex, attributeDataTypeDateTime,
+		attributeDataTypeDecimal, attributeDataTypeInteger, attributeDataTypeReference, attributeDataTypeString,
+	})
+	if err != nil {
+		return CoreAttribute{}, err
+	}
+	mutability, err := parseKeyword(raw.Name, "mutability", raw.Mutability, "readWrite", []keyword{
+		attributeMutabilityReadWrite, attributeMutabilityImmutable, attributeMutabilityReadOnly, attributeMutabilityWriteOnly,
+	})
+	if err != nil {
+		return CoreAttribute{}, err
+	}
+	returned, err := parseKeyword(raw.Name, "returned", raw.Returned, "default", []keyword{
+		attributeReturnedDefault, attributeReturnedAlways, attributeReturnedNever, attributeReturnedRequest,
+	})
+	if err != nil {
+		return CoreAttribute{}, err
+	}
+	uniqueness, err := parseKeyword(raw.Name, "uniqueness", raw.Uniqueness, "none", []keyword{
+		attributeUniquenessNone, attributeUniquenessServer, attributeUniquenessGlobal,
+	})
+	if err != nil {
+		return CoreAttribute{}, err
+	}
+
+	attr := CoreAttribute{
+		canonicalValues: raw.CanonicalValues,
+		caseExact:       raw.caseExact(typ.(attributeType)),
+		description:     optionalString(raw.Description),
+		multiValued:     raw.MultiValued,
+		mutability:      mutability.(attributeMutability),
+		name:            raw.Name,
+		referenceTypes:  raw.ReferenceTypes,
+		required:        raw.Required,
+		returned:        returned.(attributeReturned),
+		typ:             typ.(attributeType),
+		uniqueness:      uniqueness.(attributeUniqueness),
+	}
+
+	if attr.typ != attributeDataTypeComplex {
+		if len(raw.SubAttributes) != 0 {
+			return CoreAttribute{}, fmt.Errorf("attribute %q has sub-attributes, but is not complex", raw.Name)
+		}
+		return attr, nil
+	}
+	if !allowComplex {
+		return CoreAttribute{}, fmt.Errorf("sub-attribute %q can not be complex", raw.Name)
+	}
+
+	names := make(map[string]bool)
+	for _, rawSub := range raw.SubAttributes {
+		if rawSub.Name == "" || names[strings.ToLower(rawSub.Name)] {
+			return CoreAttribute{}, fmt.Errorf("attribute %q has an invalid or duplicate sub-attribute name %q", raw.Name, rawSub.Name)
+		}
+		names[strings.ToLower(rawSub.Name)] = true
+
+		sub, err := rawSub.coreAttribute(false)
+		if err != nil {
+			return CoreAttribute{}, err
+		}
+		attr.subAttributes = append(attr.subAttributes, sub)
+	}
+	return attr, nil
+}
+
+// caseExact returns whether the attribute is case exact. If it is not specified, binaries and references are case
+// exact, like the attributes created with SimpleBinaryParams and SimpleReferenceParams.
+func (raw rawAttribute) caseExact(typ attributeType) bool {
+	if raw.CaseExact != nil {
+		return *raw.CaseExact
+	}
+	return typ == attributeDataTypeBinary || typ == attributeDataTypeReference
+}
+
+// keyword is a characteristic of an attribute, of which the JSON representation is a keyword such as "readOnly".
+type keyword interface {
+	MarshalJSON() ([]byte, error)
+}
+
+// parseKeyword returns the characteristic of which the JSON representation is the given keyword. If the keyword is
+// empty, the characteristic with the default keyword is returned.
+func parseKeyword(name, characteristic, value, defaultValue string, keywords []keyword) (keyword, error) {
+	if value == "" {
+		value = defaultValue
+	}
+	for _, k := range keywords {
+		raw, _ := k.MarshalJSON()
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil && s == value {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("attribute %q has an invalid %s %q", name, characteristic, value)
+}
+
+func optionalString(s *string) optional.String {
+	if s == nil {
+		return optional.String{}
+	}
+	return optional.NewString(*s)
+}
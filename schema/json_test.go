@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestFromJSON(t *testing.T) {
+	for _, test := range []struct {
+		file   string
+		schema Schema
+	}{
+		{file: "user_schema.json", schema: CoreUserSchema()},
+		{file: "group_schema.json", schema: CoreGroupSchema()},
+		{file: "enterprise_user_schema.json", schema: ExtensionEnterpriseUser()},
+	} {
+		raw, err := ioutil.ReadFile(fmt.Sprintf("./testdata/%s", test.file))
+		if err != nil {
+			t.Errorf("Failed to acquire test data")
+			return
+		}
+
+		s, err := FromJSON(raw)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.file, err)
+			continue
+		}
+
+		actualJSON, _ := s.MarshalJSON()
+		expectedJSON, _ := test.schema.MarshalJSON()
+		normalizedActual, err := normalizeJSON(actualJSON)
+		normalizedExpected, expectedErr := normalizeJSON(expectedJSON)
+		if err != nil || expectedErr != nil {
+			t.Errorf("Failed to normalize test JSON")
+			return
+		}
+		if normalizedActual != normalizedExpected {
+			t.Errorf("%s: schema did not round trip. Want %s, Got %s", test.file, normalizedExpected, normalizedActual)
+		}
+	}
+}
+
+func TestFromJSONDefaults(t *testing.T) {
+	s, err := FromJSON([]byte(`{
+		"id": "urn:example:Device",
+		"attributes": [
+			{"name": "serial", "type": "string", "uniqueness": "global", "mutability": "immutable"},
+			{"name": "owner", "type": "complex", "subAttributes": [
+				{"name": "$ref", "type": "reference", "referenceTypes": ["User"]}
+			]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Schema{
+		ID: "urn:example:Device",
+		Attributes: []CoreAttribute{
+			SimpleCoreAttribute(SimpleStringParams(StringParams{
+				Name:       "serial",
+				Mutability: AttributeMutabilityImmutable(),
+				Uniqueness: AttributeUniquenessGlobal(),
+			})),
+			ComplexCoreAttribute(ComplexParams{
+				Name: "owner",
+				SubAttributes: []SimpleParams{
+					SimpleReferenceParams(ReferenceParams{
+						Name:           "$ref",
+						ReferenceTypes: []AttributeReferenceType{"User"},
+					}),
+				},
+			}),
+		},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("Want %v, Got %v", expected, s)
+	}
+}
+
+func TestFromJSONInvalid(t *testing.T) {
+	for _, raw := range []string{
+		`[]`,
+		`{"attributes": []}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "_serial", "type": "string"}]}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "serial", "type": "text"}]}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "serial", "mutability": "writeable"}]}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "serial"}, {"name": "Serial"}]}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "serial", "subAttributes": [{"name": "value"}]}]}`,
+		`{"id": "urn:example:Device", "attributes": [{"name": "owner", "type": "complex", "subAttributes": [
+			{"name": "address", "type": "complex"}
+		]}]}`,
+	} {
+		if _, err := FromJSON([]byte(raw)); err == nil {
+			t.Errorf("error expected for %s", raw)
+		}
+	}
+}
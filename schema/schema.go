@@ -22,6 +22,9 @@ type Schema struct {
 	Description optional.String
 	ID          string
 	Name        optional.String
+	// Strict indicates that values of attributes with canonical values have to be one of those values, and that
+	// references have to be of one of the reference types of their attribute.
+	Strict bool
 }
 
 // Validate validates given resource based on the schema.
@@ -38,17 +41,22 @@ func (s Schema) Validate(resource interface{}) (map[string]interface{}, *errors.
 		for k, v := range core {
 			if strings.EqualFold(attribute.name, k) {
 				if found {
-					return nil, &errors.ScimErrorInvalidSyntax
+					return nil, invalidSyntax(errors.FieldError{Path: attribute.name, Reason: "is specified more than once"})
 				}
 				found = true
 				hit = v
 			}
 		}
 
-		attr, scimErr := attribute.validate(hit)
+		attr, scimErr := attribute.validate(attribute.name, hit)
 		if scimErr != nil {
 			return nil, scimErr
 		}
+		if s.Strict {
+			if scimErr := attribute.validateStrict(attribute.name, attr); scimErr != nil {
+				return nil, scimErr
+			}
+		}
 		attributes[attribute.name] = attr
 	}
 	return attributes, nil
@@ -58,7 +66,6 @@ func (s Schema) Validate(resource interface{}) (map[string]interface{}, *errors.
 func (s Schema) ValidatePatchOperation(operation string, operationValue map[string]interface{}, isExtension bool) *errors.ScimError {
 	for k, v := range operationValue {
 		var attr *CoreAttribute
-		var scimErr *errors.ScimError
 
 		for _, attribute := range s.Attributes {
 			if strings.EqualFold(attribute.name, k) {
@@ -73,18 +80,27 @@ func (s Schema) ValidatePatchOperation(operation string, operationValue map[stri
 
 		// Attribute does not exist in the schema, thus it is an invalid request.
 		// Immutable attrs can only be added and Readonly attrs cannot be patched
-		if attr == nil || cannotBePatched(operation, *attr) {
-			return &errors.ScimErrorInvalidValue
+		if attr == nil {
+			return invalidValue(errors.FieldError{Path: k, Reason: "is not defined by the schema"})
+		}
+		if cannotBePatched(operation, *attr) {
+			return invalidValue(errors.FieldError{Path: k, Reason: "can not be modified by a " + operation + " operation"})
 		}
 
 		// "remove" operations simply have to exist
-		if operation != "remove" {
-			_, scimErr = attr.validate(v)
+		if operation == "remove" {
+			continue
 		}
 
+		validated, scimErr := attr.validate(attr.name, v)
 		if scimErr != nil {
 			return scimErr
 		}
+		if s.Strict {
+			if scimErr := attr.validateStrict(attr.name, validated); scimErr != nil {
+				return scimErr
+			}
+		}
 	}
 
 	return nil
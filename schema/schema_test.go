@@ -265,3 +265,47 @@ func normalizeJSON(rawJSON []byte) (string, error) {
 
 	return string(ret), err
 }
+
+func TestValidationErrorDetail(t *testing.T) {
+	for _, test := range []struct {
+		resource map[string]interface{}
+		detail   string
+	}{
+		{
+			resource: map[string]interface{}{"booleans": []interface{}{true}},
+			detail:   "required: is required",
+		},
+		{
+			resource: map[string]interface{}{"required": "present", "booleans": []interface{}{true, "false"}},
+			detail:   `booleans[1]: expected boolean, got string "false"`,
+		},
+		{
+			resource: map[string]interface{}{"required": "present", "booleans": true},
+			detail:   "booleans: expected array, got boolean",
+		},
+		{
+			resource: map[string]interface{}{
+				"required": "present",
+				"booleans": []interface{}{true},
+				"complex": []interface{}{
+					map[string]interface{}{"sub": "present"},
+					map[string]interface{}{"sub": json.Number("1")},
+				},
+			},
+			detail: "complex[1].sub: expected string, got number 1",
+		},
+		{
+			resource: map[string]interface{}{"required": "present", "booleans": []interface{}{true}, "integer": 1.1},
+			detail:   "integer: expected integer, got number 1.1",
+		},
+	} {
+		_, scimErr := testSchema.Validate(test.resource)
+		if scimErr == nil {
+			t.Errorf("invalid resource expected: %v", test.resource)
+			continue
+		}
+		if scimErr.Detail != test.detail {
+			t.Errorf("got detail %q, expected %q", scimErr.Detail, test.detail)
+		}
+	}
+}
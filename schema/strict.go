@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+)
+
+// validateStrict checks that the validated value of the attribute only contains canonical values, if the attribute
+// has any, and references of the declared reference types. The path is the name by which the attribute is referred to
+// in the detail of the returned error, e.g. "emails.type".
+func (a CoreAttribute) validateStrict(path string, value interface{}) *errors.ScimError {
+	if value == nil {
+		return nil
+	}
+
+	if values, ok := value.([]interface{}); ok && a.multiValued {
+		for i, v := range values {
+			if scimErr := a.validateStrictSingular(fmt.Sprintf("%s[%d]", path, i), v); scimErr != nil {
+				return scimErr
+			}
+		}
+		return nil
+	}
+	return a.validateStrictSingular(path, value)
+}
+
+func (a CoreAttribute) validateStrictSingular(path string, value interface{}) *errors.ScimError {
+	switch a.typ {
+	case attributeDataTypeComplex:
+		complex, _ := value.(map[string]interface{})
+		for _, sub := range a.subAttributes {
+			if scimErr := sub.validateStrict(path+"."+sub.name, complex[sub.name]); scimErr != nil {
+				return scimErr
+			}
+		}
+	case attributeDataTypeReference:
+		reference, _ := value.(string)
+		if len(a.referenceTypes) != 0 && !isReferenceOfType(reference, a.referenceTypes) {
+			return invalidValue(errors.FieldError{
+				Path:     path,
+				Expected: "reference of type " + joinReferenceTypes(a.referenceTypes),
+				Reason:   got(reference),
+			})
+		}
+	case attributeDataTypeString:
+		s, _ := value.(string)
+		if len(a.canonicalValues) != 0 && !a.isCanonical(s) {
+			return invalidValue(errors.FieldError{
+				Path:     path,
+				Expected: "one of " + strings.Join(a.canonicalValues, ", "),
+				Reason:   got(s),
+			})
+		}
+	}
+	return nil
+}
+
+// isCanonical returns whether the value is one of the canonical values of the attribute. The values are compared
+// case-insensitively if the attribute is not case exact.
+func (a CoreAttribute) isCanonical(value string) bool {
+	for _, canonical := range a.canonicalValues {
+		if canonical == value || (!a.caseExact && strings.EqualFold(canonical, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReferenceOfType returns whether the reference is of one of the given reference types. An "external" reference is
+// an absolute URL and a "uri" reference any URI. Other types are names of resource types, of which the references are
+// URIs that end in "{endpoint}/{id}". The endpoint is the name of the resource type, or its plural, e.g. "Users/2819c223".
+func isReferenceOfType(reference string, types []AttributeReferenceType) bool {
+	u, err := url.Parse(reference)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		switch t {
+		case AttributeReferenceTypeExternal:
+			if u.IsAbs() && u.Host != "" {
+				return true
+			}
+		case AttributeReferenceTypeURI:
+			return true
+		default:
+			segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+			if len(segments) < 2 || segments[len(segments)-1] == "" {
+				continue
+			}
+			endpoint := segments[len(segments)-2]
+			if strings.EqualFold(endpoint, string(t)) || strings.EqualFold(endpoint, string(t)+"s") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinReferenceTypes(types []AttributeReferenceType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, " or ")
+}
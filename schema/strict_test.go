@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+var testStrictSchema = Schema{
+	ID:     "urn:example:Strict",
+	Strict: true,
+	Attributes: []CoreAttribute{
+		ComplexCoreAttribute(ComplexParams{
+			MultiValued: true,
+			Name:        "emails",
+			SubAttributes: []SimpleParams{
+				SimpleStringParams(StringParams{Name: "value"}),
+				SimpleStringParams(StringParams{
+					CanonicalValues: []string{"work", "home", "other"},
+					Name:            "type",
+				}),
+			},
+		}),
+		SimpleCoreAttribute(SimpleStringParams(StringParams{
+			CanonicalValues: []string{"A", "B"},
+			CaseExact:       true,
+			Name:            "grade",
+		})),
+		SimpleCoreAttribute(SimpleReferenceParams(ReferenceParams{
+			Name:           "photo",
+			ReferenceTypes: []AttributeReferenceType{AttributeReferenceTypeExternal},
+		})),
+		SimpleCoreAttribute(SimpleReferenceParams(ReferenceParams{
+			Name:           "manager",
+			ReferenceTypes: []AttributeReferenceType{"User", "Group"},
+		})),
+	},
+}
+
+func TestStrictValidationValid(t *testing.T) {
+	for _, test := range []map[string]interface{}{
+		{
+			"emails": []interface{}{
+				map[string]interface{}{"value": "bjensen@example.com", "type": "work"},
+				map[string]interface{}{"value": "babs@example.com", "type": "Home"},
+				map[string]interface{}{"value": "barbara@example.com"},
+			},
+		},
+		{"grade": "A"},
+		{"photo": "https://photos.example.com/profilephoto/72930000000Ccne/F"},
+		{"manager": "../Users/26118915-6090-4610-87e4-49d8ca9f808d"},
+		{"manager": "https://example.com/v2/Groups/e9e30dba"},
+	} {
+		if _, scimErr := testStrictSchema.Validate(test); scimErr != nil {
+			t.Errorf("valid resource expected, got %v: %v", scimErr, test)
+		}
+	}
+}
+
+func TestStrictValidationInvalid(t *testing.T) {
+	for _, test := range []struct {
+		resource  map[string]interface{}
+		attribute string
+	}{
+		{
+			resource: map[string]interface{}{
+				"emails": []interface{}{
+					map[string]interface{}{"value": "bjensen@example.com", "type": "office"},
+				},
+			},
+			attribute: "emails[0].type",
+		},
+		{resource: map[string]interface{}{"grade": "a"}, attribute: "grade"},
+		{resource: map[string]interface{}{"photo": "/photos/72930000000Ccne"}, attribute: "photo"},
+		{resource: map[string]interface{}{"manager": "../Devices/26118915"}, attribute: "manager"},
+		{resource: map[string]interface{}{"manager": "26118915"}, attribute: "manager"},
+	} {
+		_, scimErr := testStrictSchema.Validate(test.resource)
+		if scimErr == nil {
+			t.Errorf("invalid resource expected: %v", test.resource)
+			continue
+		}
+		if scimErr.Status != 400 || !strings.Contains(scimErr.Detail, test.attribute) {
+			t.Errorf("invalid value error for %s expected, got %v", test.attribute, scimErr)
+		}
+	}
+
+	// Values outside of the canonical values are accepted if the schema is not strict.
+	lenient := testStrictSchema
+	lenient.Strict = false
+	if _, scimErr := lenient.Validate(map[string]interface{}{"grade": "C"}); scimErr != nil {
+		t.Errorf("valid resource expected, got %v", scimErr)
+	}
+}
+
+func TestStrictValidatePatchOperation(t *testing.T) {
+	if scimErr := testStrictSchema.ValidatePatchOperationValue("add", map[string]interface{}{
+		"emails": []interface{}{map[string]interface{}{"value": "bjensen@example.com", "type": "office"}},
+	}); scimErr == nil {
+		t.Error("invalid operation value expected")
+	}
+	if scimErr := testStrictSchema.ValidatePatchOperationValue("replace", map[string]interface{}{
+		"grade": "B",
+	}); scimErr != nil {
+		t.Errorf("valid operation value expected, got %v", scimErr)
+	}
+}
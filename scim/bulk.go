@@ -0,0 +1,387 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+)
+
+const (
+	bulkRequestSchema  = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	bulkResponseSchema = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+)
+
+// bulkIDPrefix is the prefix of the temporary identifiers, e.g. "bulkId:qwerty", with which an operation references a
+// resource that is created by another operation of the same bulk request.
+const bulkIDPrefix = "bulkId:"
+
+// bulkRequest represents a bulk request as defined in RFC 7644 section 3.7.
+type bulkRequest struct {
+	Schemas []string
+	// FailOnErrors is the number of errors that the service provider accepts before the remaining operations are
+	// no longer processed. If it is not set, all the operations are processed.
+	FailOnErrors int
+	// Operations are the operations to perform, in the order they are specified.
+	Operations []bulkOperation
+}
+
+// bulkOperation is a single operation of a bulk request.
+type bulkOperation struct {
+	// Method is the HTTP method of the operation: "POST", "PUT", "PATCH" or "DELETE".
+	Method string
+	// BulkID is the transient identifier of a resource that is created by the operation. It is required for "POST".
+	BulkID string `json:"bulkId"`
+	// Version is the entity tag the current version of the resource has to match, like the "If-Match" header.
+	Version string
+	// Path is the resource endpoint, e.g. "/Users" or "/Users/2819c223".
+	Path string
+	// Data is the body of the operation, e.g. the resource to create or the patch request.
+	Data json.RawMessage
+}
+
+// bulkOperationResponse is the result of a single bulk operation.
+type bulkOperationResponse struct {
+	Method   string      `json:"method"`
+	BulkID   string      `json:"bulkId,omitempty"`
+	Version  string      `json:"version,omitempty"`
+	Location string      `json:"location,omitempty"`
+	Status   string      `json:"status"`
+	Response interface{} `json:"response,omitempty"`
+}
+
+// bulkResponse identifies a bulk response.
+type bulkResponse struct {
+	// Operations are the results of the operations that were processed, in the order of the request.
+	Operations []bulkOperationResponse
+}
+
+// duplicateBulkID returns a bulkId that is used by more than one operation of the request, if there is one.
+func (b bulkRequest) duplicateBulkID() (string, bool) {
+	bulkIDs := make(map[string]bool, len(b.Operations))
+	for _, op := range b.Operations {
+		if op.BulkID == "" {
+			continue
+		}
+		if bulkIDs[op.BulkID] {
+			return op.BulkID, true
+		}
+		bulkIDs[op.BulkID] = true
+	}
+	return "", false
+}
+
+func (b bulkResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"schemas":    []string{bulkResponseSchema},
+		"Operations": b.Operations,
+	})
+}
+
+// bulk performs the operations of a bulk request. Operations that reference a resource created by a later operation
+// are postponed until that resource exists. The processing stops once the number of failed operations reaches the
+// "failOnErrors" threshold.
+func (s Server) bulk(r *http.Request, request bulkRequest) bulkResponse {
+	ids := make(map[string]string)
+	results := make([]*bulkOperationResponse, len(request.Operations))
+
+	var errorCount int
+	failed := func(i int, result bulkOperationResponse) bool {
+		results[i] = &result
+		if status, _ := strconv.Atoi(result.Status); status < http.StatusBadRequest {
+			return false
+		}
+		errorCount++
+		return request.FailOnErrors > 0 && errorCount >= request.FailOnErrors
+	}
+
+	pending := make([]int, len(request.Operations))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for len(pending) != 0 {
+		var postponed []int
+		for _, i := range pending {
+			op := request.Operations[i]
+
+			var result bulkOperationResponse
+			switch unresolved := unresolvedBulkIDs(op, ids); {
+			case len(unresolved) == 0:
+				result = s.bulkOperation(r, op, ids)
+			case canResolveBulkIDs(unresolved, request.Operations, results):
+				postponed = append(postponed, i)
+				continue
+			default:
+				result = bulkOperationError(op, errors.ScimError{
+					ScimType: errors.ScimTypeInvalidValue,
+					Detail:   "The operation references a bulkId that does not yield a resource.",
+					Status:   http.StatusConflict,
+				})
+			}
+
+			if failed(i, result) {
+				return collectBulkResults(results)
+			}
+		}
+
+		// None of the postponed operations can be performed, as they reference each other.
+		if len(postponed) == len(pending) {
+			for _, i := range postponed {
+				result := bulkOperationError(request.Operations[i], errors.ScimError{
+					ScimType: errors.ScimTypeInvalidValue,
+					Detail:   "The operation contains a circular bulkId reference.",
+					Status:   http.StatusConflict,
+				})
+				if failed(i, result) {
+					break
+				}
+			}
+			break
+		}
+		pending = postponed
+	}
+
+	return collectBulkResults(results)
+}
+
+// bulkOperation performs a single bulk operation by dispatching it to the handler of its path. The bulkId references
+// in the path and data are replaced by the identifiers of the resources they refer to.
+func (s Server) bulkOperation(r *http.Request, op bulkOperation, ids map[string]string) bulkOperationResponse {
+	method := strings.ToUpper(op.Method)
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return bulkOperationError(op, errors.ScimErrorBadRequest("Bulk operation has an invalid method."))
+	}
+	if method == http.MethodPost && op.BulkID == "" {
+		return bulkOperationError(op, errors.ScimErrorBadRequest("Bulk operation with method POST requires a bulkId."))
+	}
+
+	path, data := resolveBulkIDs(op, ids)
+	req, err := http.NewRequest(method, path, bytes.NewReader(data))
+	if err != nil || !strings.HasPrefix(path, "/") || !s.isResourcePath(req.URL) {
+		return bulkOperationError(op, errors.ScimErrorBadRequest("Bulk operation has an invalid path."))
+	}
+	req = req.WithContext(r.Context())
+	req.Header = r.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Match")
+	if op.Version != "" {
+		req.Header.Set("If-Match", op.Version)
+	}
+
+	w := newBulkResponseWriter()
+	s.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	result := bulkOperationResponse{
+		Method: method,
+		BulkID: op.BulkID,
+		Status: strconv.Itoa(w.status),
+	}
+	if w.status >= http.StatusBadRequest {
+		result.Response = json.RawMessage(w.body.Bytes())
+		return result
+	}
+
+	result.Version = w.Header().Get("Etag")
+	result.Location = strings.TrimPrefix(path, "/")
+	if method == http.MethodPost {
+		var resource struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(w.body.Bytes(), &resource)
+		ids[op.BulkID] = resource.ID
+		result.Location += "/" + url.PathEscape(resource.ID)
+	}
+	return result
+}
+
+// isResourcePath returns whether the URL references the endpoint of a resource type, or a resource of it, which are the
+// only targets of bulk operations. Other endpoints, such as "/Bulk" itself and those of searches, are rejected, as are
+// URLs with a query or a fragment.
+func (s Server) isResourcePath(u *url.URL) bool {
+	if u.Scheme != "" || u.Host != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return false
+	}
+
+	path := strings.TrimPrefix(u.Path, "/v2")
+	for _, resourceType := range s.ResourceTypes {
+		if path == resourceType.Endpoint {
+			return true
+		}
+		if id := strings.TrimPrefix(path, resourceType.Endpoint+"/"); id != path {
+			return id != "" && id != ".search" && !strings.Contains(id, "/")
+		}
+	}
+	return false
+}
+
+func bulkOperationError(op bulkOperation, scimErr errors.ScimError) bulkOperationResponse {
+	return bulkOperationResponse{
+		Method:   strings.ToUpper(op.Method),
+		BulkID:   op.BulkID,
+		Status:   strconv.Itoa(scimErr.Status),
+		Response: scimErr,
+	}
+}
+
+func collectBulkResults(results []*bulkOperationResponse) bulkResponse {
+	operations := make([]bulkOperationResponse, 0, len(results))
+	for _, result := range results {
+		if result != nil {
+			operations = append(operations, *result)
+		}
+	}
+	return bulkResponse{Operations: operations}
+}
+
+// unresolvedBulkIDs returns the bulkIds that are referenced by the operation, but do not yet yield a resource.
+func unresolvedBulkIDs(op bulkOperation, ids map[string]string) []string {
+	var unresolved []string
+	replaceBulkIDReferences(op, func(bulkID string) (string, bool) {
+		if _, ok := ids[bulkID]; !ok {
+			unresolved = append(unresolved, bulkID)
+		}
+		return "", false
+	})
+	return unresolved
+}
+
+// canResolveBulkIDs returns whether all the given bulkIds belong to a POST operation that has not been performed yet.
+func canResolveBulkIDs(bulkIDs []string, operations []bulkOperation, results []*bulkOperationResponse) bool {
+	for _, bulkID := range bulkIDs {
+		var found bool
+		for i, op := range operations {
+			if results[i] == nil && op.BulkID == bulkID && strings.EqualFold(op.Method, http.MethodPost) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveBulkIDs returns the path and data of the operation, in which the bulkId references that yield a resource are
+// replaced by the identifier of that resource.
+func resolveBulkIDs(op bulkOperation, ids map[string]string) (string, []byte) {
+	return replaceBulkIDReferences(op, func(bulkID string) (string, bool) {
+		id, ok := ids[bulkID]
+		return id, ok
+	})
+}
+
+// replaceBulkIDReferences calls replace for each bulkId reference in the path and data of the operation, and returns
+// the path and data in which the references are replaced by the identifiers that replace returns, unless it returns
+// false. A reference is a segment of the path, or a "value" or "$ref" attribute within the data, that consists of
+// nothing but the bulkId prefixed by "bulkId:". Data that is not valid JSON is returned as is.
+func replaceBulkIDReferences(op bulkOperation, replace func(bulkID string) (string, bool)) (string, []byte) {
+	segments := strings.Split(op.Path, "/")
+	for i, segment := range segments {
+		if bulkID, ok := bulkIDReference(segment); ok {
+			if id, ok := replace(bulkID); ok {
+				segments[i] = url.PathEscape(id)
+			}
+		}
+	}
+	path := strings.Join(segments, "/")
+
+	var data interface{}
+	d := json.NewDecoder(bytes.NewReader(op.Data))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		return path, op.Data
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return path, op.Data
+	}
+	if !replaceDataBulkIDReferences(data, replace) {
+		return path, op.Data
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return path, op.Data
+	}
+	return path, raw
+}
+
+// replaceDataBulkIDReferences replaces the bulkId references within the decoded data, like replaceBulkIDReferences. It
+// returns whether a reference has been replaced.
+func replaceDataBulkIDReferences(data interface{}, replace func(bulkID string) (string, bool)) bool {
+	var replaced bool
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for name, value := range data {
+			if strings.EqualFold(name, "value") || name == "$ref" {
+				if s, ok := value.(string); ok {
+					if bulkID, ok := bulkIDReference(s); ok {
+						if id, ok := replace(bulkID); ok {
+							data[name] = id
+							replaced = true
+						}
+						continue
+					}
+				}
+			}
+			if replaceDataBulkIDReferences(value, replace) {
+				replaced = true
+			}
+		}
+	case []interface{}:
+		for _, element := range data {
+			if replaceDataBulkIDReferences(element, replace) {
+				replaced = true
+			}
+		}
+	}
+	return replaced
+}
+
+// bulkIDReference returns the bulkId that the value references, if the value is a bulkId reference, e.g.
+// "bulkId:qwerty".
+func bulkIDReference(value string) (string, bool) {
+	if !strings.HasPrefix(value, bulkIDPrefix) || len(value) == len(bulkIDPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, bulkIDPrefix), true
+}
+
+// bulkResponseWriter records the response of a single bulk operation.
+type bulkResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBulkResponseWriter() *bulkResponseWriter {
+	return &bulkResponseWriter{header: make(http.Header)}
+}
+
+func (w *bulkResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bulkResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *bulkResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,220 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBulkServer() Server {
+	server := newTestServer()
+	server.Config.SupportBulk = true
+	server.Config.BulkMaxOperations = 5
+	server.Config.BulkMaxPayloadSize = 4096
+	return server
+}
+
+func doBulkRequest(t *testing.T, server Server, body string) (int, []map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, "/Bulk", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var response struct {
+		Schemas    []string
+		Operations []map[string]interface{}
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "json unmarshalling failed")
+	if rr.Code == http.StatusOK {
+		assert.Equal(t, []string{bulkResponseSchema}, response.Schemas)
+	}
+	return rr.Code, response.Operations
+}
+
+func TestServerBulkHandler(t *testing.T) {
+	status, operations := doBulkRequest(t, newTestBulkServer(), `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [
+			{
+				"method": "PATCH",
+				"path": "/Users/bulkId:qwerty",
+				"data": {
+					"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+					"Operations": [{"op": "replace", "path": "displayName", "value": "Alice"}]
+				}
+			},
+			{
+				"method": "POST",
+				"bulkId": "qwerty",
+				"path": "/Users",
+				"data": {"userName": "alice"}
+			},
+			{
+				"method": "DELETE",
+				"path": "/Users/0002"
+			}
+		]
+	}`)
+
+	assert.Equal(t, http.StatusOK, status, "status code mismatch")
+	assert.Len(t, operations, 3)
+
+	// The results are in the order of the request, although the POST is performed first.
+	assert.Equal(t, "PATCH", operations[0]["method"])
+	assert.Equal(t, "200", operations[0]["status"])
+	assert.Equal(t, "POST", operations[1]["method"])
+	assert.Equal(t, "201", operations[1]["status"])
+	assert.Equal(t, "qwerty", operations[1]["bulkId"])
+	assert.Equal(t, "DELETE", operations[2]["method"])
+	assert.Equal(t, "204", operations[2]["status"])
+	assert.Equal(t, "Users/0002", operations[2]["location"])
+
+	location, _ := operations[1]["location"].(string)
+	assert.True(t, strings.HasPrefix(location, "Users/"))
+	assert.Equal(t, location, operations[0]["location"])
+}
+
+func TestServerBulkHandlerFailOnErrors(t *testing.T) {
+	status, operations := doBulkRequest(t, newTestBulkServer(), `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"failOnErrors": 2,
+		"Operations": [
+			{"method": "DELETE", "path": "/Users/9998"},
+			{"method": "PUT", "path": "/Users/bulkId:unknown", "data": {"userName": "bob"}},
+			{"method": "DELETE", "path": "/Users/0001"}
+		]
+	}`)
+
+	assert.Equal(t, http.StatusOK, status, "status code mismatch")
+	assert.Len(t, operations, 2)
+	assert.Equal(t, "404", operations[0]["status"])
+	assert.Equal(t, "409", operations[1]["status"])
+
+	response, _ := operations[1]["response"].(map[string]interface{})
+	assert.Equal(t, "invalidValue", response["scimType"])
+}
+
+func TestServerBulkHandlerCircularReference(t *testing.T) {
+	status, operations := doBulkRequest(t, newTestBulkServer(), `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [
+			{"method": "POST", "bulkId": "a", "path": "/Users", "data": {"userName": "a", "emails": [{"value": "bulkId:b"}]}},
+			{"method": "POST", "bulkId": "b", "path": "/Users", "data": {"userName": "b", "emails": [{"value": "bulkId:a"}]}}
+		]
+	}`)
+
+	assert.Equal(t, http.StatusOK, status, "status code mismatch")
+	assert.Len(t, operations, 2)
+	for _, operation := range operations {
+		assert.Equal(t, "409", operation["status"])
+	}
+}
+
+func TestServerBulkHandlerReferences(t *testing.T) {
+	server := newTestBulkServer()
+	status, operations := doBulkRequest(t, server, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [
+			{
+				"method": "POST",
+				"bulkId": "b",
+				"path": "/Users",
+				"data": {"userName": "b", "displayName": "bulkId:a", "emails": [{"value": "bulkId:a", "display": "see bulkId:a"}]}
+			},
+			{"method": "POST", "bulkId": "a", "path": "/Users", "data": {"userName": "a"}}
+		]
+	}`)
+	assert.Equal(t, http.StatusOK, status, "status code mismatch")
+	if !assert.Len(t, operations, 2) {
+		return
+	}
+	assert.Equal(t, "201", operations[0]["status"])
+	id := strings.TrimPrefix(operations[1]["location"].(string), "Users/")
+
+	// Only values that consist of nothing but a bulkId reference are references.
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+operations[0]["location"].(string), nil))
+	var resource map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resource))
+	assert.Equal(t, "bulkId:a", resource["displayName"])
+	email := resource["emails"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, id, email["value"])
+	assert.Equal(t, "see bulkId:a", email["display"])
+}
+
+func TestServerBulkHandlerDuplicateBulkID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/Bulk", strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [
+			{"method": "POST", "bulkId": "a", "path": "/Users", "data": {"userName": "a"}},
+			{"method": "POST", "bulkId": "a", "path": "/Users", "data": {"userName": "b"}}
+		]
+	}`))
+	rr := httptest.NewRecorder()
+	newTestBulkServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status code mismatch")
+	assert.Contains(t, rr.Body.String(), `"scimType":"invalidValue"`)
+}
+
+func TestServerBulkHandlerLimits(t *testing.T) {
+	var operations []string
+	for i := 0; i < 6; i++ {
+		operations = append(operations, fmt.Sprintf(`{"method": "DELETE", "path": "/Users/000%d"}`, i))
+	}
+	status, _ := doBulkRequest(t, newTestBulkServer(), fmt.Sprintf(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [%s]
+	}`, strings.Join(operations, ",")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status, "status code mismatch")
+
+	status, _ = doBulkRequest(t, newTestBulkServer(), fmt.Sprintf(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [{"method": "POST", "bulkId": "a", "path": "/Users", "data": {"userName": "%s"}}]
+	}`, strings.Repeat("a", 4096)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status, "status code mismatch")
+}
+
+func TestServerBulkHandlerInvalid(t *testing.T) {
+	status, _ := doBulkRequest(t, newTestBulkServer(), `{"Operations": []}`)
+	assert.Equal(t, http.StatusBadRequest, status, "status code mismatch")
+
+	status, _ = doBulkRequest(t, newTestServer(), `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": []
+	}`)
+	assert.Equal(t, http.StatusNotImplemented, status, "status code mismatch")
+}
+
+func TestServerBulkHandlerInvalidPath(t *testing.T) {
+	for _, path := range []string{
+		"Users",
+		"/Bulk",
+		"/Bulk?",
+		"/v2/Bulk?x",
+		"/.search",
+		"/Users/.search",
+		"/Me",
+		"/Users?filter=x",
+		"/Users#x",
+		"//example.com/Users",
+		"/Users/0001/name",
+	} {
+		t.Run(path, func(t *testing.T) {
+			status, operations := doBulkRequest(t, newTestBulkServer(), fmt.Sprintf(`{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+				"Operations": [{"method": "POST", "bulkId": "a", "path": %q, "data": {"userName": "babs"}}]
+			}`, path))
+			assert.Equal(t, http.StatusOK, status, "status code mismatch")
+			if assert.Len(t, operations, 1) {
+				assert.Equal(t, "400", operations[0]["status"])
+				assert.Nil(t, operations[0]["location"])
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package scim
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// Cursor is a position within the ordered resources of a query, from which a page of cursor pagination continues, as
+// described in RFC 9865. The position is that of a resource, by its sort value and id, so that pages do not drift when
+// resources are added or removed. The zero Cursor is the position before the first resource.
+type Cursor struct {
+	// ID is the id of the resource at the position. It is empty for the position before the first resource.
+	ID string
+	// Value is the sort value of the resource at the position, formatted as it is compared in a filter. It is empty if
+	// the resources are ordered by their id.
+	Value string
+	// Missing indicates that the resource at the position has no sort value.
+	Missing bool
+	// Backward indicates that the page ends before the position, instead of starting after it.
+	Backward bool
+}
+
+// seekFilter returns the filter that matches the resources beyond the position of the cursor, in the order described
+// by sortBy and order. Resources with the same sort value are ordered by their id, and resources without a sort value
+// are ordered last in ascending order, like the queries of a Store. It returns nil for the zero Cursor.
+func (c Cursor) seekFilter(sortBy string, order SortOrder) filter.Expression {
+	if c.ID == "" {
+		return nil
+	}
+
+	idOperator := filter.GT
+	if c.Backward {
+		idOperator = filter.LT
+	}
+	id := attributeExpression("id", idOperator, c.ID)
+	if sortBy == "" {
+		return id
+	}
+
+	// greater indicates whether the resources beyond the position have greater sort values, and thus also includes the
+	// resources without a sort value.
+	greater := (order == SortOrderDescending) == c.Backward
+	present := attributeExpression(sortBy, filter.PR, "")
+	missing := filter.UnaryExpression{CompareOperator: filter.NOT, X: present}
+	if c.Missing {
+		if greater {
+			return and(missing, id)
+		}
+		return or(present, and(missing, id))
+	}
+
+	valueOperator := filter.LT
+	if greater {
+		valueOperator = filter.GT
+	}
+	seek := or(
+		attributeExpression(sortBy, valueOperator, c.Value),
+		and(attributeExpression(sortBy, filter.EQ, c.Value), id),
+	)
+	if greater {
+		seek = or(seek, missing)
+	}
+	return seek
+}
+
+// attributeExpression returns the filter expression that compares the attribute at the given path to the value.
+func attributeExpression(path string, operator filter.Token, value string) filter.AttributeExpression {
+	var prefix string
+	if i := strings.LastIndex(path, ":"); i != -1 {
+		prefix, path = path[:i+1], path[i+1:]
+	}
+	name, subName := path, ""
+	if i := strings.Index(path, "."); i != -1 {
+		name, subName = path[:i], path[i+1:]
+	}
+	return filter.AttributeExpression{
+		AttributePath: filter.AttributePath{
+			AttributeName: prefix + name,
+			SubAttribute:  subName,
+		},
+		CompareOperator: operator,
+		CompareValue:    value,
+	}
+}
+
+// and returns the filter expression that matches both x and y. A nil expression matches all resources.
+func and(x, y filter.Expression) filter.Expression {
+	if x == nil {
+		return y
+	}
+	return filter.BinaryExpression{X: x, CompareOperator: filter.AND, Y: y}
+}
+
+// or returns the filter expression that matches x or y.
+func or(x, y filter.Expression) filter.Expression {
+	return filter.BinaryExpression{X: x, CompareOperator: filter.OR, Y: y}
+}
+
+// cursorAt returns the cursor at the position of the given resource, in the resources ordered by sortBy.
+func (t ResourceType) cursorAt(resource Resource, sortBy string) Cursor {
+	cursor := Cursor{ID: resource.ID}
+	if sortBy == "" {
+		return cursor
+	}
+
+	key, _, _ := t.sortKey(resource, sortBy)
+	switch key := key.(type) {
+	case nil:
+		cursor.Missing = true
+	case string:
+		cursor.Value = key
+	case time.Time:
+		cursor.Value = key.UTC().Format(time.RFC3339Nano)
+	default:
+		cursor.Value = fmt.Sprint(key)
+	}
+	return cursor
+}
+
+// cursorSortable returns whether the resources can be paginated with a cursor when they are ordered by sortBy. The
+// sort value has to be a single value that can be compared in a filter, which is not the case for multi-valued
+// attributes, as those are ordered by their primary value only.
+func (t ResourceType) cursorSortable(sortBy string) bool {
+	if sortBy == "" {
+		return true
+	}
+	attr, sub, ok := t.getAttributePath(sortBy)
+	if !ok || attr.attribute.MultiValued() {
+		return false
+	}
+	leaf := attr.attribute
+	if sub != nil {
+		leaf = *sub
+	}
+	switch leaf.AttributeType() {
+	case "boolean", "binary", "complex":
+		return false
+	default:
+		return !leaf.MultiValued()
+	}
+}
+
+// cursorToken is the content of a cursor token, which is signed so that clients can not alter it.
+type cursorToken struct {
+	ID       string `json:"i,omitempty"`
+	Value    string `json:"v,omitempty"`
+	Missing  bool   `json:"m,omitempty"`
+	Backward bool   `json:"b,omitempty"`
+	// Query is the fingerprint of the query the cursor belongs to.
+	Query string `json:"q"`
+	// Issued is the Unix time at which the cursor was issued.
+	Issued int64 `json:"t"`
+}
+
+// queryFingerprint returns the fingerprint of a list request of the resource type, which binds a cursor to the query it
+// was issued for. Only the parameters that determine which resources are returned, and in which order, are included.
+func (t ResourceType) queryFingerprint(query url.Values, params ListRequestParams) string {
+	h := sha256.New()
+	for _, part := range []string{t.Endpoint, strings.TrimSpace(query.Get("filter")), params.SortBy, string(params.SortOrder)} {
+		_, _ = h.Write([]byte(part))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// encodeCursor returns the opaque token of the cursor of the query with the given fingerprint. The token consists of
+// its content and the HMAC-SHA256 signature of that content, both encoded in base64url.
+func (config ServiceProviderConfig) encodeCursor(cursor Cursor, fingerprint string, issued time.Time) string {
+	content, _ := json.Marshal(cursorToken{
+		ID:       cursor.ID,
+		Value:    cursor.Value,
+		Missing:  cursor.Missing,
+		Backward: cursor.Backward,
+		Query:    fingerprint,
+		Issued:   issued.Unix(),
+	})
+	return base64.RawURLEncoding.EncodeToString(content) + "." +
+		base64.RawURLEncoding.EncodeToString(config.signCursor(content))
+}
+
+// decodeCursor returns the cursor of the given token, if the token is signed by the server, belongs to the query with
+// the given fingerprint and has not expired.
+func (config ServiceProviderConfig) decodeCursor(token, fingerprint string, now time.Time) (Cursor, *errors.ScimError) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return Cursor{}, &errors.ScimErrorInvalidCursor
+	}
+	content, contentErr := base64.RawURLEncoding.DecodeString(parts[0])
+	signature, signatureErr := base64.RawURLEncoding.DecodeString(parts[1])
+	if contentErr != nil || signatureErr != nil || !hmac.Equal(signature, config.signCursor(content)) {
+		return Cursor{}, &errors.ScimErrorInvalidCursor
+	}
+
+	var decoded cursorToken
+	if err := json.Unmarshal(content, &decoded); err != nil || decoded.Query != fingerprint {
+		return Cursor{}, &errors.ScimErrorInvalidCursor
+	}
+	if now.Sub(time.Unix(decoded.Issued, 0)) > config.getCursorTimeout() {
+		return Cursor{}, &errors.ScimErrorExpiredCursor
+	}
+	return Cursor{
+		ID:       decoded.ID,
+		Value:    decoded.Value,
+		Missing:  decoded.Missing,
+		Backward: decoded.Backward,
+	}, nil
+}
+
+// signCursor returns the HMAC-SHA256 signature of the content of a cursor token.
+func (config ServiceProviderConfig) signCursor(content []byte) []byte {
+	mac := hmac.New(sha256.New, config.CursorSecret)
+	_, _ = mac.Write(content)
+	return mac.Sum(nil)
+}
+
+// parseCursor sets the cursor of the list request if the "cursor" parameter is present. An empty value requests the
+// first page. Cursor pagination can not be combined with a start index, and requires that the resources are ordered by
+// a single comparable value.
+func (s Server) parseCursor(query url.Values, resourceType ResourceType, params *ListRequestParams) *errors.ScimError {
+	values, ok := query["cursor"]
+	if !ok {
+		return nil
+	}
+	if !s.Config.supportsCursorPagination() {
+		scimErr := errors.ScimErrorBadRequest("Cursor pagination is not supported.")
+		return &scimErr
+	}
+	if _, ok := query["startIndex"]; ok {
+		scimErr := errors.ScimErrorBadRequest("The \"cursor\" and \"startIndex\" parameters can not be combined.")
+		return &scimErr
+	}
+	if count, err := getIntQueryParam(query, "count", 0); err != nil || count < 0 || count > s.Config.getItemsPerPage() {
+		return &errors.ScimErrorInvalidCount
+	}
+	if !resourceType.cursorSortable(params.SortBy) {
+		scimErr := errors.ScimErrorBadRequest(fmt.Sprintf(
+			"Cursor pagination does not support sorting by %q, as it does not have a single comparable value.",
+			params.SortBy,
+		))
+		return &scimErr
+	}
+
+	var cursor Cursor
+	if token := strings.TrimSpace(values[0]); token != "" {
+		var scimErr *errors.ScimError
+		cursor, scimErr = s.Config.decodeCursor(token, resourceType.queryFingerprint(query, *params), time.Now())
+		if scimErr != nil {
+			return scimErr
+		}
+	}
+	params.Cursor = &cursor
+	return nil
+}
+
+// pageCursors returns the tokens of the cursors of the pages after and before the returned page of a list request with
+// a cursor. A token is empty if there is no such page. The page before the first page is not known if all resources
+// before it have been removed, in which case the next page is the first page.
+func (s Server) pageCursors(query url.Values, resourceType ResourceType, params ListRequestParams, resources []Resource) (string, string) {
+	fingerprint := resourceType.queryFingerprint(query, params)
+	now := time.Now()
+	encode := func(cursor Cursor, backward bool) string {
+		cursor.Backward = backward
+		return s.Config.encodeCursor(cursor, fingerprint, now)
+	}
+
+	cursor := *params.Cursor
+	if len(resources) == 0 {
+		if cursor.Backward {
+			return encode(Cursor{}, false), ""
+		}
+		return "", ""
+	}
+
+	var next, previous string
+	if params.HasMore || cursor.Backward {
+		next = encode(resourceType.cursorAt(resources[len(resources)-1], params.SortBy), false)
+	}
+	if cursor.Backward && params.HasMore || !cursor.Backward && cursor.ID != "" {
+		previous = encode(resourceType.cursorAt(resources[0], params.SortBy), true)
+	}
+	return next, previous
+}
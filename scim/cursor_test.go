@@ -0,0 +1,229 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCursorServer(t *testing.T, names ...interface{}) (Server, StoreHandler) {
+	handler, _ := newTestStoreHandler()
+	resourceType := handler.resourceType
+	resourceType.Handler = handler
+	server := Server{
+		Config: ServiceProviderConfig{
+			MaxResults:              10,
+			SupportCursorPagination: true,
+			CursorSecret:            []byte("secret"),
+		},
+		ResourceTypes: []ResourceType{resourceType},
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/Devices", nil)
+	for _, name := range names {
+		_, err := handler.Create(r, ResourceAttributes{"name": name})
+		assert.NoError(t, err)
+	}
+	return server, handler
+}
+
+type cursorResponse struct {
+	TotalResults   int
+	ItemsPerPage   int
+	StartIndex     *int
+	NextCursor     string
+	PreviousCursor string
+	Resources      []map[string]interface{}
+}
+
+func (r cursorResponse) names() []interface{} {
+	names := make([]interface{}, len(r.Resources))
+	for i, resource := range r.Resources {
+		names[i] = resource["name"]
+	}
+	return names
+}
+
+func doCursorRequest(t *testing.T, server Server, query url.Values) (int, cursorResponse, errors.ScimError) {
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Devices?"+query.Encode(), nil))
+
+	var response cursorResponse
+	var scimErr errors.ScimError
+	if rr.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	} else {
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scimErr))
+	}
+	return rr.Code, response, scimErr
+}
+
+func TestServerCursorPagination(t *testing.T) {
+	server, _ := newTestCursorServer(t, "c", "a", nil, "e", "b", "d")
+
+	for _, test := range []struct {
+		sortOrder string
+		pages     [][]interface{}
+	}{
+		{sortOrder: "ascending", pages: [][]interface{}{{"a", "b"}, {"c", "d"}, {"e", nil}}},
+		{sortOrder: "descending", pages: [][]interface{}{{nil, "e"}, {"d", "c"}, {"b", "a"}}},
+	} {
+		t.Run(test.sortOrder, func(t *testing.T) {
+			query := url.Values{"cursor": {""}, "count": {"2"}, "sortBy": {"name"}, "sortOrder": {test.sortOrder}}
+
+			var previous []string
+			for i, names := range test.pages {
+				code, response, _ := doCursorRequest(t, server, query)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Equal(t, 6, response.TotalResults)
+				assert.Equal(t, 2, response.ItemsPerPage)
+				assert.Nil(t, response.StartIndex)
+				assert.Equal(t, names, response.names())
+				assert.Equal(t, i != 0, response.PreviousCursor != "")
+				assert.Equal(t, i != len(test.pages)-1, response.NextCursor != "")
+
+				previous = append(previous, response.PreviousCursor)
+				query.Set("cursor", response.NextCursor)
+			}
+
+			// the previous cursors lead back to the same pages
+			for i := len(test.pages) - 1; i > 0; i-- {
+				query.Set("cursor", previous[i])
+				code, response, _ := doCursorRequest(t, server, query)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Equal(t, test.pages[i-1], response.names())
+				assert.NotEmpty(t, response.NextCursor)
+				assert.Equal(t, i-1 != 0, response.PreviousCursor != "")
+			}
+		})
+	}
+}
+
+func TestServerCursorPaginationStable(t *testing.T) {
+	server, handler := newTestCursorServer(t, "b", "d", "f")
+	query := url.Values{"cursor": {""}, "count": {"2"}, "sortBy": {"name"}}
+
+	_, first, _ := doCursorRequest(t, server, query)
+	assert.Equal(t, []interface{}{"b", "d"}, first.names())
+
+	// resources that are added before the cursor do not shift the next page
+	r := httptest.NewRequest(http.MethodPost, "/Devices", nil)
+	for _, name := range []string{"a", "c", "e"} {
+		_, err := handler.Create(r, ResourceAttributes{"name": name})
+		assert.NoError(t, err)
+	}
+
+	query.Set("cursor", first.NextCursor)
+	_, second, _ := doCursorRequest(t, server, query)
+	assert.Equal(t, []interface{}{"e", "f"}, second.names())
+	assert.Equal(t, 6, second.TotalResults)
+	assert.Empty(t, second.NextCursor)
+}
+
+func TestServerCursorPaginationByID(t *testing.T) {
+	server, _ := newTestCursorServer(t, "a", "b", "c")
+	query := url.Values{"cursor": {""}, "count": {"2"}}
+
+	var ids []interface{}
+	for query.Get("cursor") != "" || len(ids) == 0 {
+		code, response, _ := doCursorRequest(t, server, query)
+		assert.Equal(t, http.StatusOK, code)
+		for _, resource := range response.Resources {
+			ids = append(ids, resource["id"])
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+	assert.Len(t, ids, 3)
+	assert.True(t, ids[0].(string) < ids[1].(string) && ids[1].(string) < ids[2].(string))
+}
+
+func TestServerCursorPaginationInvalid(t *testing.T) {
+	server, _ := newTestCursorServer(t, "a", "b", "c")
+	_, first, _ := doCursorRequest(t, server, url.Values{"cursor": {""}, "count": {"1"}, "sortBy": {"name"}})
+	fingerprint := server.ResourceTypes[0].queryFingerprint(url.Values{}, ListRequestParams{SortBy: "name", SortOrder: SortOrderAscending})
+	expired := server.Config.encodeCursor(Cursor{ID: "x", Value: "a"}, fingerprint, time.Now().Add(-2*time.Hour))
+
+	for _, test := range []struct {
+		name     string
+		query    url.Values
+		scimType errors.ScimType
+	}{
+		{name: "tampered", query: url.Values{"cursor": {first.NextCursor[:len(first.NextCursor)-2] + "AA"}, "sortBy": {"name"}}, scimType: errors.ScimTypeInvalidCursor},
+		{name: "malformed", query: url.Values{"cursor": {"abc"}, "sortBy": {"name"}}, scimType: errors.ScimTypeInvalidCursor},
+		{name: "other query", query: url.Values{"cursor": {first.NextCursor}, "sortBy": {"name"}, "sortOrder": {"descending"}}, scimType: errors.ScimTypeInvalidCursor},
+		{name: "expired", query: url.Values{"cursor": {expired}, "sortBy": {"name"}}, scimType: errors.ScimTypeExpiredCursor},
+		{name: "count too large", query: url.Values{"cursor": {""}, "count": {"11"}}, scimType: errors.ScimTypeInvalidCount},
+		{name: "negative count", query: url.Values{"cursor": {""}, "count": {"-1"}}, scimType: errors.ScimTypeInvalidCount},
+		{name: "start index", query: url.Values{"cursor": {""}, "startIndex": {"2"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			code, _, scimErr := doCursorRequest(t, server, test.query)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, test.scimType, scimErr.ScimType)
+		})
+	}
+
+	server.Config.SupportCursorPagination = false
+	code, _, _ := doCursorRequest(t, server, url.Values{"cursor": {""}})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestServerCursorPaginationConfig(t *testing.T) {
+	server, _ := newTestCursorServer(t)
+	server.Config.CursorTimeout = 10 * time.Minute
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ServiceProviderConfig", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var config struct {
+		Pagination map[string]interface{}
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+	assert.Equal(t, map[string]interface{}{
+		"cursor":                  true,
+		"index":                   true,
+		"defaultPaginationMethod": "index",
+		"defaultPageSize":         float64(10),
+		"maxPageSize":             float64(10),
+		"cursorTimeout":           float64(600),
+	}, config.Pagination)
+}
+
+func TestCursorSeekFilter(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	resourceType := handler.resourceType
+
+	resources := []ResourceAttributes{
+		{"id": "1", "name": "a"},
+		{"id": "2", "name": "b"},
+		{"id": "3", "name": "b"},
+		{"id": "4"},
+		{"id": "5", "name": "c"},
+	}
+	for _, test := range []struct {
+		cursor Cursor
+		order  SortOrder
+		ids    []interface{}
+	}{
+		{cursor: Cursor{ID: "2", Value: "b"}, order: SortOrderAscending, ids: []interface{}{"3", "4", "5"}},
+		{cursor: Cursor{ID: "2", Value: "b", Backward: true}, order: SortOrderAscending, ids: []interface{}{"1"}},
+		{cursor: Cursor{ID: "4", Missing: true}, order: SortOrderAscending, ids: nil},
+		{cursor: Cursor{ID: "4", Missing: true, Backward: true}, order: SortOrderAscending, ids: []interface{}{"1", "2", "3", "5"}},
+		{cursor: Cursor{ID: "2", Value: "b"}, order: SortOrderDescending, ids: []interface{}{"1", "3"}},
+		{cursor: Cursor{ID: "2", Value: "b", Backward: true}, order: SortOrderDescending, ids: []interface{}{"4", "5"}},
+		{cursor: Cursor{ID: "4", Missing: true}, order: SortOrderDescending, ids: []interface{}{"1", "2", "3", "5"}},
+		{cursor: Cursor{ID: "4", Missing: true, Backward: true}, order: SortOrderDescending, ids: nil},
+	} {
+		matches, err := resourceType.MatchResources(resources, test.cursor.seekFilter("name", test.order))
+		assert.NoError(t, err)
+		assert.Equal(t, test.ids, ids(matches), "%+v %s", test.cursor, test.order)
+	}
+}
@@ -0,0 +1,103 @@
+package scim
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+)
+
+// WeakETag returns a weak entity tag for the given version of a resource, e.g. `W/"3"`. It can be used as the value of
+// the "Version" of the meta data of a resource.
+func WeakETag(version string) string {
+	return "W/" + opaqueTag(version)
+}
+
+// DerivedETag returns the weak entity tag of the given version of a resource, combined with the values of its attributes
+// that are derived from other resources, e.g. `W/"3-5f2a9c01"`. Handlers use it as the version of the resources they
+// return, so that the entity tag changes when the derived values change, even if the resource itself does not. The
+// version is returned as is if none of the values are set.
+func DerivedETag(version string, derived ...interface{}) string {
+	set := false
+	for _, value := range derived {
+		set = set || value != nil
+	}
+	if !set {
+		return version
+	}
+
+	raw, _ := json.Marshal(derived)
+	sum := sha256.Sum256(raw)
+	return WeakETag(fmt.Sprintf("%s-%x", strings.Trim(opaqueTag(version), `"`), sum[:4]))
+}
+
+// opaqueTag returns the quoted entity tag without the weakness indicator. Versions that are not quoted, such as "v1",
+// are quoted so that they can be compared with the entity tags sent by clients.
+func opaqueTag(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		tag = `"` + tag + `"`
+	}
+	return tag
+}
+
+// etagMatches returns whether one of the entity tags in the value of an "If-Match" or "If-None-Match" header matches
+// the version of a resource. The weak comparison function of RFC 7232 section 2.3.2 is used, as the service provider
+// generates weak entity tags. A wildcard matches any version.
+func etagMatches(header, version string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if tag != "" && version != "" && opaqueTag(tag) == opaqueTag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionKey is the key of the context value that holds the version of a resource that matched the "If-Match" header.
+type versionKey struct{}
+
+// VersionFromContext returns the version of the resource that matched the "If-Match" header of the request, if any.
+// Handlers use it as the precondition of the write that modifies the resource, so that the resource is not modified if
+// it changed after the header was evaluated.
+func VersionFromContext(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(versionKey{}).(string)
+	return version, ok && version != ""
+}
+
+// checkPreconditions evaluates the "If-Match" header of a request that modifies the resource with given identifier. It
+// returns a 412 SCIM error if the current version of the resource does not match any of the given entity tags.
+// Otherwise it returns the request with the matched version in its context, see VersionFromContext.
+func (s Server) checkPreconditions(r *http.Request, id string, resourceType ResourceType) (*http.Request, *errors.ScimError) {
+	ifMatch := r.Header.Get("If-Match")
+	if !s.Config.SupportETag || ifMatch == "" {
+		return r, nil
+	}
+
+	resource, getErr := resourceType.Handler.Get(r, id)
+	if getErr != nil {
+		scimErr := errors.CheckScimError(getErr, r.Method)
+		return r, &scimErr
+	}
+	if !etagMatches(ifMatch, resource.Meta.Version) {
+		return r, &errors.ScimErrorPreconditionFailed
+	}
+	return r.WithContext(context.WithValue(r.Context(), versionKey{}, resource.Meta.Version)), nil
+}
+
+// notModified evaluates the "If-None-Match" header of a request that retrieves a resource. It returns whether the
+// client already has the current version of the resource.
+func (s Server) notModified(r *http.Request, resource Resource) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if !s.Config.SupportETag || ifNoneMatch == "" {
+		return false
+	}
+	return etagMatches(ifNoneMatch, resource.Meta.Version)
+}
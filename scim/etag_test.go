@@ -0,0 +1,163 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestETagServer() Server {
+	server := newTestServer()
+	server.Config.SupportETag = true
+	return server
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header  string
+		version string
+		matches bool
+	}{
+		{header: `W/"1"`, version: `W/"1"`, matches: true},
+		{header: `"1"`, version: `W/"1"`, matches: true},
+		{header: `W/"2", W/"1"`, version: `W/"1"`, matches: true},
+		{header: `*`, version: `W/"1"`, matches: true},
+		{header: `"v1"`, version: `v1`, matches: true},
+		{header: `W/"2"`, version: `W/"1"`, matches: false},
+		{header: `W/"1"`, version: ``, matches: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.matches, etagMatches(tt.header, tt.version), "%s and %s", tt.header, tt.version)
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	assert.Equal(t, `W/"3"`, WeakETag("3"))
+}
+
+func TestDerivedETag(t *testing.T) {
+	assert.Equal(t, `W/"3"`, DerivedETag(`W/"3"`, nil, nil))
+
+	groups := []interface{}{map[string]interface{}{"value": "0001", "display": "Admins"}}
+	etag := DerivedETag(`W/"3"`, groups, nil)
+	assert.Regexp(t, `^W/"3-[0-9a-f]{8}"$`, etag)
+	assert.Equal(t, etag, DerivedETag(`W/"3"`, groups, nil))
+	assert.NotEqual(t, etag, DerivedETag(`W/"4"`, groups, nil))
+	assert.NotEqual(t, etag, DerivedETag(`W/"3"`, []interface{}{map[string]interface{}{"value": "0001", "display": "Users"}}, nil))
+}
+
+func TestServerResourceGetHandlerIfNoneMatch(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Users/0001", nil)
+	req.Header.Set("If-None-Match", `W/"v1"`)
+	rr := httptest.NewRecorder()
+	newTestETagServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotModified, rr.Code, "status code mismatch")
+	assert.Equal(t, "v1", rr.Header().Get("Etag"))
+	assert.Empty(t, rr.Body.Bytes())
+
+	req = httptest.NewRequest(http.MethodGet, "/Users/0001", nil)
+	req.Header.Set("If-None-Match", `W/"v2"`)
+	rr = httptest.NewRecorder()
+	newTestETagServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status code mismatch")
+}
+
+func TestServerResourceHandlersIfMatch(t *testing.T) {
+	tests := []struct {
+		method  string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{method: http.MethodPut, body: `{"userName": "other"}`, ifMatch: `W/"v2"`, status: http.StatusPreconditionFailed},
+		{method: http.MethodPut, body: `{"userName": "other"}`, ifMatch: `W/"v1"`, status: http.StatusOK},
+		{method: http.MethodPatch, body: `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "replace", "path": "displayName", "value": "other"}]
+		}`, ifMatch: `W/"v2"`, status: http.StatusPreconditionFailed},
+		{method: http.MethodDelete, ifMatch: `W/"v2"`, status: http.StatusPreconditionFailed},
+		{method: http.MethodDelete, ifMatch: `*`, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/Users/0001", strings.NewReader(tt.body))
+		req.Header.Set("If-Match", tt.ifMatch)
+		rr := httptest.NewRecorder()
+		newTestETagServer().ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.status, rr.Code, "%s with %s", tt.method, tt.ifMatch)
+	}
+}
+
+// racingHandler is a store handler of which the resources are modified by another client right after they are read.
+type racingHandler struct {
+	StoreHandler
+}
+
+func (h racingHandler) Get(r *http.Request, id string) (Resource, error) {
+	resource, err := h.StoreHandler.Get(r, id)
+	if err != nil {
+		return Resource{}, err
+	}
+	_, err = h.StoreHandler.Patch(httptest.NewRequest(http.MethodPatch, "/Devices/"+id, nil), id, PatchRequest{
+		Operations: []PatchOperation{{Op: PatchOperationReplace, Path: "name", Value: "scanner"}},
+	})
+	return resource, err
+}
+
+func TestServerResourceHandlersIfMatchConcurrentWrite(t *testing.T) {
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{method: http.MethodPut, body: `{"schemas": ["urn:example:Device"], "serial": "SN-1", "name": "copier"}`},
+		{method: http.MethodPatch, body: `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "replace", "path": "name", "value": "copier"}]
+		}`},
+		{method: http.MethodDelete},
+	}
+
+	for _, tt := range tests {
+		handler, _ := newTestStoreHandler()
+		resource, err := handler.Create(httptest.NewRequest(http.MethodPost, "/Devices", nil), ResourceAttributes{
+			"serial": "SN-1",
+			"name":   "printer",
+		})
+		assert.NoError(t, err)
+
+		resourceType := handler.resourceType
+		resourceType.Handler = racingHandler{handler}
+		server := Server{Config: ServiceProviderConfig{SupportETag: true}, ResourceTypes: []ResourceType{resourceType}}
+
+		// the resource is modified after the "If-Match" header is evaluated, but before it is written
+		req := httptest.NewRequest(tt.method, "/Devices/"+resource.ID, strings.NewReader(tt.body))
+		req.Header.Set("If-Match", resource.Meta.Version)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code, tt.method)
+
+		stored, err := handler.Get(req, resource.ID)
+		assert.NoError(t, err, tt.method)
+		assert.Equal(t, "scanner", stored.Attributes["name"], tt.method)
+	}
+}
+
+func TestServerServiceProviderConfigETag(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ServiceProviderConfig", nil)
+	rr := httptest.NewRecorder()
+	newTestETagServer().ServeHTTP(rr, req)
+
+	var config map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &config)
+	assert.NoError(t, err, "json unmarshalling failed")
+
+	assert.Equal(t, map[string]interface{}{"supported": true}, config["etag"])
+}
@@ -0,0 +1,471 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
+	filter "github.com/di-wu/scim-filter-parser"
+	datetime "github.com/di-wu/xsd-datetime"
+)
+
+// FilterValidator validates a parsed filter expression against the schemas of a resource type and evaluates it
+// against resources of that type, as described in RFC 7644 section 3.4.2.2.
+type FilterValidator struct {
+	expression   filter.Expression
+	resourceType ResourceType
+}
+
+// NewFilterValidator returns a validator for the given filter expression and the resource type it is applied to.
+func NewFilterValidator(expression filter.Expression, resourceType ResourceType) FilterValidator {
+	return FilterValidator{
+		expression:   expression,
+		resourceType: resourceType,
+	}
+}
+
+// Validate checks whether all the attributes referenced by the filter exist and whether the comparison operators and
+// values are compatible with the types of those attributes.
+func (v FilterValidator) Validate() *errors.ScimError {
+	if v.expression == nil {
+		return nil
+	}
+	return v.validate(v.expression, nil)
+}
+
+func (v FilterValidator) validate(expression filter.Expression, parent *schema.CoreAttribute) *errors.ScimError {
+	switch e := expression.(type) {
+	case filter.AttributeExpression:
+		_, attr, ok := v.resolve(e.AttributePath, parent)
+		if !ok {
+			return &errors.ScimErrorInvalidFilter
+		}
+		if !validComparison(attr, e.CompareOperator, e.CompareValue) {
+			return &errors.ScimErrorInvalidFilter
+		}
+		return nil
+	case filter.ValuePath:
+		if parent != nil {
+			// Value paths can not be nested.
+			return &errors.ScimErrorInvalidFilter
+		}
+		attr, ok := v.resourceType.getAttribute(e.AttributeName)
+		if !ok || attr.attribute.AttributeType() != "complex" {
+			return &errors.ScimErrorInvalidFilter
+		}
+		return v.validate(e.ValueExpression, &attr.attribute)
+	case filter.UnaryExpression:
+		return v.validate(e.X, parent)
+	case filter.BinaryExpression:
+		if scimErr := v.validate(e.X, parent); scimErr != nil {
+			return scimErr
+		}
+		return v.validate(e.Y, parent)
+	default:
+		return &errors.ScimErrorInvalidFilter
+	}
+}
+
+func (v FilterValidator) evaluate(expression filter.Expression, parent *schema.CoreAttribute, data map[string]interface{}) bool {
+	switch e := expression.(type) {
+	case filter.AttributeExpression:
+		sa, attr, ok := v.resolve(e.AttributePath, parent)
+		if !ok {
+			return false
+		}
+
+		container := data
+		if sa.schemaID != "" {
+			container, _ = toMap(lookup(data, sa.schemaID))
+		}
+		values := leafValues(lookup(container, sa.attribute.Name()), sa.attribute, e.AttributePath.SubAttribute)
+
+		switch e.CompareOperator {
+		case filter.PR:
+			for _, value := range values {
+				if present(value) {
+					return true
+				}
+			}
+			return false
+		case filter.NE:
+			for _, value := range values {
+				if compare(attr, value, filter.EQ, e.CompareValue) {
+					return false
+				}
+			}
+			return true
+		default:
+			for _, value := range values {
+				if compare(attr, value, e.CompareOperator, e.CompareValue) {
+					return true
+				}
+			}
+			return false
+		}
+	case filter.ValuePath:
+		sa, ok := v.resourceType.getAttribute(e.AttributeName)
+		if !ok {
+			return false
+		}
+
+		container := data
+		if sa.schemaID != "" {
+			container, _ = toMap(lookup(data, sa.schemaID))
+		}
+		value := lookup(container, sa.attribute.Name())
+
+		elements := []interface{}{value}
+		if sa.attribute.MultiValued() {
+			elements, _ = toSlice(value)
+		}
+		for _, element := range elements {
+			if m, ok := toMap(element); ok && v.evaluate(e.ValueExpression, &sa.attribute, m) {
+				return true
+			}
+		}
+		return false
+	case filter.UnaryExpression:
+		return !v.evaluate(e.X, parent, data)
+	case filter.BinaryExpression:
+		if e.CompareOperator == filter.AND {
+			return v.evaluate(e.X, parent, data) && v.evaluate(e.Y, parent, data)
+		}
+		return v.evaluate(e.X, parent, data) || v.evaluate(e.Y, parent, data)
+	default:
+		return false
+	}
+}
+
+// resolve returns the attribute referenced by the given path, together with the (sub-)attribute that holds the values
+// the path is compared against. Within a value path, attribute names refer to the sub-attributes of the parent.
+func (v FilterValidator) resolve(path filter.AttributePath, parent *schema.CoreAttribute) (schemaAttribute, schema.CoreAttribute, bool) {
+	var sa schemaAttribute
+	if parent != nil {
+		sub, ok := parent.SubAttribute(path.AttributeName)
+		if !ok || path.SubAttribute != "" {
+			return schemaAttribute{}, schema.CoreAttribute{}, false
+		}
+		sa = schemaAttribute{attribute: sub}
+	} else {
+		attr, ok := v.resourceType.getAttribute(path.AttributeName)
+		if !ok {
+			return schemaAttribute{}, schema.CoreAttribute{}, false
+		}
+		sa = attr
+	}
+
+	if path.SubAttribute != "" {
+		sub, ok := sa.attribute.SubAttribute(path.SubAttribute)
+		if !ok {
+			return schemaAttribute{}, schema.CoreAttribute{}, false
+		}
+		return sa, sub, true
+	}
+
+	// A complex attribute without a sub-attribute is compared by its "value" sub-attribute, if it has one.
+	if sa.attribute.AttributeType() == "complex" {
+		if sub, ok := sa.attribute.SubAttribute("value"); ok {
+			return sa, sub, true
+		}
+	}
+	return sa, sa.attribute, true
+}
+
+// validComparison checks whether the operator can be applied to the attribute and whether the compare value can be
+// converted to the type of the attribute.
+func validComparison(attr schema.CoreAttribute, operator filter.Token, value string) bool {
+	if operator == filter.PR {
+		return true
+	}
+
+	switch attr.AttributeType() {
+	case "boolean":
+		if operator != filter.EQ && operator != filter.NE {
+			return false
+		}
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	case "binary":
+		switch operator {
+		case filter.GT, filter.GE, filter.LT, filter.LE:
+			return false
+		}
+		return true
+	case "complex":
+		return false
+	case "decimal", "integer":
+		switch operator {
+		case filter.CO, filter.SW, filter.EW:
+			return false
+		}
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case "dateTime":
+		switch operator {
+		case filter.CO, filter.SW, filter.EW:
+			return false
+		}
+		_, ok := toTime(value)
+		return ok
+	default:
+		return true
+	}
+}
+
+// compare applies the operator to given value and compare value, based on the type of the attribute.
+func compare(attr schema.CoreAttribute, value interface{}, operator filter.Token, compareValue string) bool {
+	if value == nil {
+		return false
+	}
+
+	var cmp int
+	switch attr.AttributeType() {
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return false
+		}
+		c, err := strconv.ParseBool(compareValue)
+		if err != nil {
+			return false
+		}
+		return (operator == filter.EQ) == (b == c)
+	case "decimal", "integer":
+		f, ok := toFloat(value)
+		if !ok {
+			return false
+		}
+		c, err := strconv.ParseFloat(compareValue, 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case f < c:
+			cmp = -1
+		case f > c:
+			cmp = 1
+		}
+	case "dateTime":
+		t, ok := toTime(value)
+		if !ok {
+			return false
+		}
+		c, ok := toTime(compareValue)
+		if !ok {
+			return false
+		}
+		switch {
+		case t.Before(c):
+			cmp = -1
+		case t.After(c):
+			cmp = 1
+		}
+	case "complex":
+		return false
+	default:
+		s, ok := value.(string)
+		if !ok {
+			s = fmt.Sprint(value)
+		}
+		if !attr.CaseExact() {
+			s, compareValue = strings.ToLower(s), strings.ToLower(compareValue)
+		}
+		switch operator {
+		case filter.CO:
+			return strings.Contains(s, compareValue)
+		case filter.SW:
+			return strings.HasPrefix(s, compareValue)
+		case filter.EW:
+			return strings.HasSuffix(s, compareValue)
+		}
+		cmp = strings.Compare(s, compareValue)
+	}
+
+	switch operator {
+	case filter.EQ:
+		return cmp == 0
+	case filter.NE:
+		return cmp != 0
+	case filter.GT:
+		return cmp > 0
+	case filter.GE:
+		return cmp >= 0
+	case filter.LT:
+		return cmp < 0
+	case filter.LE:
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// leafValues returns all the (simple) values of an attribute that a filter compares against. The values of multi-valued
+// attributes are flattened, and complex values are replaced by their given sub-attribute, or their "value"
+// sub-attribute if no sub-attribute is given.
+func leafValues(value interface{}, attr schema.CoreAttribute, subAttribute string) []interface{} {
+	if value == nil {
+		return nil
+	}
+
+	elements := []interface{}{value}
+	if attr.MultiValued() {
+		elements, _ = toSlice(value)
+	}
+
+	if attr.AttributeType() != "complex" {
+		return elements
+	}
+
+	if subAttribute == "" {
+		if _, ok := attr.SubAttribute("value"); !ok {
+			return elements
+		}
+		subAttribute = "value"
+	}
+
+	values := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		m, ok := toMap(element)
+		if !ok {
+			continue
+		}
+		sub := lookup(m, subAttribute)
+		if s, ok := toSlice(sub); ok {
+			values = append(values, s...)
+			continue
+		}
+		values = append(values, sub)
+	}
+	return values
+}
+
+// lookup returns the value of the given key, matched case-insensitively.
+func lookup(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func present(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	}
+	if s, ok := toSlice(value); ok {
+		return len(s) != 0
+	}
+	if m, ok := toMap(value); ok {
+		return len(m) != 0
+	}
+	return true
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case ResourceAttributes:
+		return v, true
+	case meta:
+		return v.getRaw(), true
+	}
+
+	// Named map types, such as those of database drivers, are converted with reflection.
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+func toSlice(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = e
+		}
+		return s, true
+	case []string:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = e
+		}
+		return s, true
+	}
+
+	// Named slice types, such as those of database drivers, are converted with reflection.
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	s := make([]interface{}, rv.Len())
+	for i := range s {
+		s[i] = rv.Index(i).Interface()
+	}
+	return s, true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toTime(value interface{}) (time.Time, bool) {
+	switch t := value.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, false
+		}
+		return *t, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed, true
+		}
+		parsed, err := datetime.Parse(t)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return parsed, true
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,164 @@
+package scim
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/optional"
+	filter "github.com/di-wu/scim-filter-parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFilterResource() Resource {
+	created, _ := time.Parse(time.RFC3339, "2020-01-01T15:04:05Z")
+	return Resource{
+		ID:         "0001",
+		ExternalID: optional.NewString("external1"),
+		Attributes: ResourceAttributes{
+			"userName":    "Babs",
+			"displayName": "Babs Jensen",
+			"active":      true,
+			"name": map[string]interface{}{
+				"familyName": "Jensen",
+				"givenName":  "Barbara",
+			},
+			"emails": []interface{}{
+				map[string]interface{}{
+					"value": "babs@example.com",
+					"type":  "work",
+				},
+				map[string]interface{}{
+					"value": "babs@jensen.org",
+					"type":  "home",
+				},
+			},
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+				"employeeNumber": "701984",
+			},
+		},
+		Meta: Meta{
+			ResourceType: "User",
+			Created:      &created,
+			LastModified: &created,
+		},
+	}
+}
+
+func newTestFilterResourceType() ResourceType {
+	return ResourceType{
+		Name:     "User",
+		Endpoint: "/Users",
+		Schema:   getUserSchema(),
+		SchemaExtensions: []SchemaExtension{
+			{Schema: getUserExtensionSchema()},
+		},
+	}
+}
+
+func TestMatchResources(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected bool
+	}{
+		{`userName eq "Babs"`, true},
+		{`userName eq "babs"`, true},
+		{`userName ne "Babs"`, false},
+		{`displayName eq "babs jensen"`, true},
+		{`displayName co "JENS"`, true},
+		{`displayName sw "Babs"`, true},
+		{`displayName ew "Jensen"`, true},
+		{`displayName ew "Babs"`, false},
+		{`displayName gt "Babs"`, true},
+		{`displayName lt "Babs"`, false},
+		{`active eq "true"`, true},
+		{`active ne "true"`, false},
+		{`name.familyName eq "Jensen"`, true},
+		{`name.givenName pr`, true},
+		{`immutableThing pr`, false},
+		{`immutableThing ne "x"`, true},
+		{`emails co "jensen.org"`, true},
+		{`emails.type eq "home"`, true},
+		{`emails[type eq "work" and value co "example.com"]`, true},
+		{`emails[type eq "work" and value co "jensen.org"]`, false},
+		{`emails[type eq "other"] or userName eq "Babs"`, true},
+		{`not (userName eq "Babs")`, false},
+		{`userName eq "Babs" and not (displayName sw "X")`, true},
+		{`id eq "0001"`, true},
+		{`externalId eq "external1"`, true},
+		{`externalId eq "EXTERNAL1"`, false},
+		{`meta.resourceType eq "User"`, true},
+		{`meta.created gt "2019-12-31T00:00:00Z"`, true},
+		{`meta.created lt "2019-12-31T00:00:00Z"`, false},
+		{`employeeNumber eq "701984"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber eq "701984"`, true},
+		{`organization pr`, false},
+	}
+
+	resourceType := newTestFilterResourceType()
+	resources := []ResourceAttributes{newTestFilterResource().values()}
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.filter, func(t *testing.T) {
+			expression, err := filter.NewParser(strings.NewReader(tt.filter)).Parse()
+			assert.NoError(t, err, "filter parsing failed")
+
+			matches, err := resourceType.MatchResources(resources, expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, len(matches) == 1)
+		})
+	}
+}
+
+func TestFilterValidatorValidateInvalid(t *testing.T) {
+	tests := []string{
+		`unknown eq "x"`,
+		`name.unknown eq "x"`,
+		`active gt "true"`,
+		`active eq "yes"`,
+		`meta.created eq "yesterday"`,
+		`emails[unknown eq "x"]`,
+		`userName[value eq "x"]`,
+	}
+
+	resourceType := newTestFilterResourceType()
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt, func(t *testing.T) {
+			expression, err := filter.NewParser(strings.NewReader(tt)).Parse()
+			assert.NoError(t, err, "filter parsing failed")
+
+			assert.NotNil(t, NewFilterValidator(expression, resourceType).Validate())
+		})
+	}
+}
+
+func TestServerResourcesGetHandlerInvalidFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{
+			name:   "unparsable filter",
+			target: `/Users?filter=userName+is+%22x%22`,
+		}, {
+			name:   "unknown attribute",
+			target: `/Users?filter=unknown+eq+%22x%22`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rr := httptest.NewRecorder()
+			newTestServer().ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, "status code mismatch")
+			assert.Contains(t, rr.Body.String(), `"scimType":"invalidFilter"`)
+		})
+	}
+}
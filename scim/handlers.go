@@ -3,9 +3,12 @@ package scim
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/dgbttn/go-scim-server/errors"
 )
@@ -26,13 +29,23 @@ func errorHandler(w http.ResponseWriter, _ *http.Request, scimErr *errors.ScimEr
 // schemasHandler receives an HTTP GET to retrieve information about resource schemas supported by a SCIM service
 // provider. An HTTP GET to the endpoint "/Schemas" returns all supported schemas in ListResponse format.
 func (s Server) schemasHandler(w http.ResponseWriter, r *http.Request) {
-	params, paramsErr := s.parseRequestParams(r)
+	params, paramsErr := s.parseRequestParams(r.URL.Query())
 	if paramsErr != nil {
 		errorHandler(w, r, paramsErr)
 		return
 	}
 
 	schemas := s.getSchemas()
+	if params.SortBy != "" {
+		sortRaw(schemas, func(i int) map[string]interface{} {
+			return map[string]interface{}{
+				"id":          schemas[i].ID,
+				"name":        schemas[i].Name.Value(),
+				"description": schemas[i].Description.Value(),
+			}
+		}, params.SortBy, params.SortOrder)
+	}
+
 	start, end := clamp(params.StartIndex-1, params.Count, len(schemas))
 	var resources []interface{}
 	for _, v := range schemas[start:end] {
@@ -84,15 +97,23 @@ func (s Server) schemaHandler(w http.ResponseWriter, r *http.Request, id string)
 // resources available on a SCIM service provider (e.g., Users and Groups).  Each resource type defines the endpoints,
 // the core schema URI that defines the resource, and any supported schema extensions.
 func (s Server) resourceTypesHandler(w http.ResponseWriter, r *http.Request) {
-	params, paramsErr := s.parseRequestParams(r)
+	params, paramsErr := s.parseRequestParams(r.URL.Query())
 	if paramsErr != nil {
 		errorHandler(w, r, paramsErr)
 		return
 	}
 
-	start, end := clamp(params.StartIndex-1, params.Count, len(s.ResourceTypes))
+	resourceTypes := make([]ResourceType, len(s.ResourceTypes))
+	copy(resourceTypes, s.ResourceTypes)
+	if params.SortBy != "" {
+		sortRaw(resourceTypes, func(i int) map[string]interface{} {
+			return resourceTypes[i].getRaw()
+		}, params.SortBy, params.SortOrder)
+	}
+
+	start, end := clamp(params.StartIndex-1, params.Count, len(resourceTypes))
 	var resources []interface{}
-	for _, v := range s.ResourceTypes[start:end] {
+	for _, v := range resourceTypes[start:end] {
 		resources = append(resources, v.getRaw())
 	}
 
@@ -160,14 +181,84 @@ func (s Server) serviceProviderConfigHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// bulkHandler receives an HTTP POST request to the "/Bulk" endpoint to perform multiple operations on resources in a
+// single request. Each operation is performed by the handler of the resource endpoint it targets.
+func (s Server) bulkHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.Config.SupportBulk {
+		errorHandler(w, r, &errors.ScimError{
+			Detail: "Bulk operations are not supported.",
+			Status: http.StatusNotImplemented,
+		})
+		return
+	}
+
+	maxPayloadSize := s.Config.getBulkMaxPayloadSize()
+	data, _ := ioutil.ReadAll(io.LimitReader(r.Body, int64(maxPayloadSize)+1))
+	if len(data) > maxPayloadSize {
+		scimErr := errors.ScimErrorPayloadTooLarge(fmt.Sprintf(
+			"The size of the bulk operation exceeds the maxPayloadSize (%d).", maxPayloadSize,
+		))
+		errorHandler(w, r, &scimErr)
+		return
+	}
+
+	var request bulkRequest
+	if err := unmarshal(data, &request); err != nil || !contains(request.Schemas, bulkRequestSchema) {
+		errorHandler(w, r, &errors.ScimErrorInvalidSyntax)
+		return
+	}
+
+	if maxOperations := s.Config.getBulkMaxOperations(); len(request.Operations) > maxOperations {
+		scimErr := errors.ScimErrorPayloadTooLarge(fmt.Sprintf(
+			"The number of operations exceeds the maxOperations (%d).", maxOperations,
+		))
+		errorHandler(w, r, &scimErr)
+		return
+	}
+
+	if bulkID, ok := request.duplicateBulkID(); ok {
+		errorHandler(w, r, &errors.ScimError{
+			ScimType: errors.ScimTypeInvalidValue,
+			Detail:   fmt.Sprintf("The bulkId %q is used by more than one operation.", bulkID),
+			Status:   http.StatusBadRequest,
+		})
+		return
+	}
+
+	raw, err := json.Marshal(s.bulk(r, request))
+	if err != nil {
+		errorHandler(w, r, &errors.ScimErrorInternal)
+		log.Fatalf("failed marshaling bulk response: %v", err)
+		return
+	}
+
+	_, err = w.Write(raw)
+	if err != nil {
+		log.Printf("failed writing response: %v", err)
+	}
+}
+
 // resourcePatchHandler receives an HTTP PATCH to the resource endpoint, e.g., "/Users/{id}" or "/Groups/{id}", where
 // "{id}" is a resource identifier to replace a resource's attributes.
 func (s Server) resourcePatchHandler(w http.ResponseWriter, r *http.Request, id string, resourceType ResourceType) {
+	projection, scimErr := resourceType.getProjection(r.URL.Query())
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	patch, scimErr := resourceType.validatePatch(r)
 	if scimErr != nil {
 		errorHandler(w, r, scimErr)
 		return
 	}
+	projection.specified = resourceType.patchedAttributes(patch)
+
+	r, scimErr = s.checkPreconditions(r, id, resourceType)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
 
 	resource, patchErr := resourceType.Handler.Patch(r, id, patch)
 	if patchErr != nil {
@@ -176,7 +267,7 @@ func (s Server) resourcePatchHandler(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
-	raw, err := json.Marshal(resource.response(resourceType))
+	raw, err := json.Marshal(resource.render(resourceType, projection))
 	if err != nil {
 		errorHandler(w, r, &errors.ScimErrorInternal)
 		log.Fatalf("failed marshaling resource: %v", err)
@@ -194,7 +285,10 @@ func (s Server) resourcePatchHandler(w http.ResponseWriter, r *http.Request, id
 		log.Printf("failed writing response: %v", err)
 	}
 
-	if err = resourceType.Provisioner.Patch(id, bytes.NewReader(raw)); err != nil {
+	if resourceType.Provisioner == nil {
+		return
+	}
+	if err = provisionPatch(resourceType.Provisioner, id, resource.response(resourceType)); err != nil {
 		log.Println("Patch provisioning client:", err)
 	}
 }
@@ -202,13 +296,20 @@ func (s Server) resourcePatchHandler(w http.ResponseWriter, r *http.Request, id
 // resourcePostHandler receives an HTTP POST request to the resource endpoint, such as "/Users" or "/Groups", as
 // defined by the associated resource type endpoint discovery to create new resources.
 func (s Server) resourcePostHandler(w http.ResponseWriter, r *http.Request, resourceType ResourceType) {
+	projection, scimErr := resourceType.getProjection(r.URL.Query())
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	data, _ := ioutil.ReadAll(r.Body)
 
-	attributes, scimErr := resourceType.validate(data)
+	attributes, scimErr := resourceType.validate(data, nil)
 	if scimErr != nil {
 		errorHandler(w, r, scimErr)
 		return
 	}
+	projection.specified = resourceType.specifiedAttributes(attributes)
 
 	resource, postErr := resourceType.Handler.Create(r, attributes)
 	if postErr != nil {
@@ -217,7 +318,7 @@ func (s Server) resourcePostHandler(w http.ResponseWriter, r *http.Request, reso
 		return
 	}
 
-	raw, err := json.Marshal(resource.response(resourceType))
+	raw, err := json.Marshal(resource.render(resourceType, projection))
 	if err != nil {
 		errorHandler(w, r, &errors.ScimErrorInternal)
 		log.Fatalf("failed marshaling resource: %v", err)
@@ -228,7 +329,25 @@ func (s Server) resourcePostHandler(w http.ResponseWriter, r *http.Request, reso
 		w.Header().Set("Etag", resource.Meta.Version)
 	}
 
-	id, extraAttributes, err := resourceType.Provisioner.Post(bytes.NewReader(raw))
+	if resourceType.Provisioner == nil {
+		w.WriteHeader(http.StatusCreated)
+
+		_, err = w.Write(raw)
+		if err != nil {
+			log.Printf("failed writing response: %v", err)
+		}
+		return
+	}
+
+	// The provisioning client receives the full resource, not only the attributes that are returned to the client.
+	full, err := json.Marshal(resource.response(resourceType))
+	if err != nil {
+		errorHandler(w, r, &errors.ScimErrorInternal)
+		log.Fatalf("failed marshaling resource: %v", err)
+		return
+	}
+
+	id, extraAttributes, err := resourceType.Provisioner.Post(bytes.NewReader(full))
 	if err == nil {
 		for k, v := range extraAttributes {
 			attributes[k] = v
@@ -241,7 +360,7 @@ func (s Server) resourcePostHandler(w http.ResponseWriter, r *http.Request, reso
 			return
 		}
 
-		raw, err = json.Marshal(resource.response(resourceType))
+		raw, err = json.Marshal(resource.render(resourceType, projection))
 		if err != nil {
 			errorHandler(w, r, &errors.ScimErrorInternal)
 			log.Fatalf("failed marshaling resource: %v", err)
@@ -262,6 +381,12 @@ func (s Server) resourcePostHandler(w http.ResponseWriter, r *http.Request, reso
 // resourceGetHandler receives an HTTP GET request to the resource endpoint, e.g., "/Users/{id}" or "/Groups/{id}",
 // where "{id}" is a resource identifier to retrieve a known resource.
 func (s Server) resourceGetHandler(w http.ResponseWriter, r *http.Request, id string, resourceType ResourceType) {
+	projection, scimErr := resourceType.getProjection(r.URL.Query())
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	resource, getErr := resourceType.Handler.Get(r, id)
 	if getErr != nil {
 		scimErr := errors.CheckScimError(getErr, http.MethodGet)
@@ -269,17 +394,22 @@ func (s Server) resourceGetHandler(w http.ResponseWriter, r *http.Request, id st
 		return
 	}
 
-	raw, err := json.Marshal(resource.response(resourceType))
+	if resource.Meta.Version != "" {
+		w.Header().Set("Etag", resource.Meta.Version)
+	}
+
+	if s.notModified(r, resource) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	raw, err := json.Marshal(resource.render(resourceType, projection))
 	if err != nil {
 		errorHandler(w, r, &errors.ScimErrorInternal)
 		log.Fatalf("failed marshaling resource: %v", err)
 		return
 	}
 
-	if resource.Meta.Version != "" {
-		w.Header().Set("Etag", resource.Meta.Version)
-	}
-
 	_, err = w.Write(raw)
 	if err != nil {
 		log.Printf("failed writing response: %v", err)
@@ -287,14 +417,38 @@ func (s Server) resourceGetHandler(w http.ResponseWriter, r *http.Request, id st
 }
 
 // resourcesGetHandler receives an HTTP GET request to the resource endpoint, e.g., "/Users" or "/Groups", to retrieve
-// all known resources.
-func (s Server) resourcesGetHandler(w http.ResponseWriter, r *http.Request, resourceType ResourceType) {
-	params, paramsErr := s.parseRequestParams(r)
+// all known resources. The query parameters are passed separately, as they are also sent in the body of a search request.
+func (s Server) resourcesGetHandler(w http.ResponseWriter, r *http.Request, resourceType ResourceType, query url.Values) {
+	params, paramsErr := s.parseRequestParams(query)
 	if paramsErr != nil {
 		errorHandler(w, r, paramsErr)
 		return
 	}
 
+	if scimErr := NewFilterValidator(params.Filter, resourceType).Validate(); scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	projection, scimErr := resourceType.getProjection(query)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	if params.SortBy != "" {
+		if _, _, ok := resourceType.getAttributePath(params.SortBy); !ok {
+			scimErr := errors.ScimErrorBadParams([]string{"sortBy"})
+			errorHandler(w, r, &scimErr)
+			return
+		}
+	}
+
+	if scimErr := s.parseCursor(query, resourceType, &params); scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	page, getError := resourceType.Handler.GetAll(r, &params)
 	if getError != nil {
 		scimErr := errors.CheckScimError(getError, http.MethodGet)
@@ -304,15 +458,61 @@ func (s Server) resourcesGetHandler(w http.ResponseWriter, r *http.Request, reso
 
 	resources := make([]interface{}, 0)
 	for _, v := range page.Resources {
-		resources = append(resources, v.response(resourceType))
+		resources = append(resources, v.render(resourceType, projection))
 	}
 
-	raw, err := json.Marshal(listResponse{
+	response := listResponse{
 		TotalResults: page.TotalResults,
 		Resources:    resources,
 		StartIndex:   params.StartIndex,
 		ItemsPerPage: params.Count,
-	})
+	}
+	if params.Cursor != nil {
+		response.Cursor = true
+		response.NextCursor, response.PreviousCursor = s.pageCursors(query, resourceType, params, page.Resources)
+	}
+
+	raw, err := json.Marshal(response)
+	if err != nil {
+		errorHandler(w, r, &errors.ScimErrorInternal)
+		log.Fatalf("failed marshalling list response: %v", err)
+		return
+	}
+
+	_, err = w.Write(raw)
+	if err != nil {
+		log.Printf("failed writing response: %v", err)
+	}
+}
+
+// resourcesSearchHandler receives an HTTP POST request to the search endpoint of a resource type, e.g.,
+// "/Users/.search", to query its resources with the query parameters in the body of the request.
+func (s Server) resourcesSearchHandler(w http.ResponseWriter, r *http.Request, resourceType ResourceType) {
+	query, scimErr := parseSearchRequest(r)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	s.resourcesGetHandler(w, r, resourceType, query)
+}
+
+// rootSearchHandler receives an HTTP POST request to the "/.search" endpoint to query the resources of all resource
+// types with the query parameters in the body of the request.
+func (s Server) rootSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query, scimErr := parseSearchRequest(r)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	response, scimErr := s.search(r, query)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	raw, err := json.Marshal(response)
 	if err != nil {
 		errorHandler(w, r, &errors.ScimErrorInternal)
 		log.Fatalf("failed marshalling list response: %v", err)
@@ -328,9 +528,29 @@ func (s Server) resourcesGetHandler(w http.ResponseWriter, r *http.Request, reso
 // resourcePutHandler receives an HTTP PUT to the resource endpoint, e.g., "/Users/{id}" or "/Groups/{id}", where
 // "{id}" is a resource identifier to replace a resource's attributes.
 func (s Server) resourcePutHandler(w http.ResponseWriter, r *http.Request, id string, resourceType ResourceType) {
+	projection, scimErr := resourceType.getProjection(r.URL.Query())
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	data, _ := ioutil.ReadAll(r.Body)
 
-	attributes, scimErr := resourceType.validate(data)
+	current, getErr := resourceType.Handler.Get(r, id)
+	if getErr != nil {
+		scimErr := errors.CheckScimError(getErr, http.MethodPut)
+		errorHandler(w, r, &scimErr)
+		return
+	}
+
+	attributes, scimErr := resourceType.validate(data, &current)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+	projection.specified = resourceType.specifiedAttributes(attributes)
+
+	r, scimErr = s.checkPreconditions(r, id, resourceType)
 	if scimErr != nil {
 		errorHandler(w, r, scimErr)
 		return
@@ -343,7 +563,7 @@ func (s Server) resourcePutHandler(w http.ResponseWriter, r *http.Request, id st
 		return
 	}
 
-	raw, err := json.Marshal(resource.response(resourceType))
+	raw, err := json.Marshal(resource.render(resourceType, projection))
 	if err != nil {
 		errorHandler(w, r, &errors.ScimErrorInternal)
 		log.Fatalf("failed marshaling resource: %v", err)
@@ -359,7 +579,10 @@ func (s Server) resourcePutHandler(w http.ResponseWriter, r *http.Request, id st
 		log.Printf("failed writing response: %v", err)
 	}
 
-	if err = resourceType.Provisioner.Patch(id, bytes.NewReader(raw)); err != nil {
+	if resourceType.Provisioner == nil {
+		return
+	}
+	if err = provisionPatch(resourceType.Provisioner, id, resource.response(resourceType)); err != nil {
 		log.Println("Patch provisioning client:", err)
 	}
 }
@@ -367,6 +590,12 @@ func (s Server) resourcePutHandler(w http.ResponseWriter, r *http.Request, id st
 // resourceDeleteHandler receives an HTTP DELETE request to the resource endpoint, e.g., "/Users/{id}" or "/Groups/{id}",
 // where "{id}" is a resource identifier to delete a known resource.
 func (s Server) resourceDeleteHandler(w http.ResponseWriter, r *http.Request, id string, resourceType ResourceType) {
+	r, scimErr := s.checkPreconditions(r, id, resourceType)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
 	deleteErr := resourceType.Handler.Delete(r, id)
 	if deleteErr != nil {
 		scimErr := errors.CheckScimError(deleteErr, http.MethodDelete)
@@ -376,7 +605,19 @@ func (s Server) resourceDeleteHandler(w http.ResponseWriter, r *http.Request, id
 
 	w.WriteHeader(http.StatusNoContent)
 
+	if resourceType.Provisioner == nil {
+		return
+	}
 	if err := resourceType.Provisioner.Delete(id); err != nil {
 		log.Println("Delete provisioning client:", err)
 	}
 }
+
+// provisionPatch sends the full representation of a modified resource to the provisioning client.
+func provisionPatch(provisioner *ProvisioningClient, id string, response ResourceAttributes) error {
+	raw, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return provisioner.Patch(id, bytes.NewReader(raw))
+}
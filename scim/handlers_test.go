@@ -128,6 +128,114 @@ func getUserExtensionSchema() schema.Schema {
 	}
 }
 
+// newTestCoreUserResourceType returns the resource type of users with the User and Enterprise User schemas of RFC 7643.
+func newTestCoreUserResourceType() ResourceType {
+	return ResourceType{
+		Name:     "User",
+		Endpoint: "/Users",
+		Schema:   schema.CoreUserSchema(),
+		SchemaExtensions: []SchemaExtension{
+			{Schema: schema.ExtensionEnterpriseUser()},
+		},
+	}
+}
+
+// newTestDeviceResourceType returns the resource type of devices, of which the attributes have the characteristics
+// that the attributes of the User schema do not have, e.g. their uniqueness, mutability and when they are returned.
+func newTestDeviceResourceType() ResourceType {
+	return ResourceType{
+		Name:     "Device",
+		Endpoint: "/Devices",
+		Schema:   getDeviceSchema(),
+		SchemaExtensions: []SchemaExtension{
+			{Schema: getAssetExtensionSchema()},
+		},
+	}
+}
+
+func getDeviceSchema() schema.Schema {
+	return schema.Schema{
+		ID: "urn:example:Device",
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name: "name",
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "serial",
+				Uniqueness: schema.AttributeUniquenessGlobal(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "model",
+				Mutability: schema.AttributeMutabilityImmutable(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "status",
+				Required:   true,
+				Mutability: schema.AttributeMutabilityReadOnly(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "pin",
+				Mutability: schema.AttributeMutabilityWriteOnly(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:     "secret",
+				Returned: schema.AttributeReturnedNever(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:     "firmware",
+				Returned: schema.AttributeReturnedRequest(),
+			})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				Name:        "addresses",
+				MultiValued: true,
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{
+						Name:       "value",
+						CaseExact:  true,
+						Uniqueness: schema.AttributeUniquenessServer(),
+					}),
+					schema.SimpleStringParams(schema.StringParams{
+						Name: "type",
+					}),
+				},
+			}),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				Name: "owner",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{
+						Name:       "value",
+						Mutability: schema.AttributeMutabilityImmutable(),
+					}),
+					schema.SimpleStringParams(schema.StringParams{
+						Name:       "display",
+						Mutability: schema.AttributeMutabilityReadOnly(),
+					}),
+					schema.SimpleStringParams(schema.StringParams{
+						Name:     "token",
+						Returned: schema.AttributeReturnedNever(),
+					}),
+					schema.SimpleStringParams(schema.StringParams{
+						Name:     "badge",
+						Returned: schema.AttributeReturnedRequest(),
+					}),
+				},
+			}),
+		},
+	}
+}
+
+func getAssetExtensionSchema() schema.Schema {
+	return schema.Schema{
+		ID: "urn:example:Asset",
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "tag",
+				Uniqueness: schema.AttributeUniquenessServer(),
+			})),
+		},
+	}
+}
+
 func newTestResourceHandler() ResourceHandler {
 	data := make(map[string]testData)
 
@@ -652,6 +760,8 @@ func TestServerResourcePatchHandlerFailOnBadType(t *testing.T) {
 	assert.NoError(t, err, "json unmarshalling failed")
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "status code mismatch")
+	assert.Equal(t, `Operations[0]: replace operation has an invalid value: active: expected boolean, got string "test"`,
+		resource["detail"])
 }
 
 func TestServerResourcePatchHandlerFailOnUndefinedAttribute(t *testing.T) {
@@ -32,14 +32,33 @@ type listResponse struct {
 	// This may be a subset of the full set of resources if pagination is requested.
 	// REQUIRED if TotalResults is non-zero.
 	Resources []interface{}
+
+	// Cursor indicates that the resources are paginated with a cursor instead of a start index, in which case the start
+	// index is left out.
+	Cursor bool
+
+	// NextCursor is the cursor of the next page of results, if any.
+	NextCursor string
+
+	// PreviousCursor is the cursor of the previous page of results, if any.
+	PreviousCursor string
 }
 
 func (l listResponse) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
+	raw := map[string]interface{}{
 		"schemas":      []string{"urn:ietf:params:scim:api:messages:2.0:ListResponse"},
 		"totalResults": l.TotalResults,
 		"itemsPerPage": l.ItemsPerPage,
-		"startIndex":   l.StartIndex,
 		"Resources":    l.Resources,
-	})
+	}
+	if !l.Cursor {
+		raw["startIndex"] = l.StartIndex
+	}
+	if l.NextCursor != "" {
+		raw["nextCursor"] = l.NextCursor
+	}
+	if l.PreviousCursor != "" {
+		raw["previousCursor"] = l.PreviousCursor
+	}
+	return json.Marshal(raw)
 }
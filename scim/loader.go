@@ -0,0 +1,130 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/optional"
+	"github.com/dgbttn/go-scim-server/schema"
+)
+
+const (
+	resourceTypeSchema = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	schemaSchema       = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// rawResourceType is the JSON representation of a resource type as defined in RFC 7643 section 6.
+type rawResourceType struct {
+	ID               *string
+	Name             string
+	Description      *string
+	Endpoint         string
+	Schema           string
+	SchemaExtensions []struct {
+		Schema   string
+		Required bool
+	}
+}
+
+// LoadResourceTypes reads the JSON documents, with the ".json" extension, in the given directory. Every document is
+// either a schema (RFC 7643 section 7) or a resource type (RFC 7643 section 6). A document is a resource type if its
+// "schemas" contain the resource type schema, or if it has an "endpoint". The (extension) schemas of the resource types
+// are defined by the schemas in the directory, or by the given schemas. The resource types are returned in the order
+// of their file names, without a handler.
+func LoadResourceTypes(dir string, schemas ...schema.Schema) ([]ResourceType, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]schema.Schema)
+	for _, s := range schemas {
+		known[s.ID] = s
+	}
+
+	var rawResourceTypes []rawResourceType
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var document struct {
+			Schemas  []string
+			Endpoint string
+		}
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		if contains(document.Schemas, resourceTypeSchema) || (document.Endpoint != "" && !contains(document.Schemas, schemaSchema)) {
+			var raw rawResourceType
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			rawResourceTypes = append(rawResourceTypes, raw)
+			continue
+		}
+
+		s, err := schema.FromJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if _, ok := known[s.ID]; ok {
+			return nil, fmt.Errorf("%s: duplicate schema %s", file, s.ID)
+		}
+		known[s.ID] = s
+	}
+
+	resourceTypes := make([]ResourceType, 0, len(rawResourceTypes))
+	for _, raw := range rawResourceTypes {
+		resourceType, err := raw.resourceType(known)
+		if err != nil {
+			return nil, err
+		}
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	return resourceTypes, nil
+}
+
+// resourceType converts the JSON representation to a resource type, of which the schemas are looked up in the given
+// schemas by their id.
+func (raw rawResourceType) resourceType(schemas map[string]schema.Schema) (ResourceType, error) {
+	if raw.Name == "" {
+		return ResourceType{}, fmt.Errorf("resource type has no name")
+	}
+	if !strings.HasPrefix(raw.Endpoint, "/") {
+		return ResourceType{}, fmt.Errorf("resource type %s has an invalid endpoint %q", raw.Name, raw.Endpoint)
+	}
+
+	s, ok := schemas[raw.Schema]
+	if !ok {
+		return ResourceType{}, fmt.Errorf("resource type %s has an unknown schema %q", raw.Name, raw.Schema)
+	}
+	resourceType := ResourceType{
+		Name:     raw.Name,
+		Endpoint: raw.Endpoint,
+		Schema:   s,
+	}
+	if raw.ID != nil {
+		resourceType.ID = optional.NewString(*raw.ID)
+	}
+	if raw.Description != nil {
+		resourceType.Description = optional.NewString(*raw.Description)
+	}
+
+	for _, extension := range raw.SchemaExtensions {
+		s, ok := schemas[extension.Schema]
+		if !ok {
+			return ResourceType{}, fmt.Errorf("resource type %s has an unknown schema extension %q", raw.Name, extension.Schema)
+		}
+		resourceType.SchemaExtensions = append(resourceType.SchemaExtensions, SchemaExtension{
+			Schema:   s,
+			Required: extension.Required,
+		})
+	}
+	return resourceType, nil
+}
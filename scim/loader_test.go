@@ -0,0 +1,80 @@
+package scim
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/optional"
+	"github.com/dgbttn/go-scim-server/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadResourceTypes(t *testing.T) {
+	resourceTypes, err := LoadResourceTypes("testdata/resource_types",
+		schema.CoreUserSchema(), schema.ExtensionEnterpriseUser())
+	assert.NoError(t, err)
+	if !assert.Len(t, resourceTypes, 2) {
+		return
+	}
+
+	device := resourceTypes[0]
+	assert.Equal(t, "Device", device.Name)
+	assert.Equal(t, optional.NewString("Device"), device.ID)
+	assert.Equal(t, "/Devices", device.Endpoint)
+	assert.Equal(t, "urn:example:params:scim:schemas:core:2.0:Device", device.Schema.ID)
+	assert.Len(t, device.Schema.Attributes, 3)
+	if assert.Len(t, device.SchemaExtensions, 1) {
+		assert.Equal(t, "urn:example:params:scim:schemas:extension:asset:2.0:Device", device.SchemaExtensions[0].Schema.ID)
+		assert.False(t, device.SchemaExtensions[0].Required)
+	}
+
+	unique := device.UniqueAttributes()
+	if assert.Len(t, unique, 2) {
+		assert.Equal(t, "serialNumber", unique[0].Path())
+		assert.True(t, unique[1].Global)
+	}
+
+	user := resourceTypes[1]
+	assert.Equal(t, "User", user.Name)
+	assert.Equal(t, schema.CoreUserSchema().ID, user.Schema.ID)
+	if assert.Len(t, user.SchemaExtensions, 1) {
+		assert.True(t, user.SchemaExtensions[0].Required)
+	}
+}
+
+func TestLoadResourceTypesInvalid(t *testing.T) {
+	for name, documents := range map[string]map[string]string{
+		"unknown schema": {
+			"device.json": `{"name": "Device", "endpoint": "/Devices", "schema": "urn:example:Device"}`,
+		},
+		"invalid endpoint": {
+			"device.json": `{
+				"schemas": ["urn:ietf:params:scim:schemas:core:2.0:ResourceType"],
+				"name": "Device",
+				"schema": "urn:example:Device"
+			}`,
+			"schema.json": `{"id": "urn:example:Device", "attributes": []}`,
+		},
+		"invalid schema": {
+			"schema.json": `{"id": "urn:example:Device", "attributes": [{"name": "serial", "type": "text"}]}`,
+		},
+		"invalid json": {
+			"schema.json": `{"id": "urn:example:Device"`,
+		},
+	} {
+		dir, err := ioutil.TempDir("", "resource_types")
+		if !assert.NoError(t, err) {
+			return
+		}
+		for file, document := range documents {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(document), 0600))
+		}
+
+		_, err = LoadResourceTypes(dir)
+		assert.Error(t, err, name)
+		_ = os.RemoveAll(dir)
+	}
+}
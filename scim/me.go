@@ -0,0 +1,137 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// MeMapping maps the "/Me" endpoint to the resource of the authenticated subject (RFC 7644 section 3.11).
+type MeMapping struct {
+	// ResourceType is the name of the resource type of the subjects, e.g. "User".
+	ResourceType string
+	// Attribute is the path of the attribute whose value is the subject, e.g. "userName". The subject is the id of the
+	// resource if it is empty.
+	Attribute string
+}
+
+// subjectKey is the key of the context value that holds the authenticated subject of a request.
+type subjectKey struct{}
+
+// WithSubject returns a copy of the context that holds the authenticated subject, e.g. the subject of a validated bearer
+// token. Authentication middleware uses it to pass the subject of a request to the server.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the authenticated subject held by the context, if any.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok && subject != ""
+}
+
+// meHandler receives an HTTP request to the "/Me" endpoint, and serves it as a request to the resource of the
+// authenticated subject. The endpoint is not implemented if no mapping of the subject is configured.
+func (s Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	if s.Me == nil {
+		errorHandler(w, r, &errors.ScimError{
+			Detail: "The /Me endpoint is not supported, as no mapping of the authenticated subject is configured.",
+			Status: http.StatusNotImplemented,
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		errorHandler(w, r, &errors.ScimError{
+			Detail: fmt.Sprintf("The %s-operation is not supported on the /Me endpoint.", r.Method),
+			Status: http.StatusNotImplemented,
+		})
+		return
+	}
+
+	subject, ok := SubjectFromContext(r.Context())
+	if !ok {
+		errorHandler(w, r, &errors.ScimError{
+			Detail: "The /Me endpoint requires an authenticated subject.",
+			Status: http.StatusUnauthorized,
+		})
+		return
+	}
+
+	resourceType, id, scimErr := s.resolveMe(r, subject)
+	if scimErr != nil {
+		errorHandler(w, r, scimErr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.resourceGetHandler(w, r, id, resourceType)
+	case http.MethodPut:
+		s.resourcePutHandler(w, r, id, resourceType)
+	case http.MethodPatch:
+		s.resourcePatchHandler(w, r, id, resourceType)
+	case http.MethodDelete:
+		s.resourceDeleteHandler(w, r, id, resourceType)
+	}
+}
+
+// resolveMe returns the resource type and the id of the resource of the authenticated subject. If the subject is mapped
+// to an attribute, the resource is looked up by its value, which has to identify a single resource.
+func (s Server) resolveMe(r *http.Request, subject string) (ResourceType, string, *errors.ScimError) {
+	var resourceType ResourceType
+	var found bool
+	for _, t := range s.ResourceTypes {
+		if t.Name == s.Me.ResourceType {
+			resourceType, found = t, true
+			break
+		}
+	}
+	if !found {
+		return ResourceType{}, "", &errors.ScimError{
+			Detail: fmt.Sprintf("The resource type %q of the authenticated subject does not exist.", s.Me.ResourceType),
+			Status: http.StatusInternalServerError,
+		}
+	}
+	if s.Me.Attribute == "" {
+		return resourceType, subject, nil
+	}
+
+	expression := attributeExpression(s.Me.Attribute, filter.EQ, subject)
+	if scimErr := NewFilterValidator(expression, resourceType).Validate(); scimErr != nil {
+		return ResourceType{}, "", &errors.ScimError{
+			Detail: fmt.Sprintf("The attribute %q of the authenticated subject can not be queried.", s.Me.Attribute),
+			Status: http.StatusInternalServerError,
+		}
+	}
+
+	// Two resources are requested, to detect an attribute that does not identify a single resource.
+	page, err := resourceType.Handler.GetAll(r, &ListRequestParams{
+		Count:      2,
+		Filter:     expression,
+		StartIndex: defaultStartIndex,
+	})
+	if err != nil {
+		scimErr := errors.CheckScimError(err, r.Method)
+		return ResourceType{}, "", &scimErr
+	}
+	switch len(page.Resources) {
+	case 0:
+		return ResourceType{}, "", &errors.ScimError{
+			Detail: "There is no resource of the authenticated subject.",
+			Status: http.StatusNotFound,
+		}
+	case 1:
+		return resourceType, page.Resources[0].ID, nil
+	default:
+		return ResourceType{}, "", &errors.ScimError{
+			Detail: fmt.Sprintf("The authenticated subject matches more than one resource by %q.", s.Me.Attribute),
+			Status: http.StatusInternalServerError,
+		}
+	}
+}
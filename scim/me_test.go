@@ -0,0 +1,94 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMeServer(t *testing.T, me *MeMapping) (Server, Resource) {
+	handler, _ := newTestStoreHandler()
+	resourceType := handler.resourceType
+	resourceType.Handler = handler
+
+	resource, err := handler.Create(httptest.NewRequest(http.MethodPost, "/Devices", nil), ResourceAttributes{
+		"serial": "SN-1",
+		"name":   "printer",
+	})
+	assert.NoError(t, err)
+	return Server{ResourceTypes: []ResourceType{resourceType}, Me: me}, resource
+}
+
+func doMeRequest(server Server, method, subject, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/Me", strings.NewReader(body))
+	if subject != "" {
+		r = r.WithContext(WithSubject(r.Context(), subject))
+	}
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestServerMeHandler(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		me      MeMapping
+		subject func(resource Resource) string
+	}{
+		{name: "id", me: MeMapping{ResourceType: "Device"}, subject: func(resource Resource) string { return resource.ID }},
+		{name: "attribute", me: MeMapping{ResourceType: "Device", Attribute: "serial"}, subject: func(Resource) string { return "sn-1" }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			me := test.me
+			server, resource := newTestMeServer(t, &me)
+			subject := test.subject(resource)
+
+			rr := doMeRequest(server, http.MethodGet, subject, "")
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var got map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, resource.ID, got["id"])
+			assert.Equal(t, "printer", got["name"])
+
+			rr = doMeRequest(server, http.MethodPatch, subject, `{
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [{"op": "replace", "path": "name", "value": "scanner"}]
+			}`)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), "scanner")
+
+			rr = doMeRequest(server, http.MethodPut, subject, `{
+				"schemas": ["urn:example:Device"],
+				"serial": "SN-1",
+				"name": "copier"
+			}`)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), "copier")
+
+			rr = doMeRequest(server, http.MethodDelete, subject, "")
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+			rr = doMeRequest(server, http.MethodGet, subject, "")
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+		})
+	}
+}
+
+func TestServerMeHandlerErrors(t *testing.T) {
+	server, _ := newTestMeServer(t, nil)
+	assert.Equal(t, http.StatusNotImplemented, doMeRequest(server, http.MethodGet, "SN-1", "").Code)
+
+	server.Me = &MeMapping{ResourceType: "Device", Attribute: "serial"}
+	assert.Equal(t, http.StatusUnauthorized, doMeRequest(server, http.MethodGet, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, doMeRequest(server, http.MethodGet, "SN-2", "").Code)
+	assert.Equal(t, http.StatusNotImplemented, doMeRequest(server, http.MethodPost, "SN-1", "{}").Code)
+
+	server.Me = &MeMapping{ResourceType: "Device", Attribute: "unknown"}
+	assert.Equal(t, http.StatusInternalServerError, doMeRequest(server, http.MethodGet, "SN-1", "").Code)
+
+	server.Me = &MeMapping{ResourceType: "User"}
+	assert.Equal(t, http.StatusInternalServerError, doMeRequest(server, http.MethodGet, "SN-1", "").Code)
+}
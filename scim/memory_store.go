@@ -0,0 +1,253 @@
+package scim
+
+import (
+	"context"
+	"sync"
+
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// MemoryDatabase keeps the resources of one or more resource types in memory. It is safe for concurrent use, and is
+// meant for tests and small deployments of which the resources do not need to outlive the process.
+type MemoryDatabase struct {
+	mu sync.RWMutex
+	// resources contains the stored resources by the name of their resource type and their id.
+	resources map[string]map[string]ResourceAttributes
+}
+
+// NewMemoryDatabase returns an empty in-memory database.
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{
+		resources: make(map[string]map[string]ResourceAttributes),
+	}
+}
+
+// Store returns the store of the resources of the given resource type. A transaction of any of the stores of the
+// database locks the whole database, so that transactions can span multiple resource types.
+func (d *MemoryDatabase) Store(resourceType ResourceType) Store {
+	return memoryStore{
+		database:     d,
+		resourceType: resourceType,
+	}
+}
+
+// memoryTransaction is the key of the context value that holds the database of which a transaction is in progress.
+type memoryTransaction struct{}
+
+// lock locks the database for reading or writing, unless the context is that of a transaction of the database, which
+// already holds the lock. The returned function releases the lock.
+func (d *MemoryDatabase) lock(ctx context.Context, write bool) func() {
+	if ctx.Value(memoryTransaction{}) == d {
+		return func() {}
+	}
+	if write {
+		d.mu.Lock()
+		return d.mu.Unlock
+	}
+	d.mu.RLock()
+	return d.mu.RUnlock
+}
+
+// collection returns the stored resources of the resource type with the given name.
+func (d *MemoryDatabase) collection(name string) map[string]ResourceAttributes {
+	c, ok := d.resources[name]
+	if !ok {
+		c = make(map[string]ResourceAttributes)
+		d.resources[name] = c
+	}
+	return c
+}
+
+// memoryStore is the store of the resources of a resource type within a memory database. The stored resources are
+// copied, so that they can not be modified through the values passed to or returned by the store.
+type memoryStore struct {
+	database     *MemoryDatabase
+	resourceType ResourceType
+}
+
+func (s memoryStore) Insert(ctx context.Context, resource ResourceAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer s.database.lock(ctx, true)()
+
+	resource = copyResource(resource)
+	id, _ := resource["id"].(string)
+	if err := s.checkUnique(id, resource); err != nil {
+		return err
+	}
+	s.database.collection(s.resourceType.Name)[id] = resource
+	return nil
+}
+
+func (s memoryStore) Find(ctx context.Context, id string) (ResourceAttributes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer s.database.lock(ctx, false)()
+
+	resource, ok := s.database.resources[s.resourceType.Name][id]
+	if !ok {
+		return nil, nil
+	}
+	return copyResource(resource), nil
+}
+
+func (s memoryStore) Query(ctx context.Context, query StoreQuery) ([]ResourceAttributes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer s.database.lock(ctx, false)()
+
+	resources, err := s.resourceType.QueryResources(s.resources(), query)
+	if err != nil {
+		return nil, err
+	}
+	page := make([]ResourceAttributes, len(resources))
+	for i, resource := range resources {
+		page[i] = copyResource(resource)
+	}
+	return page, nil
+}
+
+func (s memoryStore) Count(ctx context.Context, filter filter.Expression) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	defer s.database.lock(ctx, false)()
+
+	resources, err := s.resourceType.MatchResources(s.resources(), filter)
+	return len(resources), err
+}
+
+func (s memoryStore) InUse(ctx context.Context, attribute UniqueAttribute, id string, values []interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	defer s.database.lock(ctx, false)()
+
+	return s.inUse(attribute, id, values), nil
+}
+
+func (s memoryStore) Replace(ctx context.Context, id string, resource ResourceAttributes, version string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer s.database.lock(ctx, true)()
+
+	collection := s.database.collection(s.resourceType.Name)
+	stored, ok := collection[id]
+	if !ok {
+		return ErrVersionMismatch
+	}
+	if version != "" {
+		meta, _ := toMap(lookup(stored, "meta"))
+		if lookup(meta, "version") != version {
+			return ErrVersionMismatch
+		}
+	}
+
+	resource = copyResource(resource)
+	if err := s.checkUnique(id, resource); err != nil {
+		return err
+	}
+	collection[id] = resource
+	return nil
+}
+
+func (s memoryStore) Delete(ctx context.Context, id string, version string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer s.database.lock(ctx, true)()
+
+	collection := s.database.resources[s.resourceType.Name]
+	if version != "" {
+		meta, _ := toMap(lookup(collection[id], "meta"))
+		if lookup(meta, "version") != version {
+			return ErrVersionMismatch
+		}
+	}
+	delete(collection, id)
+	return nil
+}
+
+// Transaction calls fn while the database is locked. If fn returns an error, all the changes it made to the database
+// are rolled back.
+func (s memoryStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTransaction{}) == s.database {
+		// nested transactions are part of the transaction in progress
+		return fn(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.database.mu.Lock()
+	defer s.database.mu.Unlock()
+
+	snapshot := make(map[string]map[string]ResourceAttributes, len(s.database.resources))
+	for name, collection := range s.database.resources {
+		c := make(map[string]ResourceAttributes, len(collection))
+		for id, resource := range collection {
+			c[id] = resource
+		}
+		snapshot[name] = c
+	}
+
+	if err := fn(context.WithValue(ctx, memoryTransaction{}, s.database)); err != nil {
+		s.database.resources = snapshot
+		return err
+	}
+	return nil
+}
+
+// resources returns the stored resources. The caller has to hold the lock of the database.
+func (s memoryStore) resources() []ResourceAttributes {
+	collection := s.database.resources[s.resourceType.Name]
+	resources := make([]ResourceAttributes, 0, len(collection))
+	for _, resource := range collection {
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// checkUnique returns ErrDuplicateValue if the resource has the value of a unique attribute that is already in use, like
+// the unique indexes of a database would. The caller has to hold the lock of the database.
+func (s memoryStore) checkUnique(id string, resource ResourceAttributes) error {
+	for _, attribute := range s.resourceType.UniqueAttributes() {
+		if values := attribute.Values(resource); len(values) != 0 && s.inUse(attribute, id, values) {
+			return ErrDuplicateValue
+		}
+	}
+	return nil
+}
+
+// inUse returns whether a stored resource other than the one with the given id has one of the values of the unique
+// attribute. The caller has to hold the lock of the database.
+func (s memoryStore) inUse(attribute UniqueAttribute, id string, values []interface{}) bool {
+	leaf := attribute.Attribute
+	if attribute.SubAttribute != nil {
+		leaf = *attribute.SubAttribute
+	}
+	for storedID, resource := range s.database.resources[s.resourceType.Name] {
+		if storedID == id {
+			continue
+		}
+		for _, stored := range attribute.Values(resource) {
+			for _, value := range values {
+				if equalValues(leaf, stored, value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// copyResource returns a deep copy of the resource, in which all maps and slices are converted to
+// map[string]interface{} and []interface{} respectively.
+func copyResource(resource ResourceAttributes) ResourceAttributes {
+	c, _ := copyValue(map[string]interface{}(resource)).(map[string]interface{})
+	return c
+}
@@ -0,0 +1,172 @@
+package scim
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	filter "github.com/di-wu/scim-filter-parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMemoryStore(t *testing.T) Store {
+	store := NewMemoryDatabase().Store(newTestDeviceResourceType())
+	for _, resource := range []ResourceAttributes{
+		{"id": "0002", "serial": "SN-2", "name": "printer", "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0001", "serial": "SN-1", "name": "scanner", "meta": map[string]interface{}{"version": `W/"1"`}},
+		{"id": "0003", "serial": "SN-3", "meta": map[string]interface{}{"version": `W/"1"`}},
+	} {
+		assert.NoError(t, store.Insert(context.Background(), resource))
+	}
+	return store
+}
+
+func ids(resources []ResourceAttributes) []interface{} {
+	var ids []interface{}
+	for _, resource := range resources {
+		ids = append(ids, resource["id"])
+	}
+	return ids
+}
+
+func TestMemoryStoreQuery(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+
+	resources, err := store.Query(ctx, StoreQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002", "0003"}, ids(resources))
+
+	resources, err = store.Query(ctx, StoreQuery{SortBy: "name", SortOrder: SortOrderDescending, Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001"}, ids(resources))
+
+	expression := filter.AttributeExpression{
+		AttributePath:   filter.AttributePath{AttributeName: "name"},
+		CompareOperator: filter.PR,
+	}
+	resources, err = store.Query(ctx, StoreQuery{Filter: expression})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"0001", "0002"}, ids(resources))
+
+	count, err := store.Count(ctx, expression)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = store.Query(ctx, StoreQuery{SortBy: "unknown"})
+	assert.Equal(t, errors.ScimErrorBadParams([]string{"sortBy"}), err)
+
+	_, err = store.Count(ctx, filter.AttributeExpression{AttributePath: filter.AttributePath{AttributeName: "unknown"}})
+	assert.Equal(t, errors.ScimErrorInvalidFilter, err)
+}
+
+func TestMemoryStoreCopies(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+
+	resource, err := store.Find(ctx, "0001")
+	assert.NoError(t, err)
+	resource["name"] = "copier"
+
+	resource, err = store.Find(ctx, "0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "scanner", resource["name"])
+
+	resource, err = store.Find(ctx, "0004")
+	assert.NoError(t, err)
+	assert.Nil(t, resource)
+}
+
+func TestMemoryStoreReplace(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+
+	replaced := ResourceAttributes{"id": "0001", "serial": "SN-2", "meta": map[string]interface{}{"version": `W/"2"`}}
+	assert.Equal(t, ErrDuplicateValue, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	replaced["serial"] = "SN-4"
+	assert.Equal(t, ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"0"`))
+	assert.NoError(t, store.Replace(ctx, "0001", replaced, `W/"1"`))
+	assert.Equal(t, ErrVersionMismatch, store.Replace(ctx, "0001", replaced, `W/"1"`))
+
+	inUse, err := store.InUse(ctx, newTestDeviceResourceType().UniqueAttributes()[0], "0002", []interface{}{"SN-4"})
+	assert.NoError(t, err)
+	assert.True(t, inUse)
+
+	assert.Equal(t, ErrVersionMismatch, store.Delete(ctx, "0001", `W/"1"`))
+	assert.NoError(t, store.Delete(ctx, "0001", `W/"2"`))
+	assert.Equal(t, ErrVersionMismatch, store.Delete(ctx, "0001", `W/"2"`))
+	assert.NoError(t, store.Delete(ctx, "0001", ""))
+	count, err := store.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemoryStoreTransaction(t *testing.T) {
+	database := NewMemoryDatabase()
+	store := database.Store(newTestDeviceResourceType())
+	other := database.Store(ResourceType{Name: "Other"})
+	ctx := context.Background()
+
+	failure := goerrors.New("failure")
+	err := store.Transaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, store.Insert(ctx, ResourceAttributes{"id": "0001"}))
+		assert.NoError(t, other.Insert(ctx, ResourceAttributes{"id": "0001"}))
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	for _, s := range []Store{store, other} {
+		count, err := s.Count(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+	}
+
+	err = store.Transaction(ctx, func(ctx context.Context) error {
+		return other.Insert(ctx, ResourceAttributes{"id": "0001"})
+	})
+	assert.NoError(t, err)
+	count, err := other.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestMemoryStoreConcurrency(t *testing.T) {
+	store := NewMemoryDatabase().Store(newTestDeviceResourceType())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			errs <- store.Insert(context.Background(), ResourceAttributes{"id": fmt.Sprintf("%04d", id), "serial": "SN-1"})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	// only one of the resources can have the unique serial number
+	var inserted int
+	for err := range errs {
+		if err == nil {
+			inserted++
+		} else {
+			assert.Equal(t, ErrDuplicateValue, err)
+		}
+	}
+	assert.Equal(t, 1, inserted)
+}
+
+func TestMemoryStoreCancelled(t *testing.T) {
+	store := NewMemoryDatabase().Store(newTestDeviceResourceType())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, store.Insert(ctx, ResourceAttributes{"id": "0001"}))
+	_, err := store.Find(ctx, "0001")
+	assert.Equal(t, context.Canceled, err)
+}
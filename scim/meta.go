@@ -19,3 +19,21 @@ type meta struct {
 	// response header.
 	Version string `json:"version,omitempty"`
 }
+
+// getRaw returns the JSON representation of the meta attribute, without the sub-attributes that are not set.
+func (m meta) getRaw() map[string]interface{} {
+	raw := map[string]interface{}{
+		"resourceType": m.ResourceType,
+		"location":     m.Location,
+	}
+	if m.Created != "" {
+		raw["created"] = m.Created
+	}
+	if m.LastModified != "" {
+		raw["lastModified"] = m.LastModified
+	}
+	if m.Version != "" {
+		raw["version"] = m.Version
+	}
+	return raw
+}
@@ -0,0 +1,115 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
+)
+
+// withoutReadOnly returns a copy of the raw attributes of a resource without the values of the read only attributes
+// and sub-attributes. Clients can not define these values, so they are ignored when a resource is created or replaced.
+func withoutReadOnly(attributes []schema.CoreAttribute, raw interface{}) interface{} {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return raw
+	}
+
+	writable := make(map[string]interface{}, len(m))
+	for name, value := range m {
+		attr, ok := findCoreAttribute(attributes, name)
+		switch {
+		case !ok:
+			writable[name] = value
+		case attr.Mutability() == schema.AttributeMutabilityReadOnly():
+		case attr.AttributeType() == "complex" && attr.MultiValued():
+			elements, ok := value.([]interface{})
+			if !ok {
+				writable[name] = value
+				continue
+			}
+			writableElements := make([]interface{}, len(elements))
+			for i, element := range elements {
+				writableElements[i] = withoutReadOnly(attr.SubAttributes(), element)
+			}
+			writable[name] = writableElements
+		case attr.AttributeType() == "complex":
+			writable[name] = withoutReadOnly(attr.SubAttributes(), value)
+		default:
+			writable[name] = value
+		}
+	}
+	return writable
+}
+
+// keepImmutable checks that the values of the immutable attributes of a replaced resource match their current values.
+// Immutable attributes that do not have a value yet can be defined, and omitted immutable attributes keep their
+// current value. The immutable sub-attributes of multi-valued complex attributes are not checked, as the values of
+// those attributes can not be matched with their current values.
+func keepImmutable(attributes []schema.CoreAttribute, replaced map[string]interface{}, current interface{}) *errors.ScimError {
+	currentAttributes, _ := toMap(current)
+	for _, attr := range attributes {
+		value, ok := immutableValue(attr, replaced[attr.Name()], lookup(currentAttributes, attr.Name()))
+		if !ok {
+			return &errors.ScimErrorMutability
+		}
+		if value != nil {
+			replaced[attr.Name()] = value
+		}
+	}
+	return nil
+}
+
+// immutableValue returns the value of the attribute after it is replaced by the given value, and whether the
+// replacement respects the mutability of the attribute and its sub-attributes.
+func immutableValue(attr schema.CoreAttribute, value, current interface{}) (interface{}, bool) {
+	if current == nil {
+		return value, true
+	}
+	if attr.Mutability() == schema.AttributeMutabilityImmutable() {
+		if value == nil {
+			return current, true
+		}
+		return value, equalValues(attr, value, current)
+	}
+	if attr.AttributeType() != "complex" || attr.MultiValued() {
+		return value, true
+	}
+
+	currentValues, _ := toMap(current)
+	values, _ := toMap(value)
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	for _, sub := range attr.SubAttributes() {
+		subValue, ok := immutableValue(sub, values[sub.Name()], lookup(currentValues, sub.Name()))
+		if !ok {
+			return nil, false
+		}
+		if subValue != nil {
+			values[sub.Name()] = subValue
+		}
+	}
+	if value == nil && len(values) == 0 {
+		return nil, true
+	}
+	return values, true
+}
+
+// equalValues returns whether two values of the attribute are equal. Strings of attributes that are not case exact
+// are compared case-insensitively.
+func equalValues(attr schema.CoreAttribute, a, b interface{}) bool {
+	if x, ok := a.(string); ok && !attr.CaseExact() {
+		y, ok := b.(string)
+		return ok && strings.EqualFold(x, y)
+	}
+	x, xErr := json.Marshal(a)
+	y, yErr := json.Marshal(b)
+	return xErr == nil && yErr == nil && string(x) == string(y)
+}
+
+func findCoreAttribute(attributes []schema.CoreAttribute, name string) (schema.CoreAttribute, bool) {
+	attr, ok := findAttribute("", attributes, name)
+	return attr.attribute, ok
+}
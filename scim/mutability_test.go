@@ -0,0 +1,115 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceTypeValidateReadOnly(t *testing.T) {
+	resourceType := newTestDeviceResourceType()
+
+	attributes, scimErr := resourceType.validate([]byte(`{
+		"name": "printer",
+		"status": 1,
+		"owner": {"value": "bjensen", "display": "Barbara"}
+	}`), nil)
+	assert.Nil(t, scimErr)
+	assert.Equal(t, "printer", attributes["name"])
+	assert.Nil(t, attributes["status"])
+	owner := attributes["owner"].(map[string]interface{})
+	assert.Equal(t, "bjensen", owner["value"])
+	assert.Nil(t, owner["display"])
+}
+
+func TestResourceTypeValidateImmutable(t *testing.T) {
+	resourceType := newTestDeviceResourceType()
+	current := Resource{
+		ID: "0001",
+		Attributes: ResourceAttributes{
+			"name":  "printer",
+			"model": "M-1",
+			"owner": map[string]interface{}{"value": "bjensen"},
+		},
+	}
+
+	for _, body := range []string{
+		`{"name": "scanner", "model": "M-1", "owner": {"value": "bjensen"}}`,
+		`{"name": "scanner", "model": "m-1"}`,
+	} {
+		attributes, scimErr := resourceType.validate([]byte(body), &current)
+		assert.Nil(t, scimErr, body)
+		assert.Equal(t, "scanner", attributes["name"])
+		// Omitted immutable values are kept.
+		assert.NotNil(t, attributes["model"])
+		assert.Equal(t, "bjensen", attributes["owner"].(map[string]interface{})["value"])
+	}
+
+	for _, body := range []string{
+		`{"model": "M-2"}`,
+		`{"owner": {"value": "jsmith"}}`,
+	} {
+		_, scimErr := resourceType.validate([]byte(body), &current)
+		if assert.NotNil(t, scimErr, body) {
+			assert.Equal(t, errors.ScimErrorMutability, *scimErr)
+		}
+	}
+
+	// Immutable attributes without a value can be defined.
+	attributes, scimErr := resourceType.validate([]byte(`{"model": "M-1", "owner": {"value": "jsmith"}}`),
+		&Resource{ID: "0002", Attributes: ResourceAttributes{"model": "M-1"}})
+	assert.Nil(t, scimErr)
+	assert.Equal(t, "jsmith", attributes["owner"].(map[string]interface{})["value"])
+}
+
+func TestResourceRenderWriteOnly(t *testing.T) {
+	resourceType := newTestDeviceResourceType()
+	resource := Resource{
+		ID:         "0001",
+		Attributes: ResourceAttributes{"name": "printer", "pin": "1234"},
+	}
+
+	rendered := resource.render(resourceType, resourceProjection{
+		specified: resourceType.specifiedAttributes(map[string]interface{}{"pin": "1234"}),
+	})
+	assert.Equal(t, "printer", rendered["name"])
+	assert.NotContains(t, rendered, "pin")
+}
+
+func TestServerResourcePutHandlerImmutable(t *testing.T) {
+	server := newTestServer()
+	_, _ = server.ResourceTypes[0].Handler.Replace(nil, "0001", ResourceAttributes{
+		"userName":       "test1",
+		"immutableThing": "original",
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/Users/0001", strings.NewReader(
+		`{"userName": "test1", "immutableThing": "changed"}`,
+	))
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "status code mismatch")
+
+	var scimErr errors.ScimError
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scimErr))
+	assert.Equal(t, errors.ScimTypeMutability, scimErr.ScimType)
+
+	req = httptest.NewRequest(http.MethodPut, "/Users/0001", strings.NewReader(
+		`{"userName": "other", "readonlyThing": "ignored"}`,
+	))
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "status code mismatch")
+
+	var resource map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resource))
+	assert.Equal(t, "other", resource["userName"])
+	assert.Equal(t, "original", resource["immutableThing"])
+	assert.Nil(t, resource["readonlyThing"])
+}
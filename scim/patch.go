@@ -1,8 +1,11 @@
 package scim
 
 import (
+	"reflect"
 	"strings"
 
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
 	filter "github.com/di-wu/scim-filter-parser"
 )
 
@@ -30,17 +33,514 @@ type PatchRequest struct {
 	Operations []PatchOperation
 }
 
-// GetPathFilter parses patch operation path to determine if it is a attribute filter.
-// If it is, filter.Expression will be returned, nil otherwise.
+// GetPath parses the path of the patch operation, e.g. "name.givenName" or `members[value eq "2819c223"]`.
+func (p PatchOperation) GetPath() (filter.Path, error) {
+	return filter.NewParser(strings.NewReader(p.Path)).ParsePath()
+}
+
+// GetPathFilter parses patch operation path to determine if it is a attribute filter, e.g.
+// `members[value eq "2819c223"]`. If it is, filter.Expression will be returned, nil otherwise.
 func (p PatchOperation) GetPathFilter() *filter.AttributeExpression {
-	parser := filter.NewParser(strings.NewReader(p.Path))
-	pathFilter, err := parser.Parse()
+	path, err := p.GetPath()
 	if err != nil {
 		return nil
 	}
 
-	if attrFilter, ok := pathFilter.(filter.AttributeExpression); ok {
+	if attrFilter, ok := path.ValueExpression.(filter.AttributeExpression); ok {
 		return &attrFilter
 	}
 	return nil
 }
+
+// GetValuePath returns the value filter of the patch operation path as a filter expression that selects the resources
+// with a matching value, e.g. `members[value eq "2819c223"]`. It returns nil if the path has no value filter.
+func (p PatchOperation) GetValuePath() filter.Expression {
+	path, err := p.GetPath()
+	if err != nil || path.ValueExpression == nil {
+		return nil
+	}
+
+	return filter.ValuePath{
+		AttributeName:   path.AttributeName,
+		ValueExpression: path.ValueExpression,
+	}
+}
+
+// ApplyPatch applies the operations of a patch request to the attributes of a resource of the resource type, as
+// described in RFC 7644 section 3.5.2, and returns the patched attributes. The given attributes are not modified.
+//
+// The path of an operation can reference a sub-attribute, e.g. "name.givenName", select the values of a multi-valued
+// attribute with a filter, e.g. `emails[type eq "work"].value`, and can be qualified with the URI of the schema of the
+// attribute, e.g. "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value". At most one value of a
+// multi-valued attribute can be primary, so values that are no longer primary are updated accordingly.
+//
+// The patched attributes are validated like those of a replaced resource, so that a patch can not remove a required
+// attribute, set a value of the wrong type or change an immutable value. Only the attributes of the schemas of the
+// resource type are returned, without the values that are not set.
+//
+// The returned error is an errors.ScimError, so that resource handlers can return it as is.
+func (t ResourceType) ApplyPatch(attributes ResourceAttributes, patch PatchRequest) (ResourceAttributes, error) {
+	patched, _ := copyValue(map[string]interface{}(attributes)).(map[string]interface{})
+	if patched == nil {
+		patched = make(map[string]interface{})
+	}
+
+	for _, op := range patch.Operations {
+		if scimErr := t.applyPatchOperation(patched, op); scimErr != nil {
+			return nil, *scimErr
+		}
+	}
+
+	validated, scimErr := t.validateAttributes(patched, &Resource{Attributes: attributes})
+	if scimErr != nil {
+		return nil, *scimErr
+	}
+	result, _ := withoutNil(map[string]interface{}(validated)).(map[string]interface{})
+	if result == nil {
+		result = make(map[string]interface{})
+	}
+	return result, nil
+}
+
+func (t ResourceType) applyPatchOperation(attributes map[string]interface{}, op PatchOperation) *errors.ScimError {
+	op.Op = strings.ToLower(op.Op)
+
+	if op.Path == "" {
+		// The target of an operation without a path is the resource itself.
+		if op.Op == PatchOperationRemove {
+			return &errors.ScimErrorNoTarget
+		}
+		values, ok := toMap(op.Value)
+		if !ok {
+			return &errors.ScimErrorInvalidValue
+		}
+		for key, value := range values {
+			extension, ok := t.getExtension(key)
+			if !ok {
+				if scimErr := t.applyPatchOperation(attributes, PatchOperation{Op: op.Op, Path: key, Value: value}); scimErr != nil {
+					return scimErr
+				}
+				continue
+			}
+
+			// The attributes of a schema extension are grouped by the URI of the extension.
+			extensionValues, ok := toMap(value)
+			if !ok {
+				return &errors.ScimErrorInvalidValue
+			}
+			for name, v := range extensionValues {
+				path := extension.Schema.ID + ":" + name
+				if scimErr := t.applyPatchOperation(attributes, PatchOperation{Op: op.Op, Path: path, Value: v}); scimErr != nil {
+					return scimErr
+				}
+			}
+		}
+		return nil
+	}
+
+	path, scimErr := t.parsePatchPath(op.Path)
+	if scimErr != nil {
+		return scimErr
+	}
+
+	container := attributes
+	if path.attribute.schemaID != "" {
+		if op.Op == PatchOperationRemove {
+			container, _ = toMap(lookup(attributes, path.attribute.schemaID))
+		} else {
+			container = childMap(attributes, path.attribute.schemaID)
+		}
+	}
+
+	switch op.Op {
+	case PatchOperationAdd, PatchOperationReplace:
+		scimErr = path.set(container, op.Op, op.Value)
+	case PatchOperationRemove:
+		scimErr = path.remove(container, op.Value)
+	default:
+		return &errors.ScimErrorInvalidSyntax
+	}
+	if scimErr != nil {
+		return scimErr
+	}
+
+	if path.attribute.schemaID != "" && len(container) == 0 {
+		deleteKey(attributes, path.attribute.schemaID)
+	}
+	return nil
+}
+
+// patchPath is the parsed path of a patch operation.
+type patchPath struct {
+	attribute schemaAttribute
+	// subAttribute is the referenced sub-attribute, or nil if the path references the attribute itself.
+	subAttribute *schema.CoreAttribute
+	// valueFilter selects the values of a multi-valued attribute, or is nil if the path has no value filter.
+	valueFilter filter.Expression
+}
+
+// parsePatchPath parses the path of a patch operation and resolves the attributes it references.
+func (t ResourceType) parsePatchPath(raw string) (patchPath, *errors.ScimError) {
+	// The filter parser drops the URI of the schema, so it is split off first.
+	var schemaID string
+	path := raw
+	for _, id := range append([]string{t.Schema.ID}, t.schemaExtensionIDs()...) {
+		if len(path) > len(id) && strings.EqualFold(path[:len(id)+1], id+":") {
+			schemaID, path = id, path[len(id)+1:]
+			break
+		}
+	}
+	if schemaID == "" && strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return patchPath{}, &errors.ScimErrorInvalidPath
+	}
+
+	parsed, err := filter.NewParser(strings.NewReader(path)).ParsePath()
+	if err != nil {
+		return patchPath{}, &errors.ScimErrorInvalidPath
+	}
+
+	name := parsed.AttributeName
+	if schemaID != "" {
+		name = schemaID + ":" + name
+	}
+	attr, ok := t.getAttribute(name)
+	if !ok {
+		return patchPath{}, &errors.ScimErrorInvalidPath
+	}
+
+	p := patchPath{attribute: attr}
+	if parsed.ValueExpression != nil {
+		if !attr.attribute.MultiValued() || attr.attribute.AttributeType() != "complex" {
+			return patchPath{}, &errors.ScimErrorInvalidPath
+		}
+		if scimErr := NewFilterValidator(nil, t).validate(parsed.ValueExpression, &attr.attribute); scimErr != nil {
+			return patchPath{}, &errors.ScimErrorInvalidPath
+		}
+		p.valueFilter = parsed.ValueExpression
+	}
+	if parsed.SubAttribute != "" {
+		sub, ok := attr.attribute.SubAttribute(parsed.SubAttribute)
+		if !ok {
+			return patchPath{}, &errors.ScimErrorInvalidPath
+		}
+		p.subAttribute = &sub
+	}
+	return p, nil
+}
+
+func (t ResourceType) schemaExtensionIDs() []string {
+	ids := make([]string, len(t.SchemaExtensions))
+	for i, extension := range t.SchemaExtensions {
+		ids[i] = extension.Schema.ID
+	}
+	return ids
+}
+
+// set applies an "add" or "replace" operation to the target of the path within the given container. Values are added
+// to multi-valued attributes and merged into complex attributes, while they replace the existing values otherwise.
+func (p patchPath) set(container map[string]interface{}, op string, value interface{}) *errors.ScimError {
+	attr := p.attribute.attribute
+	name := attr.Name()
+	value = copyValue(value)
+
+	if !attr.MultiValued() {
+		if p.subAttribute != nil {
+			setKey(childMap(container, name), p.subAttribute.Name(), value)
+			return nil
+		}
+		if attr.AttributeType() == "complex" {
+			values, ok := toMap(value)
+			if !ok {
+				return &errors.ScimErrorInvalidValue
+			}
+			current := childMap(container, name)
+			for k, v := range values {
+				setKey(current, k, v)
+			}
+			return nil
+		}
+		setKey(container, name, value)
+		return nil
+	}
+
+	elements, _ := toSlice(lookup(container, name))
+	changed := make(map[int]bool)
+
+	switch {
+	case p.valueFilter != nil || p.subAttribute != nil:
+		matched := p.matches(elements)
+		if len(matched) == 0 {
+			// only "add" creates the value it targets, a "replace" of a value that does not exist has no target
+			element, ok := p.newElement()
+			if !ok || op != PatchOperationAdd {
+				return &errors.ScimErrorNoTarget
+			}
+			elements = append(elements, element)
+			matched = []int{len(elements) - 1}
+		}
+		for _, i := range matched {
+			element, _ := toMap(elements[i])
+			switch {
+			case p.subAttribute != nil:
+				setKey(element, p.subAttribute.Name(), value)
+			case op == PatchOperationReplace:
+				values, ok := toMap(value)
+				if !ok {
+					return &errors.ScimErrorInvalidValue
+				}
+				element = values
+			default:
+				values, ok := toMap(value)
+				if !ok {
+					return &errors.ScimErrorInvalidValue
+				}
+				for k, v := range values {
+					setKey(element, k, v)
+				}
+			}
+			elements[i] = element
+			changed[i] = true
+		}
+	case op == PatchOperationReplace:
+		elements = asSlice(value)
+		for i := range elements {
+			changed[i] = true
+		}
+	default:
+		for _, v := range asSlice(value) {
+			if containsValue(elements, v) {
+				continue
+			}
+			elements = append(elements, v)
+			changed[len(elements)-1] = true
+		}
+	}
+
+	if scimErr := p.enforcePrimary(elements, changed); scimErr != nil {
+		return scimErr
+	}
+	setValues(container, name, elements)
+	return nil
+}
+
+// remove applies a "remove" operation to the target of the path within the given container. The value of the
+// operation, if any, selects the values of a multi-valued attribute that are removed.
+func (p patchPath) remove(container map[string]interface{}, value interface{}) *errors.ScimError {
+	attr := p.attribute.attribute
+	name := attr.Name()
+	if container == nil {
+		return nil
+	}
+
+	if !attr.MultiValued() {
+		if p.subAttribute == nil {
+			deleteKey(container, name)
+			return nil
+		}
+		if current, ok := toMap(lookup(container, name)); ok {
+			deleteKey(current, p.subAttribute.Name())
+			if len(current) == 0 {
+				deleteKey(container, name)
+			}
+		}
+		return nil
+	}
+
+	elements, _ := toSlice(lookup(container, name))
+	remaining := make([]interface{}, 0, len(elements))
+	switch {
+	case p.valueFilter != nil || p.subAttribute != nil:
+		matched := make(map[int]bool)
+		for _, i := range p.matches(elements) {
+			matched[i] = true
+		}
+		for i, e := range elements {
+			if !matched[i] {
+				remaining = append(remaining, e)
+				continue
+			}
+			if p.subAttribute == nil {
+				continue
+			}
+			element, _ := toMap(e)
+			deleteKey(element, p.subAttribute.Name())
+			remaining = append(remaining, element)
+		}
+	case value != nil:
+		// Some clients select the values to remove with the value of the operation instead of a filter.
+		selected := asSlice(copyValue(value))
+		for _, e := range elements {
+			if !containsValue(selected, e) {
+				remaining = append(remaining, e)
+			}
+		}
+	}
+
+	setValues(container, name, remaining)
+	return nil
+}
+
+// matches returns the indices of the values of a multi-valued attribute that match the value filter of the path. All
+// the values match if the path has no value filter.
+func (p patchPath) matches(elements []interface{}) []int {
+	var matched []int
+	for i, e := range elements {
+		element, ok := toMap(e)
+		if !ok {
+			continue
+		}
+		if p.valueFilter == nil || (FilterValidator{}).evaluate(p.valueFilter, &p.attribute.attribute, element) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// newElement returns a new value of a multi-valued attribute that matches the value filter of the path, so that a
+// sub-attribute can be added to a value that does not exist yet, e.g. `addresses[type eq "work"].locality`. This is
+// only possible if the filter is a single "eq" comparison.
+func (p patchPath) newElement() (map[string]interface{}, bool) {
+	e, ok := p.valueFilter.(filter.AttributeExpression)
+	if !ok || p.subAttribute == nil || e.CompareOperator != filter.EQ || e.AttributePath.SubAttribute != "" {
+		return nil, false
+	}
+	sub, ok := p.attribute.attribute.SubAttribute(e.AttributePath.AttributeName)
+	if !ok {
+		return nil, false
+	}
+
+	var value interface{} = e.CompareValue
+	switch sub.AttributeType() {
+	case "boolean":
+		value = strings.EqualFold(e.CompareValue, "true")
+	case "integer", "decimal":
+		return nil, false
+	}
+	return map[string]interface{}{sub.Name(): value}, true
+}
+
+// enforcePrimary makes sure that at most one of the values of a multi-valued attribute is primary. If one of the
+// changed values is primary, the other values are no longer primary. More than one changed primary value is invalid.
+func (p patchPath) enforcePrimary(elements []interface{}, changed map[int]bool) *errors.ScimError {
+	primary, ok := p.attribute.attribute.SubAttribute("primary")
+	if !ok {
+		return nil
+	}
+
+	isPrimary := func(e interface{}) bool {
+		element, _ := toMap(e)
+		return lookup(element, primary.Name()) == true
+	}
+
+	newPrimary := -1
+	for i, e := range elements {
+		if changed[i] && isPrimary(e) {
+			if newPrimary != -1 {
+				return &errors.ScimErrorInvalidValue
+			}
+			newPrimary = i
+		}
+	}
+
+	if newPrimary == -1 {
+		return nil
+	}
+	for i, e := range elements {
+		if i != newPrimary && isPrimary(e) {
+			element, _ := toMap(e)
+			setKey(element, primary.Name(), false)
+			elements[i] = element
+		}
+	}
+	return nil
+}
+
+// copyValue returns a deep copy of the given value, in which all maps and slices are converted to
+// map[string]interface{} and []interface{} respectively.
+func copyValue(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, string, []byte:
+		return value
+	}
+	if m, ok := toMap(value); ok {
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[k] = copyValue(v)
+		}
+		return c
+	}
+	if s, ok := toSlice(value); ok {
+		c := make([]interface{}, len(s))
+		for i, v := range s {
+			c[i] = copyValue(v)
+		}
+		return c
+	}
+	return value
+}
+
+// asSlice returns the values of a multi-valued attribute. A single value is wrapped in a slice.
+func asSlice(value interface{}) []interface{} {
+	if s, ok := toSlice(value); ok {
+		return s
+	}
+	if value == nil {
+		return nil
+	}
+	return []interface{}{value}
+}
+
+// containsValue returns whether one of the values of a multi-valued attribute equals the given value. Complex values
+// are compared by their "value" sub-attribute if both have one.
+func containsValue(elements []interface{}, value interface{}) bool {
+	for _, e := range elements {
+		a, aOk := toMap(e)
+		b, bOk := toMap(value)
+		if aOk && bOk {
+			if av, bv := lookup(a, "value"), lookup(b, "value"); av != nil && bv != nil {
+				if reflect.DeepEqual(av, bv) {
+					return true
+				}
+				continue
+			}
+		}
+		if reflect.DeepEqual(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// childMap returns the complex value of the given key, which is created if it does not exist yet.
+func childMap(container map[string]interface{}, key string) map[string]interface{} {
+	m, ok := toMap(lookup(container, key))
+	if !ok {
+		m = make(map[string]interface{})
+	}
+	setKey(container, key, m)
+	return m
+}
+
+// setValues sets the values of a multi-valued attribute, or removes the attribute if there are no values.
+func setValues(container map[string]interface{}, key string, values []interface{}) {
+	if len(values) == 0 {
+		deleteKey(container, key)
+		return
+	}
+	setKey(container, key, values)
+}
+
+// setKey sets the value of the given key, replacing the values of keys that only differ in case.
+func setKey(m map[string]interface{}, key string, value interface{}) {
+	deleteKey(m, key)
+	m[key] = value
+}
+
+// deleteKey removes the given key, matched case-insensitively.
+func deleteKey(m map[string]interface{}, key string) {
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package scim
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
+	filter "github.com/di-wu/scim-filter-parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchOperationGetPathFilter(t *testing.T) {
+	op := PatchOperation{Op: PatchOperationRemove, Path: `members[value eq "2819c223"]`}
+	pathFilter := op.GetPathFilter()
+	if assert.NotNil(t, pathFilter) {
+		assert.Equal(t, "value", pathFilter.AttributePath.AttributeName)
+		assert.Equal(t, filter.EQ, pathFilter.CompareOperator)
+		assert.Equal(t, "2819c223", pathFilter.CompareValue)
+	}
+
+	for _, path := range []string{"members", "name.givenName", "members[value eq"} {
+		op := PatchOperation{Op: PatchOperationRemove, Path: path}
+		assert.Nil(t, op.GetPathFilter(), path)
+		assert.Nil(t, op.GetValuePath(), path)
+	}
+}
+
+func TestPatchOperationGetValuePath(t *testing.T) {
+	resourceType := ResourceType{
+		Name:     "Group",
+		Endpoint: "/Groups",
+		Schema:   schema.CoreGroupSchema(),
+	}
+
+	op := PatchOperation{Op: PatchOperationRemove, Path: `members[value eq "0001" or value eq "0002"]`}
+	assert.Nil(t, NewFilterValidator(op.GetValuePath(), resourceType).Validate())
+
+	for value, expected := range map[string]bool{"0001": true, "0002": true, "0003": false} {
+		member := ResourceAttributes{
+			"members": []interface{}{map[string]interface{}{"value": value}},
+		}
+		matches, err := resourceType.MatchResources([]ResourceAttributes{member}, op.GetValuePath())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, len(matches) == 1, value)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/Groups/0001", strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"0001\"]"}]
+	}`))
+	_, scimErr := resourceType.validatePatch(req)
+	assert.Nil(t, scimErr)
+}
+
+func TestValidatePatchSubAttribute(t *testing.T) {
+	for _, path := range []string{
+		"name.givenName",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value",
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/Users/0001", strings.NewReader(`{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "replace", "path": "`+path+`", "value": "0002"}]
+		}`))
+		_, scimErr := newTestCoreUserResourceType().validatePatch(req)
+		assert.Nil(t, scimErr, path)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/Users/0001", strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "name.unknown", "value": "0002"}]
+	}`))
+	_, scimErr := newTestCoreUserResourceType().validatePatch(req)
+	assert.NotNil(t, scimErr)
+}
+
+func TestValidatePatchFilteredSubAttribute(t *testing.T) {
+	for value, valid := range map[string]bool{`"babs@example.com"`: true, `123`: false} {
+		req := httptest.NewRequest(http.MethodPatch, "/Users/0001", strings.NewReader(`{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "replace", "path": "emails[type eq \"work\"].value", "value": `+value+`}]
+		}`))
+		_, scimErr := newTestCoreUserResourceType().validatePatch(req)
+		assert.Equal(t, valid, scimErr == nil, value)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/Users/0001", strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "emails[type eq \"work\"]", "value": {"value": 123}}]
+	}`))
+	_, scimErr := newTestCoreUserResourceType().validatePatch(req)
+	assert.NotNil(t, scimErr)
+}
+
+func newTestPatchAttributes() ResourceAttributes {
+	return ResourceAttributes{
+		"userName": "bjensen",
+		"name": map[string]interface{}{
+			"givenName":  "Barbara",
+			"familyName": "Jensen",
+		},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "bjensen@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "babs@jensen.org", "type": "home"},
+		},
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	const extensionID = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+	tests := []struct {
+		name     string
+		op       PatchOperation
+		expected func(ResourceAttributes)
+	}{
+		{
+			name: "replace sub-attribute",
+			op:   PatchOperation{Op: PatchOperationReplace, Path: "name.givenName", Value: "Babs"},
+			expected: func(attributes ResourceAttributes) {
+				attributes["name"] = map[string]interface{}{"givenName": "Babs", "familyName": "Jensen"}
+			},
+		},
+		{
+			name: "replace filtered sub-attribute",
+			op:   PatchOperation{Op: PatchOperationReplace, Path: `emails[type eq "work"].value`, Value: "barbara@example.com"},
+			expected: func(attributes ResourceAttributes) {
+				attributes["emails"] = []interface{}{
+					map[string]interface{}{"value": "barbara@example.com", "type": "work", "primary": true},
+					map[string]interface{}{"value": "babs@jensen.org", "type": "home"},
+				}
+			},
+		},
+		{
+			name: "add primary value",
+			op: PatchOperation{Op: PatchOperationAdd, Path: "emails", Value: []interface{}{
+				map[string]interface{}{"value": "bj@example.com", "type": "other", "primary": true},
+			}},
+			expected: func(attributes ResourceAttributes) {
+				attributes["emails"] = []interface{}{
+					map[string]interface{}{"value": "bjensen@example.com", "type": "work", "primary": false},
+					map[string]interface{}{"value": "babs@jensen.org", "type": "home"},
+					map[string]interface{}{"value": "bj@example.com", "type": "other", "primary": true},
+				}
+			},
+		},
+		{
+			name: "add existing value",
+			op: PatchOperation{Op: PatchOperationAdd, Path: "emails", Value: map[string]interface{}{
+				"value": "babs@jensen.org", "type": "home",
+			}},
+			expected: func(attributes ResourceAttributes) {},
+		},
+		{
+			name: "add filtered sub-attribute of new value",
+			op:   PatchOperation{Op: PatchOperationAdd, Path: `addresses[type eq "work"].locality`, Value: "Hollywood"},
+			expected: func(attributes ResourceAttributes) {
+				attributes["addresses"] = []interface{}{
+					map[string]interface{}{"type": "work", "locality": "Hollywood"},
+				}
+			},
+		},
+		{
+			name: "remove filtered value",
+			op:   PatchOperation{Op: PatchOperationRemove, Path: `emails[type eq "home"]`},
+			expected: func(attributes ResourceAttributes) {
+				attributes["emails"] = []interface{}{
+					map[string]interface{}{"value": "bjensen@example.com", "type": "work", "primary": true},
+				}
+			},
+		},
+		{
+			name: "remove multi-valued attribute",
+			op:   PatchOperation{Op: PatchOperationRemove, Path: "emails"},
+			expected: func(attributes ResourceAttributes) {
+				delete(attributes, "emails")
+			},
+		},
+		{
+			name: "remove last sub-attribute",
+			op:   PatchOperation{Op: PatchOperationRemove, Path: "name.givenName"},
+			expected: func(attributes ResourceAttributes) {
+				attributes["name"] = map[string]interface{}{"familyName": "Jensen"}
+			},
+		},
+		{
+			name: "replace extension sub-attribute",
+			op:   PatchOperation{Op: PatchOperationReplace, Path: extensionID + ":manager.value", Value: "0002"},
+			expected: func(attributes ResourceAttributes) {
+				attributes[extensionID] = map[string]interface{}{
+					"manager": map[string]interface{}{"value": "0002"},
+				}
+			},
+		},
+		{
+			name: "add without path",
+			op: PatchOperation{Op: PatchOperationAdd, Value: map[string]interface{}{
+				"nickName": "Babs",
+				extensionID: map[string]interface{}{
+					"department": "Tour Operations",
+				},
+			}},
+			expected: func(attributes ResourceAttributes) {
+				attributes["nickName"] = "Babs"
+				attributes[extensionID] = map[string]interface{}{"department": "Tour Operations"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.name, func(t *testing.T) {
+			attributes := newTestPatchAttributes()
+			patched, err := newTestCoreUserResourceType().ApplyPatch(attributes, PatchRequest{
+				Operations: []PatchOperation{tt.op},
+			})
+			assert.NoError(t, err)
+
+			expected := newTestPatchAttributes()
+			tt.expected(expected)
+			assert.Equal(t, map[string]interface{}(expected), map[string]interface{}(patched))
+
+			// The given attributes are not modified.
+			assert.Equal(t, newTestPatchAttributes(), attributes)
+		})
+	}
+}
+
+func TestApplyPatchInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       PatchOperation
+		expected errors.ScimError
+	}{
+		{
+			name:     "remove without path",
+			op:       PatchOperation{Op: PatchOperationRemove},
+			expected: errors.ScimErrorNoTarget,
+		},
+		{
+			name:     "replace value that does not exist",
+			op:       PatchOperation{Op: PatchOperationReplace, Path: `emails[type eq "other"]`, Value: map[string]interface{}{}},
+			expected: errors.ScimErrorNoTarget,
+		},
+		{
+			name:     "replace sub-attribute of value that does not exist",
+			op:       PatchOperation{Op: PatchOperationReplace, Path: `emails[type eq "other"].value`, Value: "babs@example.org"},
+			expected: errors.ScimErrorNoTarget,
+		},
+		{
+			name:     "unknown attribute",
+			op:       PatchOperation{Op: PatchOperationReplace, Path: "unknown", Value: "value"},
+			expected: errors.ScimErrorInvalidPath,
+		},
+		{
+			name:     "filter on single-valued attribute",
+			op:       PatchOperation{Op: PatchOperationReplace, Path: `name[givenName eq "Barbara"]`, Value: "value"},
+			expected: errors.ScimErrorInvalidPath,
+		},
+		{
+			name:     "unknown schema",
+			op:       PatchOperation{Op: PatchOperationReplace, Path: "urn:example:unknown:department", Value: "value"},
+			expected: errors.ScimErrorInvalidPath,
+		},
+		{
+			name: "multiple primary values",
+			op: PatchOperation{Op: PatchOperationReplace, Path: "emails", Value: []interface{}{
+				map[string]interface{}{"value": "a@example.com", "primary": true},
+				map[string]interface{}{"value": "b@example.com", "primary": true},
+			}},
+			expected: errors.ScimErrorInvalidValue,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestCoreUserResourceType().ApplyPatch(newTestPatchAttributes(), PatchRequest{
+				Operations: []PatchOperation{tt.op},
+			})
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+func TestApplyPatchInvalidResult(t *testing.T) {
+	tests := []struct {
+		name string
+		op   PatchOperation
+	}{
+		{
+			name: "remove required attribute",
+			op:   PatchOperation{Op: PatchOperationRemove, Path: "userName"},
+		},
+		{
+			name: "replace filtered sub-attribute with value of wrong type",
+			op:   PatchOperation{Op: PatchOperationReplace, Path: `emails[type eq "work"].value`, Value: 123},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTestCoreUserResourceType().ApplyPatch(newTestPatchAttributes(), PatchRequest{
+				Operations: []PatchOperation{tt.op},
+			})
+			if assert.IsType(t, errors.ScimError{}, err) {
+				assert.Equal(t, errors.ScimTypeInvalidValue, err.(errors.ScimError).ScimType)
+				assert.Equal(t, http.StatusBadRequest, err.(errors.ScimError).Status)
+			}
+		})
+	}
+}
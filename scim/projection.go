@@ -0,0 +1,346 @@
+package scim
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
+)
+
+// attributeReference references an attribute, a sub-attribute or all the attributes of a schema in the "attributes"
+// or "excludedAttributes" query parameter.
+type attributeReference struct {
+	// schemaID is the URI of the schema extension that defines the attribute. It is empty for the attributes of the
+	// primary schema and the common attributes.
+	schemaID string
+	// name is the name of the attribute. It is empty if all the attributes of the schema are referenced.
+	name string
+	// subName is the name of the sub-attribute. It is empty if the attribute as a whole is referenced.
+	subName string
+}
+
+// matches returns whether the reference includes the given (sub-)attribute. An empty sub-attribute name refers to the
+// attribute as a whole.
+func (r attributeReference) matches(schemaID, name, subName string) bool {
+	if !strings.EqualFold(r.schemaID, schemaID) {
+		return false
+	}
+	if r.name == "" {
+		return true
+	}
+	if !strings.EqualFold(r.name, name) {
+		return false
+	}
+	return r.subName == "" || strings.EqualFold(r.subName, subName)
+}
+
+// resourceProjection determines which attributes of a resource are returned to the client, based on the "attributes"
+// and "excludedAttributes" query parameters (RFC 7644 section 3.9) and the "returned" characteristic of the attributes.
+type resourceProjection struct {
+	// attributes are the attributes that are returned, in addition to those that are always returned. If empty, all
+	// the attributes that are returned by default are returned.
+	attributes []attributeReference
+	// excludedAttributes are the attributes that are not returned, unless they are always returned.
+	excludedAttributes []attributeReference
+	// specified are the attributes that are specified by the client in the body of a POST, PUT or PATCH request.
+	// Attributes that are returned on request are returned if they are specified.
+	specified []attributeReference
+}
+
+// getProjection parses the "attributes" and "excludedAttributes" query parameters.
+func (t ResourceType) getProjection(query url.Values) (resourceProjection, *errors.ScimError) {
+	invalidParams := make([]string, 0)
+
+	attributes, err := t.parseAttributeReferences(query.Get("attributes"))
+	if err != nil {
+		invalidParams = append(invalidParams, "attributes")
+	}
+	excludedAttributes, err := t.parseAttributeReferences(query.Get("excludedAttributes"))
+	if err != nil {
+		invalidParams = append(invalidParams, "excludedAttributes")
+	}
+
+	if len(invalidParams) != 0 {
+		scimErr := errors.ScimErrorBadParams(invalidParams)
+		return resourceProjection{}, &scimErr
+	}
+
+	return resourceProjection{
+		attributes:         attributes,
+		excludedAttributes: excludedAttributes,
+	}, nil
+}
+
+// parseAttributeReferences parses a comma separated list of attribute paths, e.g. "userName,name.givenName". A path
+// that equals the URI of one of the schemas of the resource type references all the attributes of that schema.
+func (t ResourceType) parseAttributeReferences(raw string) ([]attributeReference, error) {
+	var references []attributeReference
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if strings.EqualFold(path, t.Schema.ID) {
+			references = append(references, attributeReference{})
+			continue
+		}
+		if extension, ok := t.getExtension(path); ok {
+			references = append(references, attributeReference{schemaID: extension.Schema.ID})
+			continue
+		}
+
+		attr, sub, ok := t.getAttributePath(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute path %q", path)
+		}
+		reference := attributeReference{
+			schemaID: attr.schemaID,
+			name:     attr.attribute.Name(),
+		}
+		if sub != nil {
+			reference.subName = sub.Name()
+		}
+		references = append(references, reference)
+	}
+	return references, nil
+}
+
+// getExtension returns the schema extension with given URI.
+func (t ResourceType) getExtension(id string) (SchemaExtension, bool) {
+	for _, extension := range t.SchemaExtensions {
+		if strings.EqualFold(extension.Schema.ID, id) {
+			return extension, true
+		}
+	}
+	return SchemaExtension{}, false
+}
+
+// apply returns the representation of a resource that only contains the attributes that are returned to the client.
+// Attributes that are not defined by the schemas of the resource type are only returned if no specific attributes are
+// requested. The given representation is not modified.
+func (p resourceProjection) apply(t ResourceType, values ResourceAttributes) ResourceAttributes {
+	projected := make(ResourceAttributes, len(values))
+	for name, value := range values {
+		if name == "schemas" {
+			projected[name] = value
+			continue
+		}
+
+		if extension, ok := t.getExtension(name); ok {
+			if m := p.applySchema(extension.Schema.ID, extension.Schema.Attributes, value); len(m) != 0 {
+				projected[name] = m
+			}
+			continue
+		}
+
+		attr, ok := findAttribute("", commonAttributes(), name)
+		if !ok {
+			attr, ok = findAttribute("", t.Schema.Attributes, name)
+		}
+		if !ok {
+			if len(p.attributes) == 0 {
+				projected[name] = value
+			}
+			continue
+		}
+		if v, ok := p.attribute(attr, value); ok {
+			projected[name] = v
+		}
+	}
+	return projected
+}
+
+// applySchema projects the attributes of a schema extension.
+func (p resourceProjection) applySchema(schemaID string, attributes []schema.CoreAttribute, value interface{}) map[string]interface{} {
+	values, ok := toMap(value)
+	if !ok {
+		return nil
+	}
+
+	projected := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		attr, ok := findAttribute(schemaID, attributes, name)
+		if !ok {
+			if len(p.attributes) == 0 {
+				projected[name] = value
+			}
+			continue
+		}
+		if v, ok := p.attribute(attr, value); ok {
+			projected[name] = v
+		}
+	}
+	return projected
+}
+
+// attribute returns the projected value of an attribute and whether the attribute is returned at all.
+func (p resourceProjection) attribute(attr schemaAttribute, value interface{}) (interface{}, bool) {
+	id, name := attr.schemaID, attr.attribute.Name()
+
+	switch effectiveReturned(attr.attribute) {
+	case schema.AttributeReturnedNever():
+		return nil, false
+	case schema.AttributeReturnedAlways():
+		return subAttributes(attr.attribute, value, func(string, schema.AttributeReturned) bool {
+			return true
+		}), true
+	}
+
+	if len(p.attributes) != 0 {
+		if referenced(p.attributes, id, name, "") {
+			return subAttributes(attr.attribute, value, func(sub string, returned schema.AttributeReturned) bool {
+				return returned != schema.AttributeReturnedRequest() ||
+					referencedSubAttribute(p.attributes, id, name, sub) || referenced(p.specified, id, name, sub)
+			}), true
+		}
+		if !referencedSubAttribute(p.attributes, id, name, "") {
+			return nil, false
+		}
+		return subAttributes(attr.attribute, value, func(sub string, returned schema.AttributeReturned) bool {
+			return returned == schema.AttributeReturnedAlways() || referenced(p.attributes, id, name, sub)
+		}), true
+	}
+
+	if referenced(p.excludedAttributes, id, name, "") {
+		return nil, false
+	}
+	if effectiveReturned(attr.attribute) == schema.AttributeReturnedRequest() &&
+		!referenced(p.specified, id, name, "") && !referencedSubAttribute(p.specified, id, name, "") {
+		return nil, false
+	}
+	return subAttributes(attr.attribute, value, func(sub string, returned schema.AttributeReturned) bool {
+		switch returned {
+		case schema.AttributeReturnedAlways():
+			return true
+		case schema.AttributeReturnedRequest():
+			return referenced(p.specified, id, name, sub)
+		default:
+			return !referenced(p.excludedAttributes, id, name, sub)
+		}
+	}), true
+}
+
+// specifiedAttributes returns references to the attributes that are specified in the (validated) body of a POST or
+// PUT request, or in the value of a PATCH operation without a path.
+func (t ResourceType) specifiedAttributes(attributes map[string]interface{}) []attributeReference {
+	var references []attributeReference
+	for name, value := range attributes {
+		if extension, ok := t.getExtension(name); ok {
+			m, _ := toMap(value)
+			for n := range m {
+				references = append(references, attributeReference{schemaID: extension.Schema.ID, name: n})
+			}
+			continue
+		}
+		if attr, ok := t.getAttribute(name); ok {
+			references = append(references, attributeReference{schemaID: attr.schemaID, name: attr.attribute.Name()})
+		}
+	}
+	return references
+}
+
+// patchedAttributes returns references to the attributes that are targeted by the operations of a PATCH request.
+func (t ResourceType) patchedAttributes(patch PatchRequest) []attributeReference {
+	var references []attributeReference
+	for _, op := range patch.Operations {
+		if op.Path == "" {
+			m, _ := toMap(op.Value)
+			references = append(references, t.specifiedAttributes(m)...)
+			continue
+		}
+
+		// A value filter does not change the attribute that is targeted, e.g. `emails[type eq "work"].value`.
+		path := op.Path
+		if i := strings.Index(path, "["); i != -1 {
+			if j := strings.LastIndex(path, "]"); j > i {
+				path = path[:i] + path[j+1:]
+			}
+		}
+		attr, sub, ok := t.getAttributePath(path)
+		if !ok {
+			continue
+		}
+		reference := attributeReference{schemaID: attr.schemaID, name: attr.attribute.Name()}
+		if sub != nil {
+			reference.subName = sub.Name()
+		}
+		references = append(references, reference)
+	}
+	return references
+}
+
+// referenced returns whether one of the references includes the given (sub-)attribute.
+func referenced(references []attributeReference, schemaID, name, subName string) bool {
+	for _, reference := range references {
+		if reference.matches(schemaID, name, subName) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedSubAttribute returns whether one of the references explicitly references a sub-attribute of the given
+// attribute. If subName is not empty, only references to that sub-attribute are considered.
+func referencedSubAttribute(references []attributeReference, schemaID, name, subName string) bool {
+	for _, reference := range references {
+		if reference.subName == "" || !reference.matches(schemaID, name, reference.subName) {
+			continue
+		}
+		if subName == "" || strings.EqualFold(reference.subName, subName) {
+			return true
+		}
+	}
+	return false
+}
+
+// subAttributes returns the value of a (multi-valued) complex attribute with only the sub-attributes for which keep
+// returns true. Sub-attributes that are never returned are always removed. Sub-attributes that are not defined by the
+// attribute are treated as if they are returned by default.
+func subAttributes(attr schema.CoreAttribute, value interface{}, keep func(name string, returned schema.AttributeReturned) bool) interface{} {
+	if attr.AttributeType() != "complex" {
+		return value
+	}
+
+	project := func(value interface{}) interface{} {
+		m, ok := toMap(value)
+		if !ok {
+			return value
+		}
+		projected := make(map[string]interface{}, len(m))
+		for name, v := range m {
+			returned := schema.AttributeReturnedDefault()
+			if sub, ok := attr.SubAttribute(name); ok {
+				returned = effectiveReturned(sub)
+			}
+			if returned != schema.AttributeReturnedNever() && keep(name, returned) {
+				projected[name] = v
+			}
+		}
+		return projected
+	}
+
+	if !attr.MultiValued() {
+		return project(value)
+	}
+	elements, ok := toSlice(value)
+	if !ok {
+		return value
+	}
+	projected := make([]interface{}, len(elements))
+	for i, element := range elements {
+		projected[i] = project(element)
+	}
+	return projected
+}
+
+// effectiveReturned returns when the values of the attribute are returned. The values of write only attributes are never
+// returned, regardless of their returned characteristic.
+func effectiveReturned(attr schema.CoreAttribute) schema.AttributeReturned {
+	if attr.Mutability() == schema.AttributeMutabilityWriteOnly() {
+		return schema.AttributeReturnedNever()
+	}
+	return attr.Returned()
+}
@@ -0,0 +1,208 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/optional"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProjectionResource() ResourceAttributes {
+	return Resource{
+		ID:         "0001",
+		ExternalID: optional.NewString("external1"),
+		Attributes: ResourceAttributes{
+			"userName": "bjensen",
+			"password": "t1meMa$heen",
+			"name": map[string]interface{}{
+				"givenName":  "Barbara",
+				"familyName": "Jensen",
+			},
+			"emails": []interface{}{
+				map[string]interface{}{"value": "bjensen@example.com", "type": "work"},
+			},
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{
+				"employeeNumber": "701984",
+				"department":     "Tour Operations",
+			},
+		},
+	}.response(newTestCoreUserResourceType())
+}
+
+func TestProjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "default",
+			query:    "",
+			expected: []string{"schemas", "id", "externalId", "meta", "userName", "name", "emails", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"},
+		},
+		{
+			name:     "attributes",
+			query:    "attributes=userName,name.givenName",
+			expected: []string{"schemas", "id", "userName", "name"},
+		},
+		{
+			name:     "extension attributes",
+			query:    "attributes=urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department",
+			expected: []string{"schemas", "id", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"},
+		},
+		{
+			name:     "password is never returned",
+			query:    "attributes=password",
+			expected: []string{"schemas", "id"},
+		},
+		{
+			name:     "excluded attributes",
+			query:    "excludedAttributes=emails,meta,id,urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+			expected: []string{"schemas", "id", "externalId", "userName", "name"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.name, func(t *testing.T) {
+			resourceType := newTestCoreUserResourceType()
+			req := httptest.NewRequest(http.MethodGet, "/Users?"+tt.query, nil)
+			p, scimErr := resourceType.getProjection(req.URL.Query())
+			assert.Nil(t, scimErr)
+
+			projected := p.apply(resourceType, newTestProjectionResource())
+			names := make([]string, 0)
+			for name := range projected {
+				names = append(names, name)
+			}
+			assert.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
+
+func TestProjectionSubAttributes(t *testing.T) {
+	resourceType := newTestCoreUserResourceType()
+
+	req := httptest.NewRequest(http.MethodGet, "/Users?attributes=name.givenName,"+
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", nil)
+	p, scimErr := resourceType.getProjection(req.URL.Query())
+	assert.Nil(t, scimErr)
+	projected := p.apply(resourceType, newTestProjectionResource())
+	assert.Equal(t, map[string]interface{}{"givenName": "Barbara"}, projected["name"])
+	assert.Equal(t, map[string]interface{}{"department": "Tour Operations"},
+		projected["urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"])
+
+	req = httptest.NewRequest(http.MethodGet, "/Users?excludedAttributes=emails.type,meta.location", nil)
+	p, scimErr = resourceType.getProjection(req.URL.Query())
+	assert.Nil(t, scimErr)
+	projected = p.apply(resourceType, newTestProjectionResource())
+	assert.Equal(t, []interface{}{map[string]interface{}{"value": "bjensen@example.com"}}, projected["emails"])
+	assert.NotContains(t, projected["meta"], "location")
+	assert.Contains(t, projected["meta"], "resourceType")
+}
+
+func TestProjectionInvalid(t *testing.T) {
+	resourceType := newTestCoreUserResourceType()
+	req := httptest.NewRequest(http.MethodGet, "/Users?attributes=unknown&excludedAttributes=name.unknown", nil)
+	_, scimErr := resourceType.getProjection(req.URL.Query())
+	assert.NotNil(t, scimErr)
+	assert.Equal(t, http.StatusBadRequest, scimErr.Status)
+}
+
+func TestServerResourceGetHandlerAttributes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Users/0001?attributes=userName", nil)
+	rr := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status code mismatch")
+
+	var resource map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &resource)
+	assert.NoError(t, err, "json unmarshalling failed")
+
+	assert.Equal(t, "test1", resource["userName"])
+	assert.Equal(t, "0001", resource["id"])
+	assert.NotContains(t, resource, "externalId")
+	assert.NotContains(t, resource, "meta")
+}
+
+func TestServerResourcesGetHandlerExcludedAttributes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Users?excludedAttributes=externalId", nil)
+	rr := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status code mismatch")
+
+	var response listResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "json unmarshalling failed")
+
+	assert.NotEmpty(t, response.Resources)
+	for _, resource := range response.Resources {
+		assert.NotContains(t, resource, "externalId")
+		assert.Contains(t, resource, "userName")
+	}
+}
+
+func newTestReturnedResource() Resource {
+	return Resource{
+		ID: "0001",
+		Attributes: ResourceAttributes{
+			"name":     "printer",
+			"secret":   "s3cr3t",
+			"firmware": "1.0.2",
+			"owner": map[string]interface{}{
+				"value": "bjensen",
+				"token": "t0k3n",
+				"badge": "B-1",
+			},
+		},
+	}
+}
+
+func TestResourceRenderReturned(t *testing.T) {
+	resourceType := newTestDeviceResourceType()
+	resource := newTestReturnedResource()
+
+	rendered := resource.render(resourceType, resourceProjection{})
+	assert.Equal(t, "printer", rendered["name"])
+	assert.NotContains(t, rendered, "secret")
+	assert.NotContains(t, rendered, "firmware")
+	assert.Equal(t, map[string]interface{}{"value": "bjensen"}, rendered["owner"])
+
+	// Rendering does not modify the attributes of the resource.
+	assert.Contains(t, resource.Attributes, "secret")
+	assert.NotContains(t, resource.Attributes, "id")
+
+	// The full representation is used to store the resource.
+	assert.Contains(t, resource.Map(resourceType), "secret")
+}
+
+func TestResourceRenderReturnedRequest(t *testing.T) {
+	resourceType := newTestDeviceResourceType()
+	resource := newTestReturnedResource()
+
+	specified := resourceType.specifiedAttributes(map[string]interface{}{"firmware": "1.0.2", "secret": "s3cr3t"})
+	rendered := resource.render(resourceType, resourceProjection{specified: specified})
+	assert.Equal(t, "1.0.2", rendered["firmware"])
+	assert.NotContains(t, rendered, "secret")
+
+	patched := resourceType.patchedAttributes(PatchRequest{Operations: []PatchOperation{
+		{Op: PatchOperationReplace, Path: "owner.badge", Value: "B-2"},
+	}})
+	rendered = resource.render(resourceType, resourceProjection{specified: patched})
+	assert.NotContains(t, rendered, "firmware")
+	assert.Equal(t, map[string]interface{}{"value": "bjensen", "badge": "B-1"}, rendered["owner"])
+
+	req := httptest.NewRequest(http.MethodGet, "/Devices?attributes=firmware,secret,owner.token", nil)
+	p, scimErr := resourceType.getProjection(req.URL.Query())
+	assert.Nil(t, scimErr)
+	rendered = resource.render(resourceType, p)
+	assert.Equal(t, "1.0.2", rendered["firmware"])
+	assert.NotContains(t, rendered, "secret")
+	assert.Equal(t, map[string]interface{}{}, rendered["owner"])
+}
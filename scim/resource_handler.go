@@ -21,8 +21,23 @@ type ListRequestParams struct {
 	// It is an optional parameter and thus will be nil when the parameter is not present.
 	Filter filter.Expression
 
+	// SortBy is the attribute path whose value is used to order the returned resources, e.g. "name.familyName".
+	// It is an optional parameter and thus will be empty when the parameter is not present.
+	SortBy string
+
+	// SortOrder is the order in which the "sortBy" parameter is applied. It defaults to "ascending".
+	SortOrder SortOrder
+
 	// StartIndex The 1-based index of the first query result. A value less than 1 SHALL be interpreted as 1.
 	StartIndex int
+
+	// Cursor is the position from which the page continues when the client uses cursor pagination, in which case the
+	// StartIndex is ignored. It is nil when the client uses index-based pagination.
+	Cursor *Cursor
+
+	// HasMore is set by the handler when the client uses cursor pagination, to indicate that there are more resources
+	// beyond the returned page, in the direction of the cursor. QueryPage sets it.
+	HasMore bool
 }
 
 // ResourceAttributes represents a list of attributes given to the callback method to create or replace
@@ -53,8 +68,13 @@ type Resource struct {
 	Meta Meta
 }
 
+// response returns the full representation of the resource, including the attributes that are never returned to the
+// client. The attributes of the resource are not modified.
 func (r Resource) response(resourceType ResourceType) ResourceAttributes {
-	response := r.Attributes
+	response := make(ResourceAttributes, len(r.Attributes)+4)
+	for k, v := range r.Attributes {
+		response[k] = v
+	}
 	response[schema.CommonAttributeID] = r.ID
 	if r.ExternalID.Present() {
 		response[schema.CommonAttributeExternalID] = r.ExternalID.Value()
@@ -88,7 +108,45 @@ func (r Resource) response(resourceType ResourceType) ResourceAttributes {
 	return response
 }
 
-// Map ...
+// values returns all the attribute values of the resource, including the common attributes, in the same structure as
+// the JSON representation of the resource. Dates are kept as time values so they can be compared.
+func (r Resource) values() map[string]interface{} {
+	values := make(map[string]interface{}, len(r.Attributes)+3)
+	for k, v := range r.Attributes {
+		values[k] = v
+	}
+	values[schema.CommonAttributeID] = r.ID
+	if r.ExternalID.Present() {
+		values[schema.CommonAttributeExternalID] = r.ExternalID.Value()
+	}
+
+	m := map[string]interface{}{
+		"resourceType": r.Meta.ResourceType,
+		"location":     r.Meta.Location,
+	}
+	if r.Meta.Created != nil {
+		m["created"] = *r.Meta.Created
+	}
+	if r.Meta.LastModified != nil {
+		m["lastModified"] = *r.Meta.LastModified
+	}
+	if r.Meta.Version != "" {
+		m["version"] = r.Meta.Version
+	}
+	values[schema.CommonAttributeMeta] = m
+
+	return values
+}
+
+// render returns the representation of the resource that is returned to the client. Which attributes are included is
+// driven by the "returned" characteristic of the attributes in the schema and schema extensions of the resource type,
+// combined with the attributes that are requested or specified by the client.
+func (r Resource) render(resourceType ResourceType, projection resourceProjection) ResourceAttributes {
+	return projection.apply(resourceType, r.response(resourceType))
+}
+
+// Map returns the full representation of the resource, including the attributes that are never returned to the
+// client. It is meant to be used to store the resource, not to respond to a client.
 func (r Resource) Map(resourceType ResourceType) ResourceAttributes {
 	return r.response(resourceType)
 }
@@ -72,7 +72,7 @@ func (h testResourceHandler) Get(r *http.Request, id string) (Resource, error) {
 	}, nil
 }
 
-func (h testResourceHandler) GetAll(r *http.Request, params ListRequestParams) (Page, error) {
+func (h testResourceHandler) GetAll(r *http.Request, params *ListRequestParams) (Page, error) {
 	resources := make([]Resource, 0)
 	i := 1
 
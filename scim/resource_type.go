@@ -54,30 +54,53 @@ func unmarshal(data []byte, v interface{}) error {
 	return d.Decode(v)
 }
 
-func (t ResourceType) validate(raw []byte) (ResourceAttributes, *errors.ScimError) {
+// validate validates the raw resource of a request that creates or replaces a resource. The current resource is nil
+// if the resource is created. Values of read only attributes are ignored, and the values of immutable attributes of a
+// replaced resource have to match their current values.
+func (t ResourceType) validate(raw []byte, current *Resource) (ResourceAttributes, *errors.ScimError) {
 	var m map[string]interface{}
 	if err := unmarshal(raw, &m); err != nil {
 		return ResourceAttributes{}, &errors.ScimErrorInvalidSyntax
 	}
+	return t.validateAttributes(m, current)
+}
 
-	attributes, scimErr := t.schemaWithCommon().Validate(m)
+// validateAttributes validates the attributes of a resource that is created or replaced, see validate.
+func (t ResourceType) validateAttributes(m map[string]interface{}, current *Resource) (ResourceAttributes, *errors.ScimError) {
+	s := t.schemaWithCommon()
+	attributes, scimErr := s.Validate(withoutReadOnly(s.Attributes, m))
 	if scimErr != nil {
 		return ResourceAttributes{}, scimErr
 	}
+	if current != nil {
+		if scimErr := keepImmutable(s.Attributes, attributes, current.Attributes); scimErr != nil {
+			return ResourceAttributes{}, scimErr
+		}
+	}
 
 	for _, extension := range t.SchemaExtensions {
 		extensionField := m[extension.Schema.ID]
 		if extensionField == nil {
 			if extension.Required {
-				return ResourceAttributes{}, &errors.ScimErrorInvalidValue
+				scimErr := errors.ScimErrorInvalidField(errors.ScimTypeInvalidValue, errors.FieldError{
+					Path:   extension.Schema.ID,
+					Reason: "is required",
+				})
+				return ResourceAttributes{}, &scimErr
 			}
 			continue
 		}
 
-		extensionAttributes, scimErr := extension.Schema.Validate(extensionField)
+		extensionAttributes, scimErr := extension.Schema.Validate(withoutReadOnly(extension.Schema.Attributes, extensionField))
 		if scimErr != nil {
 			return ResourceAttributes{}, scimErr
 		}
+		if current != nil {
+			currentExtension := lookup(current.Attributes, extension.Schema.ID)
+			if scimErr := keepImmutable(extension.Schema.Attributes, extensionAttributes, currentExtension); scimErr != nil {
+				return ResourceAttributes{}, scimErr
+			}
+		}
 
 		attributes[extension.Schema.ID] = extensionAttributes
 	}
@@ -103,6 +126,144 @@ func (t ResourceType) schemaWithCommon() schema.Schema {
 
 }
 
+// schemaAttribute is an attribute definition together with the URI of the extension schema it belongs to. The schema
+// ID is empty for attributes of the resource type's primary schema and for the common attributes.
+type schemaAttribute struct {
+	schemaID  string
+	attribute schema.CoreAttribute
+}
+
+// commonAttributes returns the definitions of the attributes that are included in every resource, independent of the
+// resource type: "id", "externalId" and "meta".
+func commonAttributes() []schema.CoreAttribute {
+	return []schema.CoreAttribute{
+		schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+			CaseExact:  true,
+			Mutability: schema.AttributeMutabilityReadOnly(),
+			Name:       schema.CommonAttributeID,
+			Returned:   schema.AttributeReturnedAlways(),
+			Uniqueness: schema.AttributeUniquenessServer(),
+		})),
+		schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+			CaseExact:  true,
+			Mutability: schema.AttributeMutabilityReadWrite(),
+			Name:       schema.CommonAttributeExternalID,
+			Uniqueness: schema.AttributeUniquenessNone(),
+		})),
+		schema.ComplexCoreAttribute(schema.ComplexParams{
+			Mutability: schema.AttributeMutabilityReadOnly(),
+			Name:       schema.CommonAttributeMeta,
+			SubAttributes: []schema.SimpleParams{
+				schema.SimpleStringParams(schema.StringParams{
+					CaseExact:  true,
+					Mutability: schema.AttributeMutabilityReadOnly(),
+					Name:       "resourceType",
+				}),
+				schema.SimpleDateTimeParams(schema.DateTimeParams{
+					Mutability: schema.AttributeMutabilityReadOnly(),
+					Name:       "created",
+				}),
+				schema.SimpleDateTimeParams(schema.DateTimeParams{
+					Mutability: schema.AttributeMutabilityReadOnly(),
+					Name:       "lastModified",
+				}),
+				schema.SimpleReferenceParams(schema.ReferenceParams{
+					Mutability:     schema.AttributeMutabilityReadOnly(),
+					Name:           "location",
+					ReferenceTypes: []schema.AttributeReferenceType{schema.AttributeReferenceTypeURI},
+				}),
+				schema.SimpleStringParams(schema.StringParams{
+					CaseExact:  true,
+					Mutability: schema.AttributeMutabilityReadOnly(),
+					Name:       "version",
+				}),
+			},
+		}),
+	}
+}
+
+// getAttribute looks up the attribute with given name. The name is matched case-insensitively against the common
+// attributes, the attributes of the primary schema and those of the schema extensions, in that order. A name that is
+// prefixed with the URI of one of the schemas is only matched against the attributes of that schema.
+func (t ResourceType) getAttribute(name string) (schemaAttribute, bool) {
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		id, attrName := name[:i], name[i+1:]
+		if strings.EqualFold(id, t.Schema.ID) {
+			return findAttribute("", t.Schema.Attributes, attrName)
+		}
+		for _, extension := range t.SchemaExtensions {
+			if strings.EqualFold(id, extension.Schema.ID) {
+				return findAttribute(extension.Schema.ID, extension.Schema.Attributes, attrName)
+			}
+		}
+		return schemaAttribute{}, false
+	}
+
+	if attr, ok := findAttribute("", commonAttributes(), name); ok {
+		return attr, true
+	}
+	if attr, ok := findAttribute("", t.Schema.Attributes, name); ok {
+		return attr, true
+	}
+	for _, extension := range t.SchemaExtensions {
+		if attr, ok := findAttribute(extension.Schema.ID, extension.Schema.Attributes, name); ok {
+			return attr, true
+		}
+	}
+	return schemaAttribute{}, false
+}
+
+// getAttributePath looks up the attribute referenced by an attribute path, e.g. "userName", "name.givenName" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value". The returned sub-attribute is nil if the
+// path does not reference a sub-attribute.
+func (t ResourceType) getAttributePath(path string) (schemaAttribute, *schema.CoreAttribute, bool) {
+	var prefix string
+	if i := strings.LastIndex(path, ":"); i != -1 {
+		prefix, path = path[:i+1], path[i+1:]
+	}
+
+	name, subName := path, ""
+	if i := strings.Index(path, "."); i != -1 {
+		name, subName = path[:i], path[i+1:]
+	}
+
+	attr, ok := t.getAttribute(prefix + name)
+	if !ok {
+		return schemaAttribute{}, nil, false
+	}
+	if subName == "" {
+		return attr, nil, true
+	}
+	sub, ok := attr.attribute.SubAttribute(subName)
+	if !ok {
+		return schemaAttribute{}, nil, false
+	}
+	return attr, &sub, true
+}
+
+// LookupAttribute returns the definition of the attribute with given name, together with the URI of the schema
+// extension that defines it. The URI is empty for attributes of the primary schema and for the common attributes.
+func (t ResourceType) LookupAttribute(name string) (schema.CoreAttribute, string, bool) {
+	attr, ok := t.getAttribute(name)
+	return attr.attribute, attr.schemaID, ok
+}
+
+// LookupAttributePath returns the definitions of the attribute and the (optional) sub-attribute referenced by an
+// attribute path, together with the URI of the schema extension that defines the attribute.
+func (t ResourceType) LookupAttributePath(path string) (schema.CoreAttribute, *schema.CoreAttribute, string, bool) {
+	attr, sub, ok := t.getAttributePath(path)
+	return attr.attribute, sub, attr.schemaID, ok
+}
+
+func findAttribute(schemaID string, attributes []schema.CoreAttribute, name string) (schemaAttribute, bool) {
+	for _, attr := range attributes {
+		if strings.EqualFold(attr.Name(), name) {
+			return schemaAttribute{schemaID: schemaID, attribute: attr}, true
+		}
+	}
+	return schemaAttribute{}, false
+}
+
 func (t ResourceType) getRaw() map[string]interface{} {
 	return map[string]interface{}{
 		"schemas":          []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
@@ -139,7 +300,7 @@ func (t ResourceType) validatePatch(r *http.Request) (PatchRequest, *errors.Scim
 		return req, &errors.ScimErrorInvalidSyntax
 	}
 
-	// Error causes are currently unused but could be logged or perhaps used to build a more detailed error message.
+	// Error causes are reported in the detail of the error, prefixed with the operation they belong to.
 	errorCauses := make([]string, 0)
 
 	// The body of an HTTP PATCH request MUST contain the attribute "Operations",
@@ -150,12 +311,16 @@ func (t ResourceType) validatePatch(r *http.Request) (PatchRequest, *errors.Scim
 
 	for i := range req.Operations {
 		req.Operations[i].Op = strings.ToLower(req.Operations[i].Op)
-		errorCauses = append(errorCauses, t.validateOperation(req.Operations[i])...)
+		for _, cause := range t.validateOperation(req.Operations[i]) {
+			errorCauses = append(errorCauses, fmt.Sprintf("Operations[%d]: %s", i, cause))
+		}
 	}
 
 	// Denotes all of the errors that have occurred parsing the request.
 	if len(errorCauses) > 0 {
-		return req, &errors.ScimErrorInvalidSyntax
+		scimErr := errors.ScimErrorInvalidSyntax
+		scimErr.Detail = strings.Join(errorCauses, "; ")
+		return req, &scimErr
 	}
 
 	return req, nil
@@ -191,22 +356,34 @@ func (t ResourceType) validateOperation(op PatchOperation) []string {
 	}
 
 	if err := t.validateOperationValue(op); err != nil {
-		return append(errorCauses, fmt.Sprintf("%s operation has an invalid value", op.Op))
+		return append(errorCauses, fmt.Sprintf("%s operation has an invalid value: %s", op.Op, err.Detail))
 	}
 
 	return errorCauses
 }
 
 func (t ResourceType) validateOperationValue(op PatchOperation) *errors.ScimError {
-	// Not attempting to validate value or path if it is a filter based path.
-	// Perhaps we could at least validate the ComparePath
-	if op.GetPathFilter() != nil {
-		return nil
+	if op.GetValuePath() != nil {
+		return t.validateFilteredOperationValue(op)
 	}
 
 	mapValue, ok := op.Value.(map[string]interface{})
 	if !ok {
 		mapValue = map[string]interface{}{op.Path: op.Value}
+
+		// A patch of a sub-attribute, e.g. "name.givenName", is validated as a patch of the complex attribute.
+		prefix, name := "", op.Path
+		if i := strings.LastIndex(name, ":"); i != -1 {
+			prefix, name = name[:i+1], name[i+1:]
+		}
+		if i := strings.Index(name, "."); i != -1 {
+			if _, _, ok := t.getAttributePath(op.Path); !ok {
+				return &errors.ScimErrorInvalidPath
+			}
+			mapValue = map[string]interface{}{
+				prefix + name[:i]: map[string]interface{}{name[i+1:]: op.Value},
+			}
+		}
 	}
 
 	// Check if it's a patch on a extension.
@@ -223,3 +400,29 @@ func (t ResourceType) validateOperationValue(op PatchOperation) *errors.ScimErro
 
 	return t.schemaWithCommon().ValidatePatchOperationValue(op.Op, mapValue)
 }
+
+// validateFilteredOperationValue validates the value of an operation of which the path selects the values of a
+// multi-valued attribute with a filter, e.g. `emails[type eq "work"].value`. The value is validated as a value of the
+// multi-valued attribute, of which only the referenced sub-attribute is set.
+func (t ResourceType) validateFilteredOperationValue(op PatchOperation) *errors.ScimError {
+	path, scimErr := t.parsePatchPath(op.Path)
+	if scimErr != nil {
+		return scimErr
+	}
+
+	var value interface{}
+	if op.Value != nil {
+		element := op.Value
+		if path.subAttribute != nil {
+			element = map[string]interface{}{path.subAttribute.Name(): op.Value}
+		}
+		value = asSlice(element)
+	}
+	mapValue := map[string]interface{}{path.attribute.attribute.Name(): value}
+
+	if path.attribute.schemaID != "" {
+		extension, _ := t.getExtension(path.attribute.schemaID)
+		return extension.Schema.ValidatePatchOperation(op.Op, mapValue, true)
+	}
+	return t.schemaWithCommon().ValidatePatchOperationValue(op.Op, mapValue)
+}
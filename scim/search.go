@@ -0,0 +1,204 @@
+package scim
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/schema"
+)
+
+const searchRequestSchema = "urn:ietf:params:scim:api:messages:2.0:SearchRequest"
+
+// searchRequest represents a query request that is sent with HTTP POST to a "/.search" endpoint, so that the query
+// parameters are not part of the request URI (RFC 7644 section 3.4.3).
+type searchRequest struct {
+	Schemas            []string
+	Attributes         []string
+	ExcludedAttributes []string
+	Filter             string
+	SortBy             string
+	SortOrder          string
+	StartIndex         *int
+	Count              *int
+	Cursor             *string
+}
+
+// parseSearchRequest parses the body of a search request into the equivalent query parameters of a GET request.
+func parseSearchRequest(r *http.Request) (url.Values, *errors.ScimError) {
+	data, _ := ioutil.ReadAll(r.Body)
+
+	var request searchRequest
+	if err := unmarshal(data, &request); err != nil || !contains(request.Schemas, searchRequestSchema) {
+		return nil, &errors.ScimErrorInvalidSyntax
+	}
+
+	query := url.Values{}
+	if len(request.Attributes) != 0 {
+		query.Set("attributes", strings.Join(request.Attributes, ","))
+	}
+	if len(request.ExcludedAttributes) != 0 {
+		query.Set("excludedAttributes", strings.Join(request.ExcludedAttributes, ","))
+	}
+	if request.Filter != "" {
+		query.Set("filter", request.Filter)
+	}
+	if request.SortBy != "" {
+		query.Set("sortBy", request.SortBy)
+	}
+	if request.SortOrder != "" {
+		query.Set("sortOrder", request.SortOrder)
+	}
+	if request.StartIndex != nil {
+		query.Set("startIndex", strconv.Itoa(*request.StartIndex))
+	}
+	if request.Count != nil {
+		query.Set("count", strconv.Itoa(*request.Count))
+	}
+	if request.Cursor != nil {
+		query.Set("cursor", *request.Cursor)
+	}
+	return query, nil
+}
+
+// searchResult is a resource found by a search over all resource types.
+type searchResult struct {
+	resourceType ResourceType
+	resource     Resource
+	projection   resourceProjection
+}
+
+// search queries the resources of all the resource types and merges them into a single list. Resource types for which
+// the filter is not valid, e.g. because it references an attribute they do not define, are skipped. Attribute paths
+// in the "attributes" and "excludedAttributes" parameters that a resource type does not define are ignored for that
+// resource type.
+func (s Server) search(r *http.Request, query url.Values) (listResponse, *errors.ScimError) {
+	params, scimErr := s.parseRequestParams(query)
+	if scimErr != nil {
+		return listResponse{}, scimErr
+	}
+	if _, ok := query["cursor"]; ok {
+		scimErr := errors.ScimErrorBadRequest("Cursor pagination is not supported across all resource types.")
+		return listResponse{}, &scimErr
+	}
+
+	// Every resource type returns the resources up to the last one of the requested page, as the page of the merged
+	// list can consist of the resources of any resource type.
+	count := params.StartIndex - 1 + params.Count
+
+	var (
+		results      []searchResult
+		totalResults int
+		filterErr    *errors.ScimError
+		searched     bool
+	)
+	for _, resourceType := range s.ResourceTypes {
+		if scimErr := NewFilterValidator(params.Filter, resourceType).Validate(); scimErr != nil {
+			filterErr = scimErr
+			continue
+		}
+		searched = true
+
+		projection, scimErr := resourceType.getProjection(resourceType.definedAttributePaths(query))
+		if scimErr != nil {
+			return listResponse{}, scimErr
+		}
+
+		typeParams := params
+		typeParams.StartIndex = defaultStartIndex
+		typeParams.Count = count
+		if _, _, ok := resourceType.getAttributePath(params.SortBy); !ok {
+			typeParams.SortBy = ""
+		}
+
+		page, getErr := resourceType.Handler.GetAll(r, &typeParams)
+		if getErr != nil {
+			scimErr := errors.CheckScimError(getErr, http.MethodPost)
+			return listResponse{}, &scimErr
+		}
+
+		totalResults += page.TotalResults
+		for _, resource := range page.Resources {
+			results = append(results, searchResult{
+				resourceType: resourceType,
+				resource:     resource,
+				projection:   projection,
+			})
+		}
+	}
+	if !searched && filterErr != nil {
+		return listResponse{}, filterErr
+	}
+
+	if params.SortBy != "" {
+		sortSearchResults(results, params.SortBy, params.SortOrder)
+	}
+
+	start, end := clamp(params.StartIndex-1, params.Count, len(results))
+	resources := make([]interface{}, 0, end-start)
+	for _, result := range results[start:end] {
+		resources = append(resources, result.resource.render(result.resourceType, result.projection))
+	}
+
+	return listResponse{
+		TotalResults: totalResults,
+		ItemsPerPage: len(resources),
+		StartIndex:   params.StartIndex,
+		Resources:    resources,
+	}, nil
+}
+
+// definedAttributePaths returns the query parameters with only the paths in the "attributes" and "excludedAttributes"
+// parameters that reference an attribute of the resource type.
+func (t ResourceType) definedAttributePaths(query url.Values) url.Values {
+	defined := url.Values{}
+	for _, param := range []string{"attributes", "excludedAttributes"} {
+		var paths []string
+		for _, path := range strings.Split(query.Get(param), ",") {
+			if _, err := t.parseAttributeReferences(path); err == nil && strings.TrimSpace(path) != "" {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) != 0 {
+			defined.Set(param, strings.Join(paths, ","))
+		}
+	}
+	return defined
+}
+
+// sortSearchResults sorts the results of a search over all resource types. Resources of a resource type that does not
+// define the sort attribute are sorted like resources without a value.
+func sortSearchResults(results []searchResult, sortBy string, order SortOrder) {
+	type sortEntry struct {
+		key  interface{}
+		leaf schema.CoreAttribute
+	}
+	entries := make([]sortEntry, len(results))
+	for i, result := range results {
+		key, leaf, _ := result.resourceType.sortKey(result.resource, sortBy)
+		entries[i] = sortEntry{key: key, leaf: leaf}
+	}
+
+	indices := make([]int, len(results))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		a, b := entries[indices[i]], entries[indices[j]]
+		cmp := compareSortValues(a.leaf, a.key, b.key)
+		if order == SortOrderDescending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	sorted := make([]searchResult, len(results))
+	for i, index := range indices {
+		sorted[i] = results[index]
+	}
+	copy(results, sorted)
+}
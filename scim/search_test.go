@@ -0,0 +1,87 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doSearchRequest(t *testing.T, server Server, target, body string) (int, listResponse) {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	var response listResponse
+	if rr.Code == http.StatusOK {
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		assert.NoError(t, err, "json unmarshalling failed")
+	}
+	return rr.Code, response
+}
+
+func TestServerRootSearchHandler(t *testing.T) {
+	code, response := doSearchRequest(t, newTestServer(), "/.search", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+		"attributes": ["userName"],
+		"sortBy": "userName",
+		"startIndex": 1,
+		"count": 40
+	}`)
+	assert.Equal(t, http.StatusOK, code, "status code mismatch")
+
+	// The resources of both resource types are merged.
+	assert.Equal(t, 40, response.TotalResults)
+	assert.Equal(t, 40, response.ItemsPerPage)
+	assert.Equal(t, 1, response.StartIndex)
+	assert.Len(t, response.Resources, 40)
+
+	var userNames []interface{}
+	for _, resource := range response.Resources {
+		r := resource.(map[string]interface{})
+		assert.NotContains(t, r, "externalId")
+		userNames = append(userNames, r["userName"])
+	}
+	assert.Equal(t, []interface{}{"test1", "test1", "test10"}, userNames[:3])
+
+	code, response = doSearchRequest(t, newTestServer(), "/.search", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+		"startIndex": 39,
+		"count": 5
+	}`)
+	assert.Equal(t, http.StatusOK, code, "status code mismatch")
+	assert.Equal(t, 40, response.TotalResults)
+	assert.Equal(t, 39, response.StartIndex)
+	assert.Len(t, response.Resources, 2)
+}
+
+func TestServerRootSearchHandlerInvalid(t *testing.T) {
+	for _, body := range []string{
+		`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"]}`,
+		`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"], "filter": "unknown eq \"x\""}`,
+		`invalid`,
+	} {
+		code, _ := doSearchRequest(t, newTestServer(), "/.search", body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
+
+func TestServerResourcesSearchHandler(t *testing.T) {
+	code, response := doSearchRequest(t, newTestServer(), "/Users/.search", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"],
+		"excludedAttributes": ["externalId"],
+		"count": 5
+	}`)
+	assert.Equal(t, http.StatusOK, code, "status code mismatch")
+	assert.Equal(t, 20, response.TotalResults)
+	assert.Len(t, response.Resources, 5)
+	for _, resource := range response.Resources {
+		assert.NotContains(t, resource, "externalId")
+	}
+
+	code, _ = doSearchRequest(t, newTestServer(), "/Users/.search", `{"attributes": ["userName"]}`)
+	assert.Equal(t, http.StatusBadRequest, code, "status code mismatch")
+}
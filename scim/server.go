@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgbttn/go-scim-server/errors"
 	"github.com/dgbttn/go-scim-server/schema"
@@ -13,8 +14,11 @@ import (
 )
 
 const (
-	defaultStartIndex = 1
-	fallbackCount     = 100
+	defaultStartIndex          = 1
+	fallbackCount              = 100
+	fallbackBulkMaxOperations  = 1000
+	fallbackBulkMaxPayloadSize = 1048576
+	fallbackCursorTimeout      = time.Hour
 )
 
 // Server represents a SCIM server which implements the HTTP-based SCIM protocol that makes managing identities in multi-
@@ -22,6 +26,9 @@ const (
 type Server struct {
 	Config        ServiceProviderConfig
 	ResourceTypes []ResourceType
+	// Me maps the "/Me" endpoint to the resource of the authenticated subject, which authentication middleware passes
+	// with WithSubject. The endpoint returns 501 if it is nil.
+	Me *MeMapping
 }
 
 // getSchemas extracts all the schemas from the resources types defined in the server. Duplicate IDs will be ignored.
@@ -80,6 +87,15 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case path == "/ServiceProviderConfig":
 		s.serviceProviderConfigHandler(w, r)
 		return
+	case path == "/Bulk" && r.Method == http.MethodPost:
+		s.bulkHandler(w, r)
+		return
+	case path == "/.search" && r.Method == http.MethodPost:
+		s.rootSearchHandler(w, r)
+		return
+	case path == "/Me":
+		s.meHandler(w, r)
+		return
 	}
 
 	for _, resourceType := range s.ResourceTypes {
@@ -89,11 +105,16 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				s.resourcePostHandler(w, r, resourceType)
 				return
 			case http.MethodGet:
-				s.resourcesGetHandler(w, r, resourceType)
+				s.resourcesGetHandler(w, r, resourceType, r.URL.Query())
 				return
 			}
 		}
 
+		if path == resourceType.Endpoint+"/.search" && r.Method == http.MethodPost {
+			s.resourcesSearchHandler(w, r, resourceType)
+			return
+		}
+
 		if strings.HasPrefix(path, resourceType.Endpoint+"/") {
 			id, err := parseIdentifier(path, resourceType.Endpoint)
 			if err != nil {
@@ -127,8 +148,8 @@ func parseIdentifier(path, endpoint string) (string, error) {
 	return url.PathUnescape(strings.TrimPrefix(path, endpoint+"/"))
 }
 
-func getIntQueryParam(r *http.Request, key string, def int) (int, error) {
-	strVal := r.URL.Query().Get(key)
+func getIntQueryParam(query url.Values, key string, def int) (int, error) {
+	strVal := query.Get(key)
 
 	if strVal == "" {
 		return def, nil
@@ -141,15 +162,17 @@ func getIntQueryParam(r *http.Request, key string, def int) (int, error) {
 	return 0, fmt.Errorf("invalid query parameter, \"%s\" must be an integer", key)
 }
 
-func (s Server) parseRequestParams(r *http.Request) (ListRequestParams, *errors.ScimError) {
+// parseRequestParams parses the query parameters of a list request. The parameters are either taken from the URL of a
+// GET request or from the body of a search request.
+func (s Server) parseRequestParams(query url.Values) (ListRequestParams, *errors.ScimError) {
 	invalidParams := make([]string, 0)
 
 	defaultCount := s.Config.getItemsPerPage()
-	count, countErr := getIntQueryParam(r, "count", defaultCount)
+	count, countErr := getIntQueryParam(query, "count", defaultCount)
 	if countErr != nil {
 		invalidParams = append(invalidParams, "count")
 	}
-	startIndex, indexErr := getIntQueryParam(r, "startIndex", defaultStartIndex)
+	startIndex, indexErr := getIntQueryParam(query, "startIndex", defaultStartIndex)
 	if indexErr != nil {
 		invalidParams = append(invalidParams, "startIndex")
 	}
@@ -168,21 +191,40 @@ func (s Server) parseRequestParams(r *http.Request) (ListRequestParams, *errors.
 		startIndex = defaultStartIndex
 	}
 
-	filterExpr, filterExprErr := getFilter(r)
+	filterExpr, filterExprErr := getFilter(query)
 	if filterExprErr != nil {
-		scimErr := errors.ScimErrorBadParams([]string{"filter"})
+		return ListRequestParams{}, &errors.ScimErrorInvalidFilter
+	}
+
+	sortBy := strings.TrimSpace(query.Get("sortBy"))
+	sortOrder, sortOrderErr := getSortOrder(query)
+	if sortOrderErr != nil {
+		scimErr := errors.ScimErrorBadParams([]string{"sortOrder"})
 		return ListRequestParams{}, &scimErr
 	}
 
 	return ListRequestParams{
 		Count:      count,
 		Filter:     filterExpr,
+		SortBy:     sortBy,
+		SortOrder:  sortOrder,
 		StartIndex: startIndex,
 	}, nil
 }
 
-func getFilter(r *http.Request) (filter.Expression, error) {
-	rawFilter := strings.TrimSpace(r.URL.Query().Get("filter"))
+func getSortOrder(query url.Values) (SortOrder, error) {
+	switch order := strings.ToLower(strings.TrimSpace(query.Get("sortOrder"))); order {
+	case "", string(SortOrderAscending):
+		return SortOrderAscending, nil
+	case string(SortOrderDescending):
+		return SortOrderDescending, nil
+	default:
+		return "", fmt.Errorf("invalid sort order %q", order)
+	}
+}
+
+func getFilter(query url.Values) (filter.Expression, error) {
+	rawFilter := strings.TrimSpace(query.Get("filter"))
 	if rawFilter != "" {
 		parser := filter.NewParser(strings.NewReader(rawFilter))
 		return parser.Parse()
@@ -1,6 +1,8 @@
 package scim
 
 import (
+	"time"
+
 	"github.com/dgbttn/go-scim-server/optional"
 )
 
@@ -18,6 +20,26 @@ type ServiceProviderConfig struct {
 	SupportFiltering bool
 	// SupportPatch whether your SCIM implementation will support patch requests.
 	SupportPatch bool
+	// SupportSort whether your SCIM implementation will support sorting with the "sortBy" and "sortOrder" parameters.
+	SupportSort bool
+	// SupportETag whether your SCIM implementation will support entity tags and the "If-Match" and "If-None-Match"
+	// headers. The resource handlers are expected to set the version of the resources they return.
+	SupportETag bool
+	// SupportBulk whether your SCIM implementation will support bulk operations on the "/Bulk" endpoint.
+	SupportBulk bool
+	// BulkMaxOperations is the maximum number of operations in a bulk request. It defaults to 1000.
+	BulkMaxOperations int
+	// BulkMaxPayloadSize is the maximum size of a bulk request in bytes. It defaults to 1048576.
+	BulkMaxPayloadSize int
+	// SupportCursorPagination whether your SCIM implementation will support cursor pagination with the "cursor"
+	// parameter (RFC 9865), in addition to index-based pagination. It requires a CursorSecret. The resource handlers
+	// are expected to honor the cursor of the list requests, e.g. with QueryPage.
+	SupportCursorPagination bool
+	// CursorSecret is the key with which the cursors are signed, so that clients can not alter them. Servers that
+	// serve the same clients need to share the key. It is not advertised.
+	CursorSecret []byte
+	// CursorTimeout is the duration for which a cursor can be used after it is issued. It defaults to one hour.
+	CursorTimeout time.Duration
 }
 
 // AuthenticationScheme specifies a supported authentication scheme property.
@@ -61,9 +83,9 @@ func (config ServiceProviderConfig) getRaw() map[string]interface{} {
 			"supported": config.SupportPatch,
 		},
 		"bulk": map[string]interface{}{
-			"supported":      false,
-			"maxOperations":  1000,
-			"maxPayloadSize": 1048576,
+			"supported":      config.SupportBulk,
+			"maxOperations":  config.getBulkMaxOperations(),
+			"maxPayloadSize": config.getBulkMaxPayloadSize(),
 		},
 		"filter": map[string]interface{}{
 			"supported":  config.SupportFiltering,
@@ -73,11 +95,12 @@ func (config ServiceProviderConfig) getRaw() map[string]interface{} {
 			"supported": false,
 		},
 		"sort": map[string]bool{
-			"supported": false,
+			"supported": config.SupportSort,
 		},
 		"etag": map[string]bool{
-			"supported": false,
+			"supported": config.SupportETag,
 		},
+		"pagination":            config.getRawPagination(),
 		"authenticationSchemes": config.getRawAuthenticationSchemes(),
 	}
 }
@@ -90,6 +113,53 @@ func (config ServiceProviderConfig) getItemsPerPage() int {
 	return config.MaxResults
 }
 
+// getBulkMaxOperations retrieves the configured maximum number of bulk operations. It falls back to 1000 when not
+// configured.
+func (config ServiceProviderConfig) getBulkMaxOperations() int {
+	if config.BulkMaxOperations < 1 {
+		return fallbackBulkMaxOperations
+	}
+	return config.BulkMaxOperations
+}
+
+// getBulkMaxPayloadSize retrieves the configured maximum bulk payload size. It falls back to 1048576 bytes when not
+// configured.
+func (config ServiceProviderConfig) getBulkMaxPayloadSize() int {
+	if config.BulkMaxPayloadSize < 1 {
+		return fallbackBulkMaxPayloadSize
+	}
+	return config.BulkMaxPayloadSize
+}
+
+// getCursorTimeout retrieves the configured cursor timeout. It falls back to one hour when not configured.
+func (config ServiceProviderConfig) getCursorTimeout() time.Duration {
+	if config.CursorTimeout <= 0 {
+		return fallbackCursorTimeout
+	}
+	return config.CursorTimeout
+}
+
+// supportsCursorPagination returns whether cursor pagination is enabled, and the cursors can be signed.
+func (config ServiceProviderConfig) supportsCursorPagination() bool {
+	return config.SupportCursorPagination && len(config.CursorSecret) != 0
+}
+
+// getRawPagination returns the supported pagination methods and their settings (RFC 9865 section 4). Index-based
+// pagination is always supported, and remains the default.
+func (config ServiceProviderConfig) getRawPagination() map[string]interface{} {
+	pagination := map[string]interface{}{
+		"cursor":                  config.supportsCursorPagination(),
+		"index":                   true,
+		"defaultPaginationMethod": "index",
+		"defaultPageSize":         config.getItemsPerPage(),
+		"maxPageSize":             config.getItemsPerPage(),
+	}
+	if config.supportsCursorPagination() {
+		pagination["cursorTimeout"] = int(config.getCursorTimeout().Seconds())
+	}
+	return pagination
+}
+
 func (config ServiceProviderConfig) getRawAuthenticationSchemes() []map[string]interface{} {
 	rawAuthScheme := make([]map[string]interface{}, 0)
 	for _, auth := range config.AuthenticationSchemes {
@@ -0,0 +1,185 @@
+package scim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgbttn/go-scim-server/schema"
+)
+
+// SortOrder is the order in which the "sortBy" parameter is applied.
+type SortOrder string
+
+const (
+	// SortOrderAscending sorts the resources from the lowest to the highest value. This is the default sort order.
+	SortOrderAscending SortOrder = "ascending"
+	// SortOrderDescending sorts the resources from the highest to the lowest value.
+	SortOrderDescending SortOrder = "descending"
+)
+
+// sortIndices returns the indices of the n given attribute values in the order in which they are sorted by the values
+// of the attribute referenced by sortBy, as described in RFC 7644 section 3.4.2.3. Strings are compared based on the
+// "caseExact" characteristic of the attribute and multi-valued attributes are sorted by their primary (or otherwise
+// first) value. Resources without a value are sorted last in ascending order, and first in descending order.
+func (t ResourceType) sortIndices(n int, values func(i int) map[string]interface{}, sortBy string, order SortOrder) ([]int, error) {
+	if _, _, ok := t.getAttributePath(sortBy); !ok {
+		return nil, fmt.Errorf("unknown sort attribute %q", sortBy)
+	}
+
+	keys := make([]interface{}, n)
+	var leaf schema.CoreAttribute
+	for i := range keys {
+		keys[i], leaf, _ = t.sortValueKey(values(i), sortBy)
+	}
+
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		cmp := compareSortValues(leaf, keys[indices[i]], keys[indices[j]])
+		if order == SortOrderDescending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return indices, nil
+}
+
+// sortKey returns the value of a resource that is used to sort it, together with the definition of that value. It
+// returns false if sortBy does not reference an attribute of the resource type.
+func (t ResourceType) sortKey(resource Resource, sortBy string) (interface{}, schema.CoreAttribute, bool) {
+	return t.sortValueKey(resource.values(), sortBy)
+}
+
+// sortValueKey returns the sort value within the given attribute values of a resource, like sortKey.
+func (t ResourceType) sortValueKey(values map[string]interface{}, sortBy string) (interface{}, schema.CoreAttribute, bool) {
+	attr, sub, ok := t.getAttributePath(sortBy)
+	if !ok {
+		return nil, schema.CoreAttribute{}, false
+	}
+
+	leaf := attr.attribute
+	if sub != nil {
+		leaf = *sub
+	} else if v, ok := leaf.SubAttribute("value"); ok {
+		leaf = v
+	}
+	return sortValue(values, attr, sub), leaf, true
+}
+
+// sortValue returns the value of a resource that is used to sort it.
+func sortValue(values map[string]interface{}, attr schemaAttribute, sub *schema.CoreAttribute) interface{} {
+	container := values
+	if attr.schemaID != "" {
+		container, _ = toMap(lookup(values, attr.schemaID))
+	}
+	value := lookup(container, attr.attribute.Name())
+
+	if attr.attribute.MultiValued() {
+		elements, _ := toSlice(value)
+		if len(elements) == 0 {
+			return nil
+		}
+		value = elements[0]
+		for _, element := range elements {
+			if m, ok := toMap(element); ok && lookup(m, "primary") == true {
+				value = element
+				break
+			}
+		}
+	}
+
+	if attr.attribute.AttributeType() != "complex" {
+		return value
+	}
+
+	m, ok := toMap(value)
+	if !ok {
+		return nil
+	}
+	if sub != nil {
+		return lookup(m, sub.Name())
+	}
+	return lookup(m, "value")
+}
+
+// compareSortValues compares two sort values of the given attribute. Missing values are greater than all other values.
+func compareSortValues(attr schema.CoreAttribute, a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch attr.AttributeType() {
+	case "boolean":
+		x, _ := a.(bool)
+		y, _ := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case y:
+			return -1
+		default:
+			return 1
+		}
+	case "decimal", "integer":
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	case "dateTime":
+		x, _ := toTime(a)
+		y, _ := toTime(b)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		default:
+			return 0
+		}
+	default:
+		return compareStrings(fmt.Sprint(a), fmt.Sprint(b), attr.CaseExact())
+	}
+}
+
+func compareStrings(a, b string, caseExact bool) int {
+	if !caseExact {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// sortRaw sorts a slice of server resources, such as schemas or resource types, by the string value of the attribute
+// referenced by sortBy within their raw representation. The values are compared case-insensitively.
+func sortRaw(slice interface{}, raw func(i int) map[string]interface{}, sortBy string, order SortOrder) {
+	sort.SliceStable(slice, func(i, j int) bool {
+		a, b := lookup(raw(i), sortBy), lookup(raw(j), sortBy)
+		var cmp int
+		switch {
+		case a == nil && b == nil:
+		case a == nil:
+			cmp = 1
+		case b == nil:
+			cmp = -1
+		default:
+			cmp = compareStrings(fmt.Sprint(a), fmt.Sprint(b), false)
+		}
+		if order == SortOrderDescending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
@@ -0,0 +1,118 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSortValues returns the stored values of the users that are sorted in the tests.
+func newTestSortValues() []ResourceAttributes {
+	early, _ := time.Parse(time.RFC3339, "2019-01-01T00:00:00Z")
+	late, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	resources := []Resource{
+		{
+			ID: "0001",
+			Attributes: ResourceAttributes{
+				"userName": "charlie",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "a@example.com"},
+					map[string]interface{}{"value": "z@example.com", "primary": true},
+				},
+			},
+			Meta: Meta{Created: &late},
+		},
+		{
+			ID: "0002",
+			Attributes: ResourceAttributes{
+				"userName": "Alice",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "m@example.com"},
+				},
+			},
+			Meta: Meta{Created: &early},
+		},
+		{
+			ID:         "0003",
+			Attributes: ResourceAttributes{"userName": "bob"},
+		},
+	}
+
+	values := make([]ResourceAttributes, len(resources))
+	for i, resource := range resources {
+		values[i] = resource.values()
+	}
+	return values
+}
+
+func TestQueryResourcesSorted(t *testing.T) {
+	tests := []struct {
+		sortBy string
+		order  SortOrder
+		ids    []string
+	}{
+		{sortBy: "userName", order: SortOrderAscending, ids: []string{"0002", "0003", "0001"}},
+		{sortBy: "userName", order: SortOrderDescending, ids: []string{"0001", "0003", "0002"}},
+		{sortBy: "emails", order: SortOrderAscending, ids: []string{"0002", "0001", "0003"}},
+		{sortBy: "emails.value", order: SortOrderDescending, ids: []string{"0003", "0001", "0002"}},
+		{sortBy: "meta.created", order: SortOrderAscending, ids: []string{"0002", "0001", "0003"}},
+		{sortBy: "urn:ietf:params:scim:schemas:core:2.0:User:userName", order: SortOrderAscending, ids: []string{"0002", "0003", "0001"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // scopelint
+		t.Run(tt.sortBy+" "+string(tt.order), func(t *testing.T) {
+			resources, err := newTestFilterResourceType().QueryResources(newTestSortValues(), StoreQuery{
+				SortBy:    tt.sortBy,
+				SortOrder: tt.order,
+			})
+			assert.NoError(t, err)
+
+			ids := make([]string, len(resources))
+			for i, resource := range resources {
+				ids[i] = resource["id"].(string)
+			}
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+}
+
+func TestQueryResourcesInvalidSort(t *testing.T) {
+	_, err := newTestFilterResourceType().QueryResources(newTestSortValues(), StoreQuery{SortBy: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestServerResourceTypesHandlerSorted(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ResourceTypes?sortBy=name&sortOrder=ascending", nil)
+	rr := httptest.NewRecorder()
+	newTestServer().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "status code mismatch")
+
+	var response listResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err, "json unmarshalling failed")
+
+	names := make([]string, 0)
+	for _, resource := range response.Resources {
+		names = append(names, resource.(map[string]interface{})["name"].(string))
+	}
+	assert.Equal(t, []string{"EnterpriseUser", "User"}, names)
+}
+
+func TestServerResourcesGetHandlerInvalidSort(t *testing.T) {
+	for _, target := range []string{
+		"/Users?sortBy=userName&sortOrder=sideways",
+		"/Users?sortBy=unknown",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		newTestServer().ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+	}
+}
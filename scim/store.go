@@ -0,0 +1,224 @@
+package scim
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sort"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// Store stores the resources of a single resource type, e.g. in a database collection. The resources are stored in
+// their full representation, as returned by Resource.Map. All methods are bound to the given context, so that they are
+// cancelled together with the request they serve.
+type Store interface {
+	// Insert stores a new resource. ErrDuplicateValue is returned if the resource has the value of a unique attribute
+	// that is already in use.
+	Insert(ctx context.Context, resource ResourceAttributes) error
+	// Find returns the stored resource with the given id, or nil if there is no such resource.
+	Find(ctx context.Context, id string) (ResourceAttributes, error)
+	// Query returns the stored resources that match the query. Errors of the filter or the sort attribute of the query
+	// are returned as an errors.ScimError.
+	Query(ctx context.Context, query StoreQuery) ([]ResourceAttributes, error)
+	// Count returns the number of stored resources that match the filter. A nil filter matches all resources.
+	Count(ctx context.Context, filter filter.Expression) (int, error)
+	// InUse returns whether a resource other than the one with the given id has one of the values of the unique
+	// attribute.
+	InUse(ctx context.Context, attribute UniqueAttribute, id string, values []interface{}) (bool, error)
+	// Replace replaces the stored resource with the given id, if it still has the given version. Otherwise
+	// ErrVersionMismatch is returned.
+	Replace(ctx context.Context, id string, resource ResourceAttributes, version string) error
+	// Delete removes the stored resource with the given id. If the version is not empty, the resource is only removed
+	// if it still has that version, otherwise ErrVersionMismatch is returned.
+	Delete(ctx context.Context, id string, version string) error
+	// Transaction calls fn within a transaction, which is committed if fn returns nil and aborted otherwise. The
+	// operations of fn have to use the context it is given to be part of the transaction.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// StoreQuery describes a (paginated) query on the resources in a Store.
+type StoreQuery struct {
+	// Filter is the filter the resources need to match. A nil filter matches all resources.
+	Filter filter.Expression
+	// SortBy is the attribute path whose value is used to order the resources. The resources are ordered by their id
+	// if it is empty, and resources with the same value are ordered by their id as well, so that pages are stable.
+	SortBy string
+	// SortOrder is the order in which SortBy is applied.
+	SortOrder SortOrder
+	// Skip is the number of matching resources to skip.
+	Skip int
+	// Limit is the maximum number of resources to return. A value of 0 means that there is no limit.
+	Limit int
+	// Reverse reverses the order of the resources, including the order by id of resources with the same value, before
+	// Skip and Limit are applied. It is used to read the page that ends before a cursor.
+	Reverse bool
+}
+
+var (
+	// ErrVersionMismatch is returned by a Store when a resource is replaced, but there is no resource with the given
+	// id and version, e.g. because it has been changed concurrently.
+	ErrVersionMismatch = goerrors.New("scim: no resource matches the id and version")
+	// ErrDuplicateValue is returned by a Store when a resource is stored with the value of a unique attribute that is
+	// already in use.
+	ErrDuplicateValue = goerrors.New("scim: the value of a unique attribute is already in use")
+)
+
+// QueryPage returns the total number of resources in the store that match the filter of the request, together with the
+// resources on the requested page. The count of the request is reduced to the number of returned resources if there
+// are less resources left than requested. If the request has a cursor, the page continues from the cursor instead of
+// the start index, and HasMore of the request is set.
+func QueryPage(ctx context.Context, store Store, params *ListRequestParams) (int, []ResourceAttributes, error) {
+	total, err := store.Count(ctx, params.Filter)
+	if err != nil {
+		return 0, nil, err
+	}
+	if params.Cursor != nil {
+		resources, err := queryCursorPage(ctx, store, params)
+		return total, resources, err
+	}
+
+	skip := 0
+	if params.StartIndex > 0 {
+		skip = params.StartIndex - 1
+	}
+	if skip+params.Count > total {
+		params.Count = total - skip
+		if params.Count < 0 {
+			params.Count = 0
+		}
+	}
+	if params.Count == 0 {
+		return total, []ResourceAttributes{}, nil
+	}
+
+	resources, err := store.Query(ctx, StoreQuery{
+		Filter:    params.Filter,
+		SortBy:    params.SortBy,
+		SortOrder: params.SortOrder,
+		Skip:      skip,
+		Limit:     params.Count,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, resources, nil
+}
+
+// queryCursorPage returns the resources after the cursor of the request, or before it if the cursor points backward. One
+// more resource than requested is queried, to find out whether there are more resources beyond the page. As the cursor
+// is a position rather than an index, resources that are added or removed before it do not shift the page.
+func queryCursorPage(ctx context.Context, store Store, params *ListRequestParams) ([]ResourceAttributes, error) {
+	query := StoreQuery{
+		Filter:    params.Filter,
+		SortBy:    params.SortBy,
+		SortOrder: params.SortOrder,
+		Limit:     params.Count + 1,
+		Reverse:   params.Cursor.Backward,
+	}
+	if seek := params.Cursor.seekFilter(params.SortBy, params.SortOrder); seek != nil {
+		query.Filter = and(query.Filter, seek)
+	}
+
+	resources, err := store.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	params.HasMore = len(resources) > params.Count
+	if params.HasMore {
+		resources = resources[:params.Count]
+	}
+	if params.Cursor.Backward {
+		for i, j := 0, len(resources)-1; i < j; i, j = i+1, j-1 {
+			resources[i], resources[j] = resources[j], resources[i]
+		}
+	}
+	params.Count = len(resources)
+	return resources, nil
+}
+
+// MatchResources returns the resources that match the filter. It is meant for stores that can not query their resources,
+// and instead scan all of them. A nil filter matches all resources.
+func (t ResourceType) MatchResources(resources []ResourceAttributes, expression filter.Expression) ([]ResourceAttributes, error) {
+	validator := NewFilterValidator(expression, t)
+	if scimErr := validator.Validate(); scimErr != nil {
+		return nil, *scimErr
+	}
+
+	matches := make([]ResourceAttributes, 0, len(resources))
+	for _, resource := range resources {
+		if expression == nil || validator.evaluate(expression, nil, resource) {
+			matches = append(matches, resource)
+		}
+	}
+	return matches, nil
+}
+
+// QueryResources returns the resources that match the query, ordered and paginated as described by the query. Like
+// MatchResources, it is meant for stores that scan all their resources. The returned resources are not copied.
+func (t ResourceType) QueryResources(resources []ResourceAttributes, query StoreQuery) ([]ResourceAttributes, error) {
+	resources, err := t.MatchResources(resources, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		a, _ := resources[i]["id"].(string)
+		b, _ := resources[j]["id"].(string)
+		return a < b
+	})
+	if query.SortBy != "" {
+		indices, err := t.sortIndices(len(resources), func(i int) map[string]interface{} {
+			return resources[i]
+		}, query.SortBy, query.SortOrder)
+		if err != nil {
+			return nil, errors.ScimErrorBadParams([]string{"sortBy"})
+		}
+		sorted := make([]ResourceAttributes, len(resources))
+		for i, index := range indices {
+			sorted[i] = resources[index]
+		}
+		resources = sorted
+	}
+	if query.Reverse {
+		for i, j := 0, len(resources)-1; i < j; i, j = i+1, j-1 {
+			resources[i], resources[j] = resources[j], resources[i]
+		}
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = len(resources)
+	}
+	start, end := clamp(query.Skip, limit, len(resources))
+	return resources[start:end], nil
+}
+
+// StoreError converts an error of a Store to a SCIM error. A resource that no longer has the version it was read with
+// has been changed concurrently. Errors that already are SCIM errors, such as an invalid filter, are returned as is.
+// Operations that time out are reported with the operation and its timeout as detail.
+func StoreError(err error) error {
+	switch err := err.(type) {
+	case errors.ScimError:
+		return err
+	case *errors.ScimError:
+		return *err
+	}
+	var timeout TimeoutError
+	if goerrors.As(err, &timeout) {
+		return errors.ScimErrorTimeout(fmt.Sprintf(
+			"The %s operation of the data store did not complete within %s. Please try again later.",
+			timeout.Operation, timeout.Timeout,
+		))
+	}
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		return errors.ScimErrorTimeout("The data store did not respond before the request timed out. Please try again later.")
+	}
+	switch err {
+	case ErrVersionMismatch:
+		return errors.ScimErrorPreconditionFailed
+	case ErrDuplicateValue:
+		return errors.ScimErrorUniqueness
+	}
+	return errors.ScimErrorInternal
+}
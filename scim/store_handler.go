@@ -0,0 +1,377 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/optional"
+	"github.com/dgbttn/go-scim-server/schema"
+	"github.com/google/uuid"
+)
+
+// StoreHandler is a ResourceHandler that stores the resources of a resource type in a Store. It generates
+// the ids of new resources, maintains their meta data and versions, enforces the uniqueness of attribute values and
+// applies patches, so that any resource type can be served once it has a store.
+type StoreHandler struct {
+	resourceType ResourceType
+	store        Store
+	hooks        StoreHooks
+}
+
+// StoreHooks customize how a StoreHandler stores and returns the resources of its resource type, e.g. to validate the
+// references of a resource to other resources, or to add attributes that are derived from other resources. Hooks that
+// are not set are skipped.
+type StoreHooks struct {
+	// Prepare validates the attributes of the resource with the given id before it is created or replaced, and converts
+	// them to the form in which they are stored.
+	Prepare func(ctx context.Context, id string, attributes ResourceAttributes) error
+	// CheckUniqueness replaces the check that no other resource in the store has one of the values of the unique
+	// attributes of the resource, e.g. to check values that are unique across resource types.
+	CheckUniqueness func(ctx context.Context, id string, attributes ResourceAttributes) error
+	// Output adds the attributes that are not stored to the resources, before they are returned. Their version has to
+	// cover these attributes, see DerivedETag.
+	Output func(r *http.Request, resources []Resource) ([]Resource, error)
+	// Deleted removes the references of other resources to the deleted resource with the given id. It is called in the
+	// transaction that deletes the resource.
+	Deleted func(ctx context.Context, id string) error
+}
+
+// NewStoreHandler returns a handler for the resources of the given resource type, which are stored in the store.
+func NewStoreHandler(resourceType ResourceType, store Store) StoreHandler {
+	return StoreHandler{
+		resourceType: resourceType,
+		store:        store,
+	}
+}
+
+// WithHooks returns a copy of the handler that calls the given hooks.
+func (h StoreHandler) WithHooks(hooks StoreHooks) StoreHandler {
+	h.hooks = hooks
+	return h
+}
+
+// Create stores a new resource with the given attributes and a newly generated id.
+func (h StoreHandler) Create(r *http.Request, attributes ResourceAttributes) (Resource, error) {
+	ctx := r.Context()
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	resource := h.newResource(id, attributes, Meta{
+		ResourceType: h.resourceType.Name,
+		Created:      &now,
+		LastModified: &now,
+		Location:     fmt.Sprintf("%s/%s", h.resourceType.Endpoint[1:], url.PathEscape(id)),
+		Version:      nextVersion(""),
+	})
+	if err := h.prepare(ctx, id, resource.Attributes); err != nil {
+		return Resource{}, err
+	}
+	if err := h.store.Insert(ctx, resource.Map(h.resourceType)); err != nil {
+		return Resource{}, StoreError(err)
+	}
+	return h.outputResource(r, resource)
+}
+
+// Get returns the stored resource with the given id.
+func (h StoreHandler) Get(r *http.Request, id string) (Resource, error) {
+	stored, err := h.find(r.Context(), id)
+	if err != nil {
+		return Resource{}, err
+	}
+	return h.outputResource(r, h.storedResource(stored))
+}
+
+// GetAll returns the stored resources that match the filter of the request, on the requested page.
+func (h StoreHandler) GetAll(r *http.Request, params *ListRequestParams) (Page, error) {
+	total, data, err := QueryPage(r.Context(), h.store, params)
+	if err != nil {
+		return Page{}, StoreError(err)
+	}
+
+	resources := make([]Resource, 0, len(data))
+	for _, stored := range data {
+		resources = append(resources, h.storedResource(stored))
+	}
+	if resources, err = h.output(r, resources); err != nil {
+		return Page{}, err
+	}
+	return Page{
+		TotalResults: total,
+		Resources:    resources,
+	}, nil
+}
+
+// Replace replaces all the attributes of the stored resource with the given id, unless the resource has been changed
+// in the meantime.
+func (h StoreHandler) Replace(r *http.Request, id string, attributes ResourceAttributes) (Resource, error) {
+	stored, err := h.find(r.Context(), id)
+	if err != nil {
+		return Resource{}, err
+	}
+	return h.replace(r, id, h.storedResource(stored), attributes)
+}
+
+// Delete removes the stored resource with the given id, together with the references to it if there is a Deleted hook.
+func (h StoreHandler) Delete(r *http.Request, id string) error {
+	ctx := r.Context()
+	stored, err := h.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	var version string
+	if _, ok := VersionFromContext(ctx); ok {
+		current := h.storedResource(stored)
+		if err := h.checkVersion(r, current); err != nil {
+			return err
+		}
+		version = current.Meta.Version
+	}
+	if h.hooks.Deleted == nil {
+		if err := h.store.Delete(ctx, id, version); err != nil {
+			return StoreError(err)
+		}
+		return nil
+	}
+
+	err = h.store.Transaction(ctx, func(ctx context.Context) error {
+		if err := h.store.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		return h.hooks.Deleted(ctx, id)
+	})
+	if err != nil {
+		return StoreError(err)
+	}
+	return nil
+}
+
+// Patch applies the operations of the request to the stored resource with the given id, unless the resource has been
+// changed in the meantime.
+func (h StoreHandler) Patch(r *http.Request, id string, request PatchRequest) (Resource, error) {
+	stored, err := h.find(r.Context(), id)
+	if err != nil {
+		return Resource{}, err
+	}
+	patched, err := h.resourceType.ApplyPatch(stored, request)
+	if err != nil {
+		return Resource{}, err
+	}
+	return h.replace(r, id, h.storedResource(stored), patched)
+}
+
+// Update applies fn to the attributes of the stored resource with the given id, and stores them as the next version of
+// the resource, unless the resource has been changed in the meantime. It updates resources outside of the requests of
+// clients, e.g. to remove the references to a deleted resource in the transaction that deletes it.
+func (h StoreHandler) Update(ctx context.Context, id string, fn func(attributes ResourceAttributes) error) (Resource, error) {
+	stored, err := h.find(ctx, id)
+	if err != nil {
+		return Resource{}, err
+	}
+	current := h.storedResource(stored)
+	if err := fn(stored); err != nil {
+		return Resource{}, err
+	}
+	return h.write(ctx, id, current, stored)
+}
+
+// replace stores the resource with the given attributes as the next version of the given stored resource.
+func (h StoreHandler) replace(r *http.Request, id string, current Resource, attributes ResourceAttributes) (Resource, error) {
+	if err := h.checkVersion(r, current); err != nil {
+		return Resource{}, err
+	}
+	resource, err := h.write(r.Context(), id, current, attributes)
+	if err != nil {
+		return Resource{}, err
+	}
+	return h.outputResource(r, resource)
+}
+
+// write stores the resource with the given attributes as the next version of the given stored resource, if it still has
+// the version of the given resource.
+func (h StoreHandler) write(ctx context.Context, id string, current Resource, attributes ResourceAttributes) (Resource, error) {
+	now := time.Now().UTC()
+	resource := h.newResource(id, attributes, Meta{
+		ResourceType: current.Meta.ResourceType,
+		Created:      current.Meta.Created,
+		LastModified: &now,
+		Location:     current.Meta.Location,
+		Version:      nextVersion(current.Meta.Version),
+	})
+	if err := h.prepare(ctx, id, resource.Attributes); err != nil {
+		return Resource{}, err
+	}
+	if err := h.store.Replace(ctx, id, resource.Map(h.resourceType), current.Meta.Version); err != nil {
+		return Resource{}, StoreError(err)
+	}
+	return resource, nil
+}
+
+// checkVersion checks that the stored resource, as it is returned, still has the version that matched the "If-Match"
+// header of the request, if any. The write that follows is conditional on the stored version of the resource, so that
+// the check and the write are one conditional write.
+func (h StoreHandler) checkVersion(r *http.Request, current Resource) error {
+	matched, ok := VersionFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	returned, err := h.outputResource(r, current)
+	if err != nil {
+		return err
+	}
+	if returned.Meta.Version != matched {
+		return StoreError(ErrVersionMismatch)
+	}
+	return nil
+}
+
+// prepare calls the Prepare hook on the attributes of the resource with the given id, and checks their uniqueness.
+func (h StoreHandler) prepare(ctx context.Context, id string, attributes ResourceAttributes) error {
+	if h.hooks.Prepare != nil {
+		if err := h.hooks.Prepare(ctx, id, attributes); err != nil {
+			return err
+		}
+	}
+	if h.hooks.CheckUniqueness != nil {
+		return h.hooks.CheckUniqueness(ctx, id, attributes)
+	}
+	return h.checkUniqueness(ctx, id, attributes)
+}
+
+// output calls the Output hook on the resources that are returned.
+func (h StoreHandler) output(r *http.Request, resources []Resource) ([]Resource, error) {
+	if h.hooks.Output == nil {
+		return resources, nil
+	}
+	return h.hooks.Output(r, resources)
+}
+
+// outputResource calls the Output hook on the resource that is returned.
+func (h StoreHandler) outputResource(r *http.Request, resource Resource) (Resource, error) {
+	resources, err := h.output(r, []Resource{resource})
+	if err != nil {
+		return Resource{}, err
+	}
+	return resources[0], nil
+}
+
+// find returns the stored resource with the given id, with all maps and slices converted to map[string]interface{}
+// and []interface{} respectively.
+func (h StoreHandler) find(ctx context.Context, id string) (ResourceAttributes, error) {
+	stored, err := h.store.Find(ctx, id)
+	if err != nil {
+		return nil, StoreError(err)
+	}
+	if stored == nil {
+		return nil, errors.ScimErrorResourceNotFound(id)
+	}
+	attributes, _ := copyValue(map[string]interface{}(stored)).(map[string]interface{})
+	return attributes, nil
+}
+
+// checkUniqueness checks that no other resource has one of the values of the unique attributes of the resource.
+func (h StoreHandler) checkUniqueness(ctx context.Context, id string, attributes ResourceAttributes) error {
+	for _, attribute := range h.resourceType.UniqueAttributes() {
+		values := attribute.Values(attributes)
+		if len(values) == 0 {
+			continue
+		}
+		inUse, err := h.store.InUse(ctx, attribute, id, values)
+		if err != nil {
+			return StoreError(err)
+		}
+		if inUse {
+			return errors.ScimError{
+				ScimType: errors.ScimTypeUniqueness,
+				Detail:   fmt.Sprintf("The value of %s is already in use.", attribute.Path()),
+				Status:   http.StatusConflict,
+			}
+		}
+	}
+	return nil
+}
+
+// newResource returns the resource with the given id, attributes and meta data. The common attributes and the values
+// that are not set are removed from the attributes.
+func (h StoreHandler) newResource(id string, attributes ResourceAttributes, meta Meta) Resource {
+	resource := Resource{
+		ID:         id,
+		Attributes: make(ResourceAttributes, len(attributes)),
+		Meta:       meta,
+	}
+	for k, v := range attributes {
+		switch {
+		case strings.EqualFold(k, schema.CommonAttributeExternalID):
+			if externalID, ok := v.(string); ok {
+				resource.ExternalID = optional.NewString(externalID)
+			}
+		case strings.EqualFold(k, schema.CommonAttributeID),
+			strings.EqualFold(k, schema.CommonAttributeMeta),
+			strings.EqualFold(k, "schemas"):
+		default:
+			if v = withoutNil(v); v != nil {
+				resource.Attributes[k] = v
+			}
+		}
+	}
+	return resource
+}
+
+// storedResource returns the resource of the stored representation, of which the meta data is read back.
+func (h StoreHandler) storedResource(stored ResourceAttributes) Resource {
+	id, _ := lookup(stored, schema.CommonAttributeID).(string)
+
+	var meta Meta
+	raw, _ := toMap(lookup(stored, schema.CommonAttributeMeta))
+	meta.ResourceType, _ = lookup(raw, "resourceType").(string)
+	meta.Location, _ = lookup(raw, "location").(string)
+	meta.Version, _ = lookup(raw, "version").(string)
+	if created, ok := toTime(lookup(raw, "created")); ok {
+		meta.Created = &created
+	}
+	if lastModified, ok := toTime(lookup(raw, "lastModified")); ok {
+		meta.LastModified = &lastModified
+	}
+
+	return h.newResource(id, stored, meta)
+}
+
+// withoutNil returns the value without the (sub-)attributes that are not set, or nil if the value is not set at all.
+func withoutNil(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, sub := range v {
+			if sub = withoutNil(sub); sub != nil {
+				m[k] = sub
+			}
+		}
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			if element = withoutNil(element); element != nil {
+				s = append(s, element)
+			}
+		}
+		if len(s) == 0 {
+			return nil
+		}
+		return s
+	}
+	return value
+}
+
+// nextVersion returns the weak entity tag of the revision that follows the given version. The first revision of a
+// resource is `W/"1"`.
+func nextVersion(version string) string {
+	revision, _ := strconv.Atoi(strings.Trim(strings.TrimPrefix(version, "W/"), `"`))
+	return WeakETag(strconv.Itoa(revision + 1))
+}
@@ -0,0 +1,223 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStoreHandler() (StoreHandler, *MemoryDatabase) {
+	resourceType := newTestDeviceResourceType()
+	database := NewMemoryDatabase()
+	return NewStoreHandler(resourceType, database.Store(resourceType)), database
+}
+
+func TestStoreHandlerCreate(t *testing.T) {
+	handler, database := newTestStoreHandler()
+	r := httptest.NewRequest(http.MethodPost, "/Devices", nil)
+
+	resource, err := handler.Create(r, ResourceAttributes{"serial": "SN-1", "name": nil, "externalId": "printer"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, resource.ID)
+	assert.Equal(t, "printer", resource.ExternalID.Value())
+	assert.Equal(t, ResourceAttributes{"serial": "SN-1"}, resource.Attributes)
+	assert.Equal(t, "Device", resource.Meta.ResourceType)
+	assert.Equal(t, "Devices/"+resource.ID, resource.Meta.Location)
+	assert.Equal(t, `W/"1"`, resource.Meta.Version)
+	assert.Contains(t, database.resources["Device"], resource.ID)
+
+	stored, err := handler.Get(r, resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, resource.Attributes, stored.Attributes)
+	assert.Equal(t, resource.Meta.Version, stored.Meta.Version)
+	assert.Equal(t, resource.Meta.Created.Unix(), stored.Meta.Created.Unix())
+
+	_, err = handler.Create(r, ResourceAttributes{"serial": "SN-1"})
+	assert.Equal(t, errors.ScimTypeUniqueness, err.(errors.ScimError).ScimType)
+}
+
+func TestStoreHandlerReplaceAndPatch(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	r := httptest.NewRequest(http.MethodPut, "/Devices", nil)
+
+	resource, err := handler.Create(r, ResourceAttributes{"serial": "SN-1", "name": "printer"})
+	assert.NoError(t, err)
+
+	replaced, err := handler.Replace(r, resource.ID, ResourceAttributes{"serial": "SN-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceAttributes{"serial": "SN-2"}, replaced.Attributes)
+	assert.Equal(t, `W/"2"`, replaced.Meta.Version)
+	assert.Equal(t, resource.Meta.Created.Unix(), replaced.Meta.Created.Unix())
+
+	patched, err := handler.Patch(r, resource.ID, PatchRequest{Operations: []PatchOperation{
+		{Op: PatchOperationAdd, Path: "name", Value: "scanner"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceAttributes{"serial": "SN-2", "name": "scanner"}, patched.Attributes)
+	assert.Equal(t, `W/"3"`, patched.Meta.Version)
+
+	_, err = handler.Replace(r, "unknown", ResourceAttributes{})
+	assert.Equal(t, http.StatusNotFound, err.(errors.ScimError).Status)
+}
+
+func TestStoreHandlerUpdate(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	r := httptest.NewRequest(http.MethodPost, "/Devices", nil)
+
+	resource, err := handler.Create(r, ResourceAttributes{"serial": "SN-1", "name": "printer", "externalId": "printer"})
+	assert.NoError(t, err)
+
+	updated, err := handler.Update(context.Background(), resource.ID, func(attributes ResourceAttributes) error {
+		delete(attributes, "name")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceAttributes{"serial": "SN-1"}, updated.Attributes)
+	assert.Equal(t, "printer", updated.ExternalID.Value())
+	assert.Equal(t, `W/"2"`, updated.Meta.Version)
+
+	_, err = handler.Update(context.Background(), resource.ID, func(ResourceAttributes) error {
+		return errors.ScimErrorInvalidValue
+	})
+	assert.Equal(t, errors.ScimErrorInvalidValue, err)
+
+	_, err = handler.Update(context.Background(), "unknown", func(ResourceAttributes) error { return nil })
+	assert.Equal(t, http.StatusNotFound, err.(errors.ScimError).Status)
+}
+
+func TestStoreHandlerGetAllAndDelete(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	r := httptest.NewRequest(http.MethodGet, "/Devices", nil)
+
+	for _, serial := range []string{"SN-1", "SN-2", "SN-3"} {
+		_, err := handler.Create(r, ResourceAttributes{"serial": serial})
+		assert.NoError(t, err)
+	}
+
+	params := ListRequestParams{Count: 2, StartIndex: 3}
+	page, err := handler.GetAll(r, &params)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.TotalResults)
+	assert.Len(t, page.Resources, 1)
+	assert.Equal(t, 1, params.Count)
+
+	id := page.Resources[0].ID
+	assert.NoError(t, handler.Delete(r, id))
+	_, err = handler.Get(r, id)
+	assert.Equal(t, http.StatusNotFound, err.(errors.ScimError).Status)
+}
+
+func TestStoreHandlerHooks(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	var deleted []string
+	handler = handler.WithHooks(StoreHooks{
+		Prepare: func(_ context.Context, _ string, attributes ResourceAttributes) error {
+			if attributes["serial"] == "SN-0" {
+				return errors.ScimErrorInvalidValue
+			}
+			attributes["serial"] = strings.ToUpper(attributes["serial"].(string))
+			return nil
+		},
+		CheckUniqueness: func(_ context.Context, _ string, attributes ResourceAttributes) error {
+			if attributes["serial"] == "SN-3" {
+				return errors.ScimErrorUniqueness
+			}
+			return nil
+		},
+		Output: func(_ *http.Request, resources []Resource) ([]Resource, error) {
+			for _, resource := range resources {
+				resource.Attributes["name"] = "device " + resource.Attributes["serial"].(string)
+			}
+			return resources, nil
+		},
+		Deleted: func(_ context.Context, id string) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	})
+	r := httptest.NewRequest(http.MethodPost, "/Devices", nil)
+
+	_, err := handler.Create(r, ResourceAttributes{"serial": "SN-0"})
+	assert.Equal(t, errors.ScimErrorInvalidValue, err)
+
+	resource, err := handler.Create(r, ResourceAttributes{"serial": "sn-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SN-1", resource.Attributes["serial"])
+	assert.Equal(t, "device SN-1", resource.Attributes["name"])
+
+	// the uniqueness check of the handler is replaced
+	_, err = handler.Create(r, ResourceAttributes{"serial": "sn-3"})
+	assert.Equal(t, errors.ScimErrorUniqueness, err)
+
+	patched, err := handler.Patch(r, resource.ID, PatchRequest{Operations: []PatchOperation{
+		{Op: PatchOperationReplace, Path: "serial", Value: "sn-2"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "device SN-2", patched.Attributes["name"])
+
+	page, err := handler.GetAll(r, &ListRequestParams{Count: 10, StartIndex: 1})
+	assert.NoError(t, err)
+	for _, resource := range page.Resources {
+		assert.NotNil(t, resource.Attributes["name"])
+	}
+
+	assert.NoError(t, handler.Delete(r, resource.ID))
+	assert.Equal(t, []string{resource.ID}, deleted)
+}
+
+func TestStoreHandlerServerInvalidPatch(t *testing.T) {
+	resourceType := newTestCoreUserResourceType()
+	handler := NewStoreHandler(resourceType, NewMemoryDatabase().Store(resourceType))
+	resourceType.Handler = handler
+	server := Server{ResourceTypes: []ResourceType{resourceType}}
+
+	resource, err := handler.Create(httptest.NewRequest(http.MethodPost, "/Users", nil), ResourceAttributes{
+		"userName": "bjensen",
+		"emails": []interface{}{
+			map[string]interface{}{"value": "bjensen@example.com", "type": "work"},
+		},
+	})
+	assert.NoError(t, err)
+
+	for _, op := range []string{
+		`{"op": "remove", "path": "userName"}`,
+		`{"op": "replace", "path": "emails[type eq \"work\"].value", "value": 123}`,
+	} {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/Users/"+resource.ID, strings.NewReader(`{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [`+op+`]
+		}`)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, op)
+	}
+
+	stored, err := handler.Get(httptest.NewRequest(http.MethodGet, "/Users", nil), resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, resource.Attributes, stored.Attributes)
+}
+
+func TestStoreHandlerServer(t *testing.T) {
+	handler, _ := newTestStoreHandler()
+	resourceType := handler.resourceType
+	resourceType.Handler = handler
+	server := Server{ResourceTypes: []ResourceType{resourceType}}
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/Devices", strings.NewReader(`{
+		"schemas": ["urn:example:Device"],
+		"serial": "SN-1"
+	}`)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, `W/"1"`, rr.Header().Get("ETag"))
+
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Devices?filter=serial+eq+%22SN-1%22", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"serial":"SN-1"`)
+}
@@ -0,0 +1,123 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	filter "github.com/di-wu/scim-filter-parser"
+)
+
+// StoreTimeouts are the maximum durations of the operations of a Store. A zero duration means that the operations are
+// only bound by the context they are given, i.e. that of the request they serve.
+type StoreTimeouts struct {
+	// Read bounds Find, Query, Count and InUse.
+	Read time.Duration
+	// Write bounds Insert, Replace and Delete.
+	Write time.Duration
+	// Transaction bounds a whole transaction, including the operations within it.
+	Transaction time.Duration
+}
+
+// TimeoutError is returned by a store with timeouts when an operation does not complete within its timeout.
+type TimeoutError struct {
+	// Operation is the name of the method of the Store that timed out, e.g. "Query".
+	Operation string
+	// Timeout is the timeout the operation exceeded.
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("scim: %s did not complete within %s", e.Operation, e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded, so that timeouts can be recognized regardless of the operation.
+func (e TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// WithTimeouts returns a store that bounds the operations of the given store by the timeouts. An operation that exceeds
+// its timeout is cancelled and returns a TimeoutError, which StoreError converts to a SCIM error.
+func WithTimeouts(store Store, timeouts StoreTimeouts) Store {
+	return timeoutStore{
+		store:    store,
+		timeouts: timeouts,
+	}
+}
+
+type timeoutStore struct {
+	store    Store
+	timeouts StoreTimeouts
+}
+
+// do calls fn with a context that is cancelled when the timeout expires. The error of fn is replaced by a TimeoutError
+// if the timeout expired, as stores do not report the cancellation of an operation in a uniform way.
+func (s timeoutStore) do(ctx context.Context, operation string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return TimeoutError{Operation: operation, Timeout: timeout}
+	}
+	return err
+}
+
+func (s timeoutStore) Insert(ctx context.Context, resource ResourceAttributes) error {
+	return s.do(ctx, "Insert", s.timeouts.Write, func(ctx context.Context) error {
+		return s.store.Insert(ctx, resource)
+	})
+}
+
+func (s timeoutStore) Find(ctx context.Context, id string) (resource ResourceAttributes, err error) {
+	err = s.do(ctx, "Find", s.timeouts.Read, func(ctx context.Context) error {
+		resource, err = s.store.Find(ctx, id)
+		return err
+	})
+	return resource, err
+}
+
+func (s timeoutStore) Query(ctx context.Context, query StoreQuery) (resources []ResourceAttributes, err error) {
+	err = s.do(ctx, "Query", s.timeouts.Read, func(ctx context.Context) error {
+		resources, err = s.store.Query(ctx, query)
+		return err
+	})
+	return resources, err
+}
+
+func (s timeoutStore) Count(ctx context.Context, filter filter.Expression) (count int, err error) {
+	err = s.do(ctx, "Count", s.timeouts.Read, func(ctx context.Context) error {
+		count, err = s.store.Count(ctx, filter)
+		return err
+	})
+	return count, err
+}
+
+func (s timeoutStore) InUse(ctx context.Context, attribute UniqueAttribute, id string, values []interface{}) (inUse bool, err error) {
+	err = s.do(ctx, "InUse", s.timeouts.Read, func(ctx context.Context) error {
+		inUse, err = s.store.InUse(ctx, attribute, id, values)
+		return err
+	})
+	return inUse, err
+}
+
+func (s timeoutStore) Replace(ctx context.Context, id string, resource ResourceAttributes, version string) error {
+	return s.do(ctx, "Replace", s.timeouts.Write, func(ctx context.Context) error {
+		return s.store.Replace(ctx, id, resource, version)
+	})
+}
+
+func (s timeoutStore) Delete(ctx context.Context, id string, version string) error {
+	return s.do(ctx, "Delete", s.timeouts.Write, func(ctx context.Context) error {
+		return s.store.Delete(ctx, id, version)
+	})
+}
+
+func (s timeoutStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.do(ctx, "Transaction", s.timeouts.Transaction, func(ctx context.Context) error {
+		return s.store.Transaction(ctx, fn)
+	})
+}
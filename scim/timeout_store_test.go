@@ -0,0 +1,79 @@
+package scim
+
+import (
+	"context"
+	goerrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowStore is a store of which Find blocks until its context is done, after which it returns an error that, like
+// those of some database drivers, does not wrap the error of the context.
+type slowStore struct {
+	Store
+}
+
+func (s slowStore) Find(ctx context.Context, _ string) (ResourceAttributes, error) {
+	<-ctx.Done()
+	return nil, goerrors.New("server selection timeout")
+}
+
+func TestTimeoutStore(t *testing.T) {
+	store := WithTimeouts(slowStore{newTestMemoryStore(t)}, StoreTimeouts{Read: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	_, err := store.Find(ctx, "0001")
+	assert.Equal(t, TimeoutError{Operation: "Find", Timeout: 10 * time.Millisecond}, err)
+	assert.True(t, goerrors.Is(err, context.DeadlineExceeded))
+
+	// operations within their timeout, or without a timeout, are not affected
+	count, err := store.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.NoError(t, store.Insert(ctx, ResourceAttributes{"id": "0004"}))
+}
+
+func TestTimeoutStoreTransaction(t *testing.T) {
+	store := WithTimeouts(slowStore{newTestMemoryStore(t)}, StoreTimeouts{Transaction: 10 * time.Millisecond})
+
+	err := store.Transaction(context.Background(), func(ctx context.Context) error {
+		assert.NoError(t, store.Delete(ctx, "0001", ""))
+		_, err := store.Find(ctx, "0002")
+		return err
+	})
+	assert.Equal(t, TimeoutError{Operation: "Transaction", Timeout: 10 * time.Millisecond}, err)
+
+	// the transaction is rolled back
+	count, err := store.Count(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestStoreErrorTimeout(t *testing.T) {
+	err := StoreError(TimeoutError{Operation: "Query", Timeout: 5 * time.Second})
+	assert.Equal(t, errors.ScimErrorTimeout(
+		"The Query operation of the data store did not complete within 5s. Please try again later.",
+	), err)
+	assert.Equal(t, http.StatusInternalServerError, err.(errors.ScimError).Status)
+
+	err = StoreError(context.DeadlineExceeded)
+	assert.Equal(t, http.StatusInternalServerError, err.(errors.ScimError).Status)
+	assert.NotEmpty(t, err.(errors.ScimError).Detail)
+}
+
+func TestStoreHandlerTimeout(t *testing.T) {
+	handler, database := newTestStoreHandler()
+	handler.store = WithTimeouts(slowStore{database.Store(handler.resourceType)}, StoreTimeouts{Read: 10 * time.Millisecond})
+	r := httptest.NewRequest(http.MethodGet, "/Devices/0001", nil)
+
+	_, err := handler.Get(r, "0001")
+	assert.Equal(t, errors.ScimErrorTimeout(
+		"The Find operation of the data store did not complete within 10ms. Please try again later.",
+	), err)
+}
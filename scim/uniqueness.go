@@ -0,0 +1,102 @@
+package scim
+
+import "github.com/dgbttn/go-scim-server/schema"
+
+// UniqueAttribute is a simple attribute, or a sub-attribute of a complex attribute, of which the values can not be
+// shared by multiple resources.
+type UniqueAttribute struct {
+	// SchemaID is the URI of the schema extension that defines the attribute. It is empty for the attributes of the
+	// primary schema.
+	SchemaID string
+	// Attribute is the (parent) attribute.
+	Attribute schema.CoreAttribute
+	// SubAttribute is the sub-attribute of which the values are unique. It is nil if the values of the attribute itself
+	// are unique.
+	SubAttribute *schema.CoreAttribute
+	// Global indicates that the values are unique across all the resource types of the server, instead of only the
+	// resources of the resource type.
+	Global bool
+}
+
+// Path returns the attribute path of the unique attribute, e.g. "userName" or "emails.value". The path of an attribute
+// of a schema extension is prefixed with the URI of that extension.
+func (u UniqueAttribute) Path() string {
+	path := u.Attribute.Name()
+	if u.SubAttribute != nil {
+		path += "." + u.SubAttribute.Name()
+	}
+	if u.SchemaID != "" {
+		path = u.SchemaID + ":" + path
+	}
+	return path
+}
+
+// CaseExact returns whether the values of the unique attribute are compared case sensitively.
+func (u UniqueAttribute) CaseExact() bool {
+	if u.SubAttribute != nil {
+		return u.SubAttribute.CaseExact()
+	}
+	return u.Attribute.CaseExact()
+}
+
+// Values returns the values of the unique attribute in the given resource attributes. Values of multi-valued
+// attributes are returned separately.
+func (u UniqueAttribute) Values(attributes ResourceAttributes) []interface{} {
+	container := map[string]interface{}(attributes)
+	if u.SchemaID != "" {
+		container, _ = toMap(lookup(container, u.SchemaID))
+	}
+
+	var values []interface{}
+	for _, value := range asSlice(lookup(container, u.Attribute.Name())) {
+		if u.SubAttribute != nil {
+			element, _ := toMap(value)
+			value = lookup(element, u.SubAttribute.Name())
+		}
+		if value != nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// UniqueAttributes returns the attributes of the schemas of the resource type of which the uniqueness is either
+// "server" or "global". The uniqueness of complex attributes is not enforced, only that of their sub-attributes.
+func (t ResourceType) UniqueAttributes() []UniqueAttribute {
+	unique := uniqueAttributes("", t.Schema.Attributes)
+	for _, extension := range t.SchemaExtensions {
+		unique = append(unique, uniqueAttributes(extension.Schema.ID, extension.Schema.Attributes)...)
+	}
+	return unique
+}
+
+func uniqueAttributes(schemaID string, attributes []schema.CoreAttribute) []UniqueAttribute {
+	var unique []UniqueAttribute
+	for _, attr := range attributes {
+		if attr.AttributeType() != "complex" {
+			if u, ok := uniqueness(attr); ok {
+				unique = append(unique, UniqueAttribute{SchemaID: schemaID, Attribute: attr, Global: u})
+			}
+			continue
+		}
+		for _, sub := range attr.SubAttributes() {
+			sub := sub
+			if u, ok := uniqueness(sub); ok {
+				unique = append(unique, UniqueAttribute{SchemaID: schemaID, Attribute: attr, SubAttribute: &sub, Global: u})
+			}
+		}
+	}
+	return unique
+}
+
+// uniqueness returns whether the values of the attribute are unique, and if so whether they are globally unique.
+func uniqueness(attr schema.CoreAttribute) (global bool, unique bool) {
+	switch attr.Uniqueness() {
+	case schema.AttributeUniquenessGlobal():
+		return true, true
+	case schema.AttributeUniquenessServer():
+		return false, true
+	default:
+		return false, false
+	}
+}
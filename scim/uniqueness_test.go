@@ -0,0 +1,47 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/dgbttn/go-scim-server/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceTypeUniqueAttributes(t *testing.T) {
+	unique := newTestDeviceResourceType().UniqueAttributes()
+
+	paths := make([]string, len(unique))
+	for i, u := range unique {
+		paths[i] = u.Path()
+	}
+	assert.Equal(t, []string{"serial", "addresses.value", "urn:example:Asset:tag"}, paths)
+
+	assert.True(t, unique[0].Global)
+	assert.False(t, unique[0].CaseExact())
+	assert.False(t, unique[1].Global)
+	assert.True(t, unique[1].CaseExact())
+	assert.Equal(t, "urn:example:Asset", unique[2].SchemaID)
+
+	unique = (ResourceType{Schema: schema.CoreUserSchema()}).UniqueAttributes()
+	assert.Len(t, unique, 1)
+	assert.Equal(t, "userName", unique[0].Path())
+}
+
+func TestUniqueAttributeValues(t *testing.T) {
+	unique := newTestDeviceResourceType().UniqueAttributes()
+	attributes := ResourceAttributes{
+		"Serial": "SN-1",
+		"addresses": []interface{}{
+			map[string]interface{}{"value": "10.0.0.1", "type": "ipv4"},
+			map[string]interface{}{"type": "mac"},
+			map[string]interface{}{"value": "fe80::1", "type": "ipv6"},
+		},
+		"urn:example:Asset": map[string]interface{}{"tag": "A-1"},
+	}
+
+	assert.Equal(t, []interface{}{"SN-1"}, unique[0].Values(attributes))
+	assert.Equal(t, []interface{}{"10.0.0.1", "fe80::1"}, unique[1].Values(attributes))
+	assert.Equal(t, []interface{}{"A-1"}, unique[2].Values(attributes))
+	assert.Empty(t, unique[2].Values(ResourceAttributes{"serial": "SN-1"}))
+}
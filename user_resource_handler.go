@@ -1,20 +1,16 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 
-	"github.com/dgbttn/go-scim-server/db"
 	"github.com/dgbttn/go-scim-server/errors"
 	"github.com/dgbttn/go-scim-server/optional"
 	"github.com/dgbttn/go-scim-server/schema"
 	"github.com/dgbttn/go-scim-server/scim"
-	"github.com/google/uuid"
 	"github.com/spf13/viper"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 var (
@@ -24,7 +20,6 @@ var (
 		BaseURI: provisionerURL,
 		Params:  map[string]string{"client_id": clientID},
 	}
-	userResourceHandler = UserResourceHandler{}
 	// UserResourceType ...
 	UserResourceType = scim.ResourceType{
 		ID:          optional.NewString("User"),
@@ -32,320 +27,195 @@ var (
 		Endpoint:    "/Users",
 		Description: optional.NewString("User Account"),
 		Schema:      schema.CoreUserSchema(),
-		Handler:     userResourceHandler,
+		SchemaExtensions: []scim.SchemaExtension{
+			{Schema: schema.ExtensionEnterpriseUser()},
+		},
 		Provisioner: &userProvisioner,
 	}
 )
 
-// UserResourceHandler ...
-type UserResourceHandler struct{}
-
-// Create ...
-func (h UserResourceHandler) Create(r *http.Request, userInfo scim.ResourceAttributes) (scim.Resource, error) {
-	id := uuid.New().String()
-	now := time.Now()
-	_, externalID, attributes, _ := h.extractUserData(userInfo)
-	resource := scim.Resource{
-		ID:         id,
-		ExternalID: externalID,
-		Attributes: attributes,
-		Meta: scim.Meta{
-			ResourceType: UserResourceType.Name,
-			Created:      &now,
-			LastModified: &now,
-			Location:     fmt.Sprintf("%s/%s", UserResourceType.Endpoint[1:], url.PathEscape(id)),
-		},
-	}
-	// store resource
-	if err := db.MongoDB.Insert(resource.Map(UserResourceType)); err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
-	}
-	// return stored resource
-	return resource, nil
+// withStrictSchema returns the resource type with strict validation of its schema and schema extensions, so that
+// resources are rejected if they contain values other than the canonical values, e.g. of "emails.type", which
+// downstream systems do not accept.
+func withStrictSchema(resourceType scim.ResourceType) scim.ResourceType {
+	resourceType.Schema.Strict = true
+	extensions := make([]scim.SchemaExtension, len(resourceType.SchemaExtensions))
+	for i, extension := range resourceType.SchemaExtensions {
+		extension.Schema.Strict = true
+		extensions[i] = extension
+	}
+	resourceType.SchemaExtensions = extensions
+	return resourceType
 }
 
-// Get ...
-func (h UserResourceHandler) Get(r *http.Request, id string) (scim.Resource, error) {
-	// check if resource exists
-	user, err := db.MongoDB.Find(id)
-	if err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
-	}
-	if len(user) == 0 {
-		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
-	}
-	delete(user, "_id")
-	return h.userDataToResource(user), nil
+// UserResourceHandler is the handler of the users, which stores them with a scim.StoreHandler. The groups of the users
+// are not stored, but derived from the members of the groups when the users are returned.
+type UserResourceHandler struct {
+	scim.StoreHandler
+	users  scim.Store
+	groups scim.Store
 }
 
-// GetAll ...
-func (h UserResourceHandler) GetAll(r *http.Request, params *scim.ListRequestParams) (scim.Page, error) {
-	resources := make([]scim.Resource, 0)
+// NewUserResourceHandler returns a handler of the users in the given store. The groups the users are a member of are
+// derived from the groups in the group store.
+func NewUserResourceHandler(users scim.Store, groups scim.Store) UserResourceHandler {
+	h := UserResourceHandler{
+		users:  users,
+		groups: groups,
+	}
+	h.StoreHandler = scim.NewStoreHandler(UserResourceType, users).WithHooks(scim.StoreHooks{
+		Prepare:         h.prepare,
+		CheckUniqueness: h.checkUniqueness,
+		Output:          h.output,
+		Deleted:         h.groupHandler().removeMember,
+	})
+	return h
+}
 
-	data, err := db.MongoDB.GetAll()
-	if err != nil {
-		return scim.Page{}, errors.ScimErrorInternal
-	}
+// groupHandler returns the handler of the groups the users can be a member of.
+func (h UserResourceHandler) groupHandler() GroupResourceHandler {
+	return NewGroupResourceHandler(h.users, h.groups)
+}
 
-	if len(data) == 0 {
-		return scim.Page{
-			TotalResults: 0,
-			Resources:    []scim.Resource{},
-		}, nil
-	}
+// prepare removes the groups from the attributes of the user with the given id, as they are derived from the members of
+// the groups, and checks its manager.
+func (h UserResourceHandler) prepare(ctx context.Context, id string, attributes scim.ResourceAttributes) error {
+	delete(attributes, "groups")
+	return h.checkManager(ctx, id, attributes)
+}
 
-	var from, to int
-	if params.StartIndex > 0 {
-		from = params.StartIndex - 1
-	}
-	if from+params.Count >= len(data) {
-		params.Count = len(data) - from
-	}
-	to = from + params.Count
-	for _, user := range data[from:to] {
-		delete(user, "_id")
-		resources = append(resources, h.userDataToResource(user))
-	}
+// checkUniqueness checks that no other user or group has one of the values of the unique attributes of the user.
+func (h UserResourceHandler) checkUniqueness(ctx context.Context, id string, attributes scim.ResourceAttributes) error {
+	return checkUniqueness(ctx, h.stores(), UserResourceType, id, attributes)
+}
 
-	return scim.Page{
-		TotalResults: len(data),
-		Resources:    resources,
-	}, nil
+// stores returns the resource types of the server, together with their stores.
+func (h UserResourceHandler) stores() []storedResourceType {
+	return storedResourceTypes(h.users, h.groups)
 }
 
-// Replace ...
-func (h UserResourceHandler) Replace(r *http.Request, id string, attributes scim.ResourceAttributes) (scim.Resource, error) {
-	user, err := db.MongoDB.Find(id)
-	if err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
+// checkManager checks that the manager of the user with the given id references another existing user. Only the id of
+// the manager is stored, its "displayName" and "$ref" are filled in when the user is returned.
+func (h UserResourceHandler) checkManager(ctx context.Context, id string, attributes map[string]interface{}) error {
+	extensionID := schema.ExtensionEnterpriseUser().ID
+	extension, _ := getMap(attributes[extensionID])
+	if extension == nil {
+		return nil
 	}
-	if len(user) == 0 {
-		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
-	}
-	db.MongoDB.Delete(id)
 
-	created := h.userDataToResource(user).Meta.Created
-	lastModified := time.Now()
+	manager, _ := getMap(extension["manager"])
+	managerID, _ := manager["value"].(string)
+	if managerID == "" {
+		delete(extension, "manager")
+		attributes[extensionID] = extension
+		return nil
+	}
 
-	_, externalID, attrs, meta := h.extractUserData(attributes)
-	newUser := scim.Resource{
-		ID:         id,
-		ExternalID: externalID,
-		Attributes: attrs,
-		Meta: scim.Meta{
-			ResourceType: meta.ResourceType,
-			Created:      created,
-			LastModified: &lastModified,
-			Location:     meta.Location,
-		},
+	invalid := errors.ScimError{
+		ScimType: errors.ScimTypeInvalidValue,
+		Detail:   fmt.Sprintf("Manager %s does not exist.", managerID),
+		Status:   http.StatusBadRequest,
 	}
-	// store resource
-	if err := db.MongoDB.Insert(newUser.Map(UserResourceType)); err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
+	if managerID == id {
+		invalid.Detail = "A user can not be its own manager."
+		return invalid
 	}
-	return newUser, nil
-}
-
-// Delete ...
-func (h UserResourceHandler) Delete(r *http.Request, id string) error {
-	// check if resource exists
-	user, err := db.MongoDB.Find(id)
+	user, err := h.users.Find(ctx, managerID)
 	if err != nil {
-		return errors.ScimErrorInternal
+		return scim.StoreError(err)
 	}
 	if len(user) == 0 {
-		return errors.ScimErrorResourceNotFound(id)
+		return invalid
 	}
 
-	// delete resource
-	db.MongoDB.Delete(id)
+	extension["manager"] = map[string]interface{}{"value": managerID}
+	attributes[extensionID] = extension
 	return nil
 }
 
-// Patch ...
-func (h UserResourceHandler) Patch(r *http.Request, id string, req scim.PatchRequest) (scim.Resource, error) {
-	user, err := db.MongoDB.Find(id)
+// output adds the attributes of the users that are not stored, but derived from other resources. The version of the
+// users covers these attributes, so that it changes when the groups or the manager of a user change.
+func (h UserResourceHandler) output(r *http.Request, resources []scim.Resource) ([]scim.Resource, error) {
+	ctx := r.Context()
+	resources, err := h.withGroups(ctx, resources...)
 	if err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
+		return nil, err
 	}
-	if len(user) == 0 {
-		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
+	if resources, err = h.withManagers(ctx, resources...); err != nil {
+		return nil, err
 	}
 
-	for _, op := range req.Operations {
-		switch op.Op {
-		case scim.PatchOperationAdd:
-			if op.Path != "" {
-				user[op.Path] = op.Value
-			} else {
-				valueMap := op.Value.(map[string]interface{})
-				for k, v := range valueMap {
-					if arr, ok := v.([]interface{}); ok {
-						list, _ := json.Marshal(user[k])
-						oldArr := []interface{}{}
-						json.Unmarshal(list, &oldArr)
-						user[k] = append(oldArr, arr...)
-					} else {
-						user[k] = v
-					}
-				}
-			}
-		case scim.PatchOperationReplace:
-			if op.Path != "" {
-				user[op.Path] = op.Value
-			} else {
-				valueMap := op.Value.(map[string]interface{})
-				for k, v := range valueMap {
-					user[k] = v
-				}
-			}
-		case scim.PatchOperationRemove:
-			user[op.Path] = nil
-		}
+	extensionID := schema.ExtensionEnterpriseUser().ID
+	for i, resource := range resources {
+		extension, _ := getMap(resource.Attributes[extensionID])
+		resources[i].Meta.Version = scim.DerivedETag(resource.Meta.Version, resource.Attributes["groups"], extension["manager"])
 	}
-
-	db.MongoDB.Delete(id)
-
-	meta := h.userDataToResource(user).Meta
-	lastModified := time.Now()
-
-	_, externalID, attrs, _ := h.extractUserData(user)
-
-	// return resource with replaced attributes
-	newUser := scim.Resource{
-		ID:         id,
-		ExternalID: externalID,
-		Attributes: attrs,
-		Meta: scim.Meta{
-			ResourceType: meta.ResourceType,
-			Created:      meta.Created,
-			LastModified: &lastModified,
-			Location:     meta.Location,
-		},
-	}
-	// store resource
-	if err := db.MongoDB.Insert(newUser.Map(UserResourceType)); err != nil {
-		return scim.Resource{}, errors.ScimErrorInternal
-	}
-	return newUser, nil
+	return resources, nil
 }
 
-func (h UserResourceHandler) externalID(attributes map[string]interface{}) optional.String {
-	if eID, ok := attributes["externalId"]; ok {
-		externalID, ok := eID.(string)
-		if !ok {
-			return optional.String{}
+// withManagers fills in the "displayName" and "$ref" of the managers of the users.
+func (h UserResourceHandler) withManagers(ctx context.Context, resources ...scim.Resource) ([]scim.Resource, error) {
+	extensionID := schema.ExtensionEnterpriseUser().ID
+
+	managers := make(map[string]map[string]interface{})
+	var ids []string
+	for _, resource := range resources {
+		extension, _ := getMap(resource.Attributes[extensionID])
+		manager, _ := getMap(extension["manager"])
+		if managerID, _ := manager["value"].(string); managerID != "" {
+			managers[resource.ID] = extension
+			ids = append(ids, managerID)
 		}
-		return optional.NewString(externalID)
-	}
-
-	return optional.String{}
-}
-
-func (h UserResourceHandler) getSlice(v interface{}) (s []interface{}, ok bool) {
-	b, err := json.Marshal(v)
-	if err != nil {
-		return
 	}
-	err = json.Unmarshal(b, &s)
-	if err != nil {
-		return
+	if len(ids) == 0 {
+		return resources, nil
 	}
-	return s, true
-}
 
-func (h UserResourceHandler) getMap(v interface{}) (m map[string]interface{}, ok bool) {
-	b, err := json.Marshal(v)
+	data, err := h.users.Query(ctx, scim.StoreQuery{Filter: valuesFilter("id", ids)})
 	if err != nil {
-		return
+		return nil, scim.StoreError(err)
 	}
-	err = json.Unmarshal(b, &m)
-	if err != nil {
-		return
+	displayNames := make(map[string]interface{})
+	for _, user := range data {
+		if id, ok := user["id"].(string); ok {
+			displayNames[id] = user["displayName"]
+		}
 	}
-	return m, true
-}
 
-func (h UserResourceHandler) cleanMap(userData map[string]interface{}) map[string]interface{} {
-	for k, v := range userData {
-		if v == nil {
-			delete(userData, k)
-			continue
-		}
-		if attr, ok := h.getMap(v); ok {
-			userData[k] = h.cleanMap(attr)
+	for _, resource := range resources {
+		extension, ok := managers[resource.ID]
+		if !ok {
 			continue
 		}
-		if attr, ok := h.getSlice(v); ok {
-			for i := 0; i < len(attr); i++ {
-				if element, ok := h.getMap(attr[i]); ok {
-					attr[i] = h.cleanMap(element)
-				}
-			}
-			userData[k] = attr
+		manager, _ := getMap(extension["manager"])
+		managerID, _ := manager["value"].(string)
+		manager["$ref"] = fmt.Sprintf("%s/%s", UserResourceType.Endpoint[1:], url.PathEscape(managerID))
+		if displayName, ok := displayNames[managerID]; ok && displayName != nil {
+			manager["displayName"] = displayName
 		}
+		extension["manager"] = manager
+		resource.Attributes[extensionID] = extension
 	}
-	return userData
+	return resources, nil
 }
 
-func (h UserResourceHandler) extractUserData(userData map[string]interface{}) (id string, externalID optional.String, attributes map[string]interface{}, meta scim.Meta) {
-	// id
-	if idAttr, ok := userData["id"]; ok {
-		id, _ = idAttr.(string)
+// withGroups adds the groups the users are a member of, either directly or through nested groups. The "groups"
+// attribute is not stored with the users, but derived from the members of the groups.
+func (h UserResourceHandler) withGroups(ctx context.Context, resources ...scim.Resource) ([]scim.Resource, error) {
+	ids := make([]string, len(resources))
+	for i, resource := range resources {
+		ids[i] = resource.ID
 	}
 
-	// externalID
-	if eIDAttr, ok := userData["externalId"]; ok {
-		if eIDStr, ok := eIDAttr.(string); ok {
-			externalID = optional.NewString(eIDStr)
-		}
+	memberOf, err := h.groupHandler().memberOf(ctx, ids)
+	if err != nil {
+		return nil, err
 	}
 
-	// other attributes
-	attributes = h.cleanMap(userData)
-
-	// meta
-	if m, ok := userData["meta"]; ok {
-		b, err := bson.MarshalExtJSON(m, true, true)
-		if err != nil {
-			return
+	for _, resource := range resources {
+		if groups, ok := memberOf[resource.ID]; ok {
+			resource.Attributes["groups"] = groups
 		}
-		var metaAttr map[string]string
-		err = json.Unmarshal(b, &metaAttr)
-		if err != nil {
-			return
-		}
-		resourceType, ok := metaAttr["resourcetype"]
-		if !ok {
-			return
-		}
-		location, ok := metaAttr["location"]
-		if !ok {
-			return
-		}
-		meta.ResourceType = resourceType
-		meta.Location = location
-		if created, ok := metaAttr["created"]; ok {
-			createdTime, _ := time.Parse(time.RFC3339, created)
-			meta.Created = &createdTime
-		}
-		if lastModified, ok := metaAttr["lastmodified"]; ok {
-			lastModifiedTime, _ := time.Parse(time.RFC3339, lastModified)
-			meta.LastModified = &lastModifiedTime
-		}
-		if version, ok := metaAttr["version"]; ok {
-			meta.Version = version
-		}
-	}
-	return
-}
-
-func (h UserResourceHandler) userDataToResource(userData map[string]interface{}) scim.Resource {
-	id, externalID, attributes, meta := h.extractUserData(userData)
-	return scim.Resource{
-		ID:         id,
-		ExternalID: externalID,
-		Attributes: attributes,
-		Meta:       meta,
 	}
+	return resources, nil
 }
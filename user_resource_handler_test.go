@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgbttn/go-scim-server/db"
+	"github.com/dgbttn/go-scim-server/db/postgrestest"
+	"github.com/dgbttn/go-scim-server/errors"
+	"github.com/dgbttn/go-scim-server/scim"
+	filter "github.com/di-wu/scim-filter-parser"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	postgrestest.Main(m)
+}
+
+// testStores are the stores the resource handlers are tested with, by name. The tests of the PostgreSQL store are
+// skipped if there is no test database.
+var testStores = map[string]func(t *testing.T) storeOpener{
+	"memory": func(t *testing.T) storeOpener {
+		database := scim.NewMemoryDatabase()
+		return func(resourceType scim.ResourceType, _ string) scim.Store {
+			return database.Store(resourceType)
+		}
+	},
+	"postgres": func(t *testing.T) storeOpener {
+		ctx := context.Background()
+		database, err := db.ConnectPostgres(ctx, postgrestest.DSN(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = database.Close() })
+
+		// the collections of each test are new, so that tests do not see each others resources
+		prefix := "test-" + uuid.New().String() + "-"
+		return func(resourceType scim.ResourceType, collection string) scim.Store {
+			if err := database.CreateUniqueIndexes(ctx, prefix+collection, resourceType.UniqueAttributes()); err != nil {
+				t.Fatal(err)
+			}
+			return database.Store(prefix+collection, resourceType)
+		}
+	},
+}
+
+// newTestHandlers returns the handlers of the users and the groups in the stores of the given opener.
+func newTestHandlers(openStore storeOpener) (UserResourceHandler, GroupResourceHandler) {
+	users := openStore(UserResourceType, "users")
+	groups := openStore(GroupResourceType, "groups")
+	return NewUserResourceHandler(users, groups), NewGroupResourceHandler(users, groups)
+}
+
+func parseFilter(t *testing.T, s string) filter.Expression {
+	expression, err := filter.NewParser(strings.NewReader(s)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expression
+}
+
+func TestUserResourceHandler(t *testing.T) {
+	for name, openStore := range testStores {
+		t.Run(name, func(t *testing.T) {
+			users, groups := newTestHandlers(openStore(t))
+			r := httptest.NewRequest(http.MethodPost, "/Users", nil)
+
+			created, err := users.Create(r, scim.ResourceAttributes{
+				"userName": "bjensen",
+				"emails": []interface{}{
+					map[string]interface{}{"value": "bjensen@example.com", "type": "work"},
+				},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, `W/"1"`, created.Meta.Version)
+
+			_, err = users.Create(r, scim.ResourceAttributes{"userName": "BJensen"})
+			assert.Equal(t, errors.ScimTypeUniqueness, err.(errors.ScimError).ScimType)
+
+			group, err := groups.Create(r, scim.ResourceAttributes{
+				"displayName": "Admins",
+				"members":     []interface{}{map[string]interface{}{"value": created.ID}},
+			})
+			assert.NoError(t, err)
+
+			user, err := users.Get(r, created.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "bjensen", user.Attributes["userName"])
+			userGroups, _ := user.Attributes["groups"].([]interface{})
+			if assert.Len(t, userGroups, 1) {
+				assert.Equal(t, group.ID, userGroups[0].(map[string]interface{})["value"])
+			}
+
+			page, err := users.GetAll(r, &scim.ListRequestParams{
+				Count:      10,
+				StartIndex: 1,
+				Filter:     parseFilter(t, `emails[type eq "work" and value co "example.com"]`),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, page.TotalResults)
+
+			patched, err := users.Patch(r, created.ID, scim.PatchRequest{Operations: []scim.PatchOperation{
+				{Op: "replace", Path: "displayName", Value: "Babs Jensen"},
+			}})
+			assert.NoError(t, err)
+			assert.Equal(t, "Babs Jensen", patched.Attributes["displayName"])
+			// the version covers the groups of the user
+			assert.Regexp(t, `^W/"2-[0-9a-f]{8}"$`, patched.Meta.Version)
+
+			replaced, err := users.Replace(r, created.ID, scim.ResourceAttributes{"userName": "babs"})
+			assert.NoError(t, err)
+			assert.Equal(t, "babs", replaced.Attributes["userName"])
+			assert.Nil(t, replaced.Attributes["displayName"])
+			assert.Regexp(t, `^W/"3-[0-9a-f]{8}"$`, replaced.Meta.Version)
+
+			assert.NoError(t, users.Delete(r, created.ID))
+			_, err = users.Get(r, created.ID)
+			assert.Equal(t, http.StatusNotFound, err.(errors.ScimError).Status)
+
+			// the deleted user is no longer a member of the group
+			group, err = groups.Get(r, group.ID)
+			assert.NoError(t, err)
+			assert.Nil(t, group.Attributes["members"])
+			assert.Equal(t, `W/"2"`, group.Meta.Version)
+		})
+	}
+}
+
+func TestUserResourceHandlerETag(t *testing.T) {
+	users, groups := newTestHandlers(testStores["memory"](t))
+	userType, groupType := UserResourceType, GroupResourceType
+	userType.Handler, groupType.Handler = users, groups
+	server := scim.Server{
+		Config:        scim.ServiceProviderConfig{SupportETag: true},
+		ResourceTypes: []scim.ResourceType{userType, groupType},
+	}
+	do := func(method, target, header, etag, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(header, etag)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, r)
+		return rr
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/Users", nil)
+	user, err := users.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	assert.NoError(t, err)
+
+	etag := do(http.MethodGet, "/Users/"+user.ID, "", "", "").Header().Get("Etag")
+	assert.Equal(t, http.StatusNotModified, do(http.MethodGet, "/Users/"+user.ID, "If-None-Match", etag, "").Code)
+
+	// the groups of the user change, but the user itself does not
+	_, err = groups.Create(r, scim.ResourceAttributes{
+		"displayName": "Admins",
+		"members":     []interface{}{map[string]interface{}{"value": user.ID}},
+	})
+	assert.NoError(t, err)
+
+	rr := do(http.MethodGet, "/Users/"+user.ID, "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Admins")
+	assert.NotEqual(t, etag, rr.Header().Get("Etag"))
+
+	patch := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "displayName", "value": "Babs Jensen"}]
+	}`
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPatch, "/Users/"+user.ID, "If-Match", etag, patch).Code)
+	etag = rr.Header().Get("Etag")
+	assert.Equal(t, http.StatusOK, do(http.MethodPatch, "/Users/"+user.ID, "If-Match", etag, patch).Code)
+}
+
+// slowStore is a store of which Delete blocks until its context is done.
+type slowStore struct {
+	scim.Store
+}
+
+func (s slowStore) Delete(ctx context.Context, _, _ string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestResourceHandlerDeleteTimeout(t *testing.T) {
+	database := scim.NewMemoryDatabase()
+	timeouts := scim.StoreTimeouts{Transaction: 10 * time.Millisecond}
+	users := scim.WithTimeouts(slowStore{database.Store(UserResourceType)}, timeouts)
+	groups := scim.WithTimeouts(slowStore{database.Store(GroupResourceType)}, timeouts)
+	r := httptest.NewRequest(http.MethodDelete, "/", nil)
+
+	for _, test := range []struct {
+		name       string
+		handler    scim.ResourceHandler
+		attributes scim.ResourceAttributes
+	}{
+		{name: "users", handler: NewUserResourceHandler(users, groups), attributes: scim.ResourceAttributes{"userName": "bjensen"}},
+		{name: "groups", handler: NewGroupResourceHandler(users, groups), attributes: scim.ResourceAttributes{"displayName": "Admins"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resource, err := test.handler.Create(r, test.attributes)
+			assert.NoError(t, err)
+
+			err = test.handler.Delete(r, resource.ID)
+			assert.Equal(t, scim.StoreError(scim.TimeoutError{Operation: "Transaction", Timeout: 10 * time.Millisecond}), err)
+			_, err = test.handler.Get(r, resource.ID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWithStrictSchema(t *testing.T) {
+	strict := withStrictSchema(UserResourceType)
+	assert.True(t, strict.Schema.Strict)
+	assert.True(t, strict.SchemaExtensions[0].Schema.Strict)
+
+	// users are not validated strictly by default
+	assert.False(t, UserResourceType.Schema.Strict)
+	assert.False(t, UserResourceType.SchemaExtensions[0].Schema.Strict)
+}